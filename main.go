@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"log"
+	"time"
 
 	"github.com/carolynvs/slackoverload/slackoverload"
 )
@@ -10,14 +11,39 @@ import (
 func main() {
 	h := slackoverload.SlackHandler{}
 
-	debugFlag := flag.Bool("debug", false, "Print debug statements")
+	debugFlag := flag.Bool("debug", false, "Print debug statements and serve cache statistics at /cache-stats")
+	storageFlag := flag.String("storage", slackoverload.StorageAzure, "Storage backend: azure, filesystem or memory")
+	storageDirFlag := flag.String("storage-dir", "data", "Directory used by the filesystem storage backend")
+	secretsFlag := flag.String("secrets", slackoverload.SecretsKeyVault, "Secrets backend: keyvault, vault or local")
+	secretsDirFlag := flag.String("secrets-dir", "secrets", "Directory used by the local secrets backend")
+	cacheTTLFlag := flag.Duration("cache-ttl", time.Minute, "How long to cache secrets and blobs in memory, 0 disables caching")
+	cacheSizeFlag := flag.Int("cache-size", 1000, "Maximum number of entries in each cache")
+	eventWorkersFlag := flag.Int("event-workers", slackoverload.DefaultEventWorkers, "Number of events from Slack handled at the same time")
+	socketModeFlag := flag.Bool("socket-mode", false, "Receive commands, interactions and events from Slack over Socket Mode instead of HTTP")
+	migrateFlag := flag.Bool("migrate-identities", false, "Build the identity index from existing oauth tokens and exit")
 	flag.Parse()
 	h.Debug = *debugFlag
+	h.StorageBackend = *storageFlag
+	h.StorageDir = *storageDirFlag
+	h.SecretsBackend = *secretsFlag
+	h.SecretsDir = *secretsDirFlag
+	h.CacheTTL = *cacheTTLFlag
+	h.CacheSize = *cacheSizeFlag
+	h.EventWorkers = *eventWorkersFlag
+	h.SocketMode = *socketModeFlag
 
 	err := h.Init()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if *migrateFlag {
+		err = h.MigrateIdentities()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	log.Fatal(h.Run())
 }
@@ -0,0 +1,264 @@
+package slackoverload
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CacheStats reports how effective a cache has been.
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+}
+
+// lruCache holds up to size entries for at most ttl, evicting the least
+// recently used entry when it is full.
+type lruCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	stats   CacheStats
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+func newLRUCache(ttl time.Duration, size int) *lruCache {
+	return &lruCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *lruCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.removeElement(el)
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	c.stats.Hits++
+	return entry.value, true
+}
+
+func (c *lruCache) set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *lruCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *lruCache) removePrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, el := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.removeElement(el)
+		}
+	}
+}
+
+func (c *lruCache) removeElement(el *list.Element) {
+	entry := c.order.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.key)
+}
+
+func (c *lruCache) getStats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+// CachedSecrets keeps recently used secrets in memory, so that commands that
+// fan out to multiple workspaces don't read the same tokens over and over.
+type CachedSecrets struct {
+	Secrets
+	cache *lruCache
+}
+
+type cachedSecret struct {
+	value string
+	tags  map[string]*string
+}
+
+func NewCachedSecrets(secrets Secrets, ttl time.Duration, size int) *CachedSecrets {
+	return &CachedSecrets{Secrets: secrets, cache: newLRUCache(ttl, size)}
+}
+
+func (s *CachedSecrets) GetSecret(key string) (string, map[string]*string, error) {
+	if cached, ok := s.cache.get(key); ok {
+		secret := cached.(cachedSecret)
+		return secret.value, secret.tags, nil
+	}
+
+	value, tags, err := s.Secrets.GetSecret(key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.cache.set(key, cachedSecret{value: value, tags: tags})
+	return value, tags, nil
+}
+
+func (s *CachedSecrets) SetSecret(key string, value string, tags map[string]*string) error {
+	err := s.Secrets.SetSecret(key, value, tags)
+	s.cache.remove(key)
+	return err
+}
+
+func (s *CachedSecrets) ListSecrets(prefix string) ([]string, error) {
+	lister, ok := s.Secrets.(SecretLister)
+	if !ok {
+		return nil, errors.Errorf("the secrets backend %T does not support listing secrets", s.Secrets)
+	}
+	return lister.ListSecrets(prefix)
+}
+
+func (s *CachedSecrets) Stats() CacheStats {
+	return s.cache.getStats()
+}
+
+// CachedStorage keeps recently used blobs and container listings in memory.
+// Any write made through the cache invalidates the affected entries.
+type CachedStorage struct {
+	Storage
+	cache *lruCache
+}
+
+type cachedBlob struct {
+	data []byte
+	etag ETag
+}
+
+func NewCachedStorage(store Storage, ttl time.Duration, size int) *CachedStorage {
+	return &CachedStorage{Storage: store, cache: newLRUCache(ttl, size)}
+}
+
+func (s *CachedStorage) ListContainer(containerName string, prefix string) ([]string, error) {
+	key := listCacheKey(containerName) + prefix
+	if cached, ok := s.cache.get(key); ok {
+		return append([]string(nil), cached.([]string)...), nil
+	}
+
+	names, err := s.Storage.ListContainer(containerName, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.set(key, append([]string(nil), names...))
+	return names, nil
+}
+
+func (s *CachedStorage) GetBlob(containerName string, blobName string) ([]byte, error) {
+	data, _, err := s.GetBlobVersion(containerName, blobName)
+	return data, err
+}
+
+func (s *CachedStorage) GetBlobVersion(containerName string, blobName string) ([]byte, ETag, error) {
+	key := blobCacheKey(containerName, blobName)
+	if cached, ok := s.cache.get(key); ok {
+		blob := cached.(cachedBlob)
+		return copyBytes(blob.data), blob.etag, nil
+	}
+
+	data, etag, err := s.Storage.GetBlobVersion(containerName, blobName)
+	if err != nil {
+		return nil, ETagNone, err
+	}
+
+	s.cache.set(key, cachedBlob{data: copyBytes(data), etag: etag})
+	return data, etag, nil
+}
+
+func (s *CachedStorage) SetBlob(containerName string, blobName string, data []byte) error {
+	err := s.Storage.SetBlob(containerName, blobName, data)
+	s.invalidate(containerName, blobName)
+	return err
+}
+
+func (s *CachedStorage) SetBlobIfMatch(containerName string, blobName string, data []byte, etag ETag) error {
+	// Also invalidate on a conflict, since that means our cached copy is stale
+	err := s.Storage.SetBlobIfMatch(containerName, blobName, data, etag)
+	s.invalidate(containerName, blobName)
+	return err
+}
+
+func (s *CachedStorage) DeleteBlob(containerName string, blobName string) error {
+	err := s.Storage.DeleteBlob(containerName, blobName)
+	s.invalidate(containerName, blobName)
+	return err
+}
+
+func (s *CachedStorage) DeleteBlobIfMatch(containerName string, blobName string, etag ETag) error {
+	err := s.Storage.DeleteBlobIfMatch(containerName, blobName, etag)
+	s.invalidate(containerName, blobName)
+	return err
+}
+
+func (s *CachedStorage) Stats() CacheStats {
+	return s.cache.getStats()
+}
+
+func (s *CachedStorage) invalidate(containerName string, blobName string) {
+	s.cache.remove(blobCacheKey(containerName, blobName))
+	s.cache.removePrefix(listCacheKey(containerName))
+}
+
+func blobCacheKey(containerName string, blobName string) string {
+	return "blob\x00" + containerName + "\x00" + blobName
+}
+
+func listCacheKey(containerName string) string {
+	return "list\x00" + containerName + "\x00"
+}
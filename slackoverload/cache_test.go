@@ -0,0 +1,220 @@
+package slackoverload
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLRUCache_Eviction(t *testing.T) {
+	c := newLRUCache(time.Minute, 2)
+	c.set("a", 1)
+	c.set("b", 2)
+
+	// Using a makes b the least recently used entry
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	c.set("c", 3)
+
+	if _, ok := c.get("b"); ok {
+		t.Fatal("expected the least recently used entry to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Fatalf("expected %s to be cached", key)
+		}
+	}
+
+	want := CacheStats{Hits: 3, Misses: 1, Evictions: 1, Entries: 2}
+	if got := c.getStats(); got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestLRUCache_TTL(t *testing.T) {
+	c := newLRUCache(10*time.Millisecond, 10)
+	c.set("a", 1)
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.get("a"); ok {
+		t.Fatal("expected a to expire")
+	}
+
+	want := CacheStats{Hits: 1, Misses: 1, Entries: 0}
+	if got := c.getStats(); got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	// Updating an entry gives it a new ttl
+	c.set("b", 1)
+	time.Sleep(6 * time.Millisecond)
+	c.set("b", 2)
+	time.Sleep(6 * time.Millisecond)
+	if value, ok := c.get("b"); !ok || value != 2 {
+		t.Fatalf("expected the updated entry to be cached, got %v", value)
+	}
+}
+
+func TestCachedStorage_Invalidation(t *testing.T) {
+	writes := map[string]func(s Storage, blob string) error{
+		"SetBlob": func(s Storage, blob string) error {
+			return s.SetBlob("triggers", blob, []byte("v2"))
+		},
+		"SetBlobIfMatch": func(s Storage, blob string) error {
+			_, etag, err := s.GetBlobVersion("triggers", blob)
+			if err != nil {
+				return err
+			}
+			return s.SetBlobIfMatch("triggers", blob, []byte("v2"), etag)
+		},
+		"DeleteBlob": func(s Storage, blob string) error {
+			return s.DeleteBlob("triggers", blob)
+		},
+	}
+
+	for name, write := range writes {
+		t.Run(name, func(t *testing.T) {
+			m := NewMemoryStorage()
+			s := NewCachedStorage(m, time.Minute, 100)
+			if err := m.SetBlob("triggers", "u1/lunch", []byte("v1")); err != nil {
+				t.Fatal(err)
+			}
+
+			// Fill the cache
+			if _, err := s.GetBlob("triggers", "u1/lunch"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.ListContainer("triggers", "u1/"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := write(s, "u1/lunch"); err != nil {
+				t.Fatal(err)
+			}
+
+			wantData, wantErr := m.GetBlob("triggers", "u1/lunch")
+			data, err := s.GetBlob("triggers", "u1/lunch")
+			if string(wantData) != string(data) || IsNotFound(wantErr) != IsNotFound(err) {
+				t.Fatalf("expected %q (%v) after the write, got %q (%v)", wantData, wantErr, data, err)
+			}
+
+			wantNames, _ := m.ListContainer("triggers", "u1/")
+			names, err := s.ListContainer("triggers", "u1/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(wantNames, names) {
+				t.Fatalf("expected the listing %v after the write, got %v", wantNames, names)
+			}
+		})
+	}
+}
+
+func TestCachedStorage_Stats(t *testing.T) {
+	m := NewMemoryStorage()
+	s := NewCachedStorage(m, time.Minute, 100)
+	if err := m.SetBlob("triggers", "u1/lunch", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.GetBlob("triggers", "u1/lunch"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Missing blobs aren't cached
+	for i := 0; i < 2; i++ {
+		if _, err := s.GetBlob("triggers", "u1/missing"); !IsNotFound(err) {
+			t.Fatalf("expected a not found error, got %v", err)
+		}
+	}
+
+	want := CacheStats{Hits: 2, Misses: 3, Entries: 1}
+	if got := s.Stats(); got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestCachedStorage_StaleVersion(t *testing.T) {
+	// Two instances of the app share the storage, each with its own cache
+	m := NewMemoryStorage()
+	a := NewCachedStorage(m, time.Minute, 100)
+	b := NewCachedStorage(m, time.Minute, 100)
+
+	appendValue := func(s Storage, value string) error {
+		return updateBlob(s, "users", "u1", func(data []byte) ([]byte, error) {
+			return append(data, value...), nil
+		})
+	}
+
+	if err := appendValue(a, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetBlob("users", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendValue(a, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// b has a stale copy cached, the conflict must clear it so the retry succeeds
+	if err := appendValue(b, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := m.GetBlob("users", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "aab" {
+		t.Fatalf("expected every update to be kept, got %q", data)
+	}
+}
+
+func TestCachedSecrets(t *testing.T) {
+	secrets, err := NewEncryptedFileSecrets(t.TempDir(), newSecretsKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewCachedSecrets(secrets, time.Minute, 2)
+
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprintf("oauth-U%d", i)
+		if err := s.SetSecret(key, "xoxp-"+key, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := s.GetSecret(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	value, _, err := s.GetSecret("oauth-U2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "xoxp-oauth-U2" {
+		t.Fatalf("expected the cached secret, got %q", value)
+	}
+
+	// Saving a secret invalidates the cached copy
+	if err := s.SetSecret("oauth-U2", "xoxp-rotated", nil); err != nil {
+		t.Fatal(err)
+	}
+	value, _, err = s.GetSecret("oauth-U2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "xoxp-rotated" {
+		t.Fatalf("expected the updated secret, got %q", value)
+	}
+
+	want := CacheStats{Hits: 1, Misses: 4, Evictions: 1, Entries: 2}
+	if got := s.Stats(); got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,390 @@
+package slackoverload
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+// Command is a subcommand of /overload.
+type Command struct {
+	// Name of the subcommand, for example trigger in /overload trigger lunch.
+	Name string
+
+	// Alias is the standalone slash command that runs the same thing, for example /trigger.
+	Alias string
+
+	// Usage describes the arguments, for example NAME [for DURATION].
+	Usage string
+
+	// Description is a short sentence explaining what the command does.
+	Description string
+
+	// Run the command with the arguments in the payload text.
+	Run func(a *App, payload SlackPayload) (slack.Msg, error)
+}
+
+func (c Command) ToString() string {
+	usage := fmt.Sprintf("/overload %s", c.Name)
+	if c.Usage != "" {
+		usage = fmt.Sprintf("%s %s", usage, c.Usage)
+	}
+
+	alias := ""
+	if c.Alias != "" {
+		alias = fmt.Sprintf(" (or %s)", c.Alias)
+	}
+
+	return fmt.Sprintf("`%s`%s\n%s", usage, alias, c.Description)
+}
+
+// CommandRegistry finds the command to run for a subcommand of /overload.
+type CommandRegistry struct {
+	commands map[string]Command
+
+	// aliases maps each alias to the name of its command.
+	aliases map[string]string
+}
+
+func NewCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{
+		commands: make(map[string]Command),
+		aliases:  make(map[string]string),
+	}
+}
+
+// Register a command, panicking when the name or alias is already taken
+// since that is a programming error.
+func (r *CommandRegistry) Register(cmd Command) {
+	if _, ok := r.commands[cmd.Name]; ok {
+		panic(fmt.Sprintf("command %q is already registered", cmd.Name))
+	}
+	r.commands[cmd.Name] = cmd
+
+	if cmd.Alias != "" {
+		if _, ok := r.aliases[cmd.Alias]; ok {
+			panic(fmt.Sprintf("alias %q is already registered", cmd.Alias))
+		}
+		r.aliases[cmd.Alias] = cmd.Name
+	}
+}
+
+// Lookup a command by its subcommand name.
+func (r *CommandRegistry) Lookup(name string) (Command, bool) {
+	cmd, ok := r.commands[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// LookupAlias finds a command by its standalone slash command, such as /trigger.
+func (r *CommandRegistry) LookupAlias(alias string) (Command, bool) {
+	name, ok := r.aliases[alias]
+	if !ok {
+		return Command{}, false
+	}
+	return r.Lookup(name)
+}
+
+// Commands returns the registered commands sorted by name.
+func (r *CommandRegistry) Commands() []Command {
+	cmds := make([]Command, 0, len(r.commands))
+	for _, cmd := range r.commands {
+		cmds = append(cmds, cmd)
+	}
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Name < cmds[j].Name
+	})
+	return cmds
+}
+
+// Help describes how to use every registered command.
+func (r *CommandRegistry) Help() string {
+	var help []string
+	for _, cmd := range r.Commands() {
+		help = append(help, cmd.ToString())
+	}
+	return strings.Join(help, "\n\n")
+}
+
+// overloadCommands are the subcommands of /overload.
+var overloadCommands = NewCommandRegistry()
+
+func init() {
+	overloadCommands.Register(Command{
+		Name:        "trigger",
+		Alias:       "/trigger",
+		Usage:       "NAME [for DURATION | until END] [DND|NODND] [ARG]...",
+		Description: "Change your status using a saved trigger.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.Trigger(TriggerRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "create",
+		Alias:       "/create-trigger",
+		Usage:       "NAME = [STATUS TEXT] [(EMOJI)] [AWAY|ACTIVE] [DND|NODND] [for DURATION | until END] [then STEP]...",
+		Description: "Save a trigger for the current workspace.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.CreateTrigger(CreateTriggerRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "create-global",
+		Alias:       "/create-global-trigger",
+		Usage:       "NAME = [STATUS TEXT] [(EMOJI)] [AWAY|ACTIVE] [DND|NODND] [for DURATION | until END] [then STEP]...",
+		Description: "Save a trigger for every linked workspace.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.CreateTrigger(CreateTriggerRequest{SlackPayload: payload, Global: true})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "edit",
+		Usage:       "NAME",
+		Description: "Change a trigger using a form.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.EditTrigger(EditTriggerRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "override",
+		Alias:       "/override-trigger",
+		Usage:       "NAME [= [STATUS TEXT] [(EMOJI)] [DND|NODND] | SKIP]",
+		Description: "Change how a global trigger sets your status on the current workspace.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.OverrideTrigger(OverrideTriggerRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "delete",
+		Alias:       "/delete-trigger",
+		Usage:       "NAME",
+		Description: "Delete a trigger.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.DeleteTrigger(DeleteTriggerRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "list",
+		Alias:       "/list-triggers",
+		Description: "List the triggers for the current workspace.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.ListTriggers(ListTriggersRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "list-global",
+		Alias:       "/list-global-triggers",
+		Description: "List the triggers for every workspace.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.ListTriggers(ListTriggersRequest{SlackPayload: payload, Global: true})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "publish",
+		Alias:       "/publish-trigger",
+		Usage:       "NAME",
+		Description: "Share a trigger in the trigger library for the current workspace.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.PublishTrigger(PublishTriggerRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "unpublish",
+		Alias:       "/unpublish-trigger",
+		Usage:       "NAME",
+		Description: "Remove a trigger that you published from the trigger library.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.UnpublishTrigger(UnpublishTriggerRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "browse",
+		Alias:       "/browse-triggers",
+		Description: "List the triggers published for the current workspace.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.BrowseTriggers(BrowseTriggersRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "adopt",
+		Alias:       "/adopt-trigger",
+		Usage:       "NAME [as NEW-NAME]",
+		Description: "Copy a trigger from the trigger library into your triggers.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.AdoptTrigger(AdoptTriggerRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "export",
+		Alias:       "/export-triggers",
+		Description: "Download your triggers and schedules.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.ExportTriggers(ExportTriggersRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "import",
+		Alias:       "/import-triggers",
+		Description: "Import triggers and schedules from /export-triggers.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.ImportTriggers(ImportTriggersRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "clear",
+		Alias:       "/clear-status",
+		Description: "Clear your status and Do Not Disturb on the current workspace.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.ClearStatus(ClearStatusRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "clear-global",
+		Alias:       "/clear-global-status",
+		Description: "Clear your status and Do Not Disturb on every workspace.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.ClearStatus(ClearStatusRequest{SlackPayload: payload, Global: true})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "undo",
+		Alias:       "/undo-status",
+		Description: "Restore your status from before the last change.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.UndoStatus(UndoStatusRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "link",
+		Alias:       "/link-slack",
+		Description: "Link another Slack account to your account.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.LinkSlack(payload)
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "schedule",
+		Alias:       "/schedule-trigger",
+		Usage:       "NAME DAYS TIME [for DURATION | until END]",
+		Description: "Run a trigger automatically on certain days of the week.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.ScheduleTrigger(ScheduleTriggerRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "schedules",
+		Alias:       "/list-schedules",
+		Description: "List your scheduled triggers.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.ListSchedules(ListSchedulesRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "unschedule",
+		Alias:       "/delete-schedule",
+		Usage:       "ID",
+		Description: "Delete a scheduled trigger.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.DeleteSchedule(DeleteScheduleRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "settings",
+		Alias:       "/overload-settings",
+		Usage:       "[tz|hours|dnd|duration VALUE]",
+		Description: "Show or change your settings.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.OverloadSettings(OverloadSettingsRequest{SlackPayload: payload})
+		},
+	})
+	overloadCommands.Register(Command{
+		Name:        "help",
+		Usage:       "[COMMAND]",
+		Description: "Explain how to use the commands.",
+		Run: func(a *App, payload SlackPayload) (slack.Msg, error) {
+			return a.Help(HelpRequest{SlackPayload: payload})
+		},
+	})
+}
+
+type OverloadRequest struct {
+	SlackPayload
+}
+
+type HelpRequest struct {
+	SlackPayload
+}
+
+// Overload runs a subcommand of /overload
+// Example:
+// trigger lunch for 1h
+// command = trigger
+// arguments = lunch for 1h
+func (a *App) Overload(r OverloadRequest) (slack.Msg, error) {
+	name, args := splitCommand(r.Text)
+	if name == "" {
+		return a.Help(HelpRequest{SlackPayload: r.SlackPayload})
+	}
+
+	cmd, ok := overloadCommands.Lookup(name)
+	if !ok {
+		return slack.Msg{}, errors.Errorf("Unknown command %q. Here's what I can do:\n\n%s", name, overloadCommands.Help())
+	}
+
+	payload := r.SlackPayload
+	payload.Text = args
+	return cmd.Run(a, payload)
+}
+
+// RunSlashCommand runs /overload or one of its aliases, such as /trigger.
+func (a *App) RunSlashCommand(command string, payload SlackPayload) (slack.Msg, error) {
+	if command == "/overload" {
+		return a.Overload(OverloadRequest{SlackPayload: payload})
+	}
+
+	cmd, ok := overloadCommands.LookupAlias(command)
+	if !ok {
+		return slack.Msg{}, errors.Errorf("Unknown command %s. Try /overload help", command)
+	}
+	return cmd.Run(a, payload)
+}
+
+// Help explains how to use every command, or a single command.
+func (a *App) Help(r HelpRequest) (slack.Msg, error) {
+	help := overloadCommands.Help()
+	if name := strings.TrimSpace(r.Text); name != "" {
+		cmd, ok := overloadCommands.Lookup(name)
+		if !ok {
+			return slack.Msg{}, errors.Errorf("Unknown command %q. Here's what I can do:\n\n%s", name, help)
+		}
+		help = cmd.ToString()
+	}
+
+	msg := slack.Msg{
+		Type: slack.ResponseTypeEphemeral,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.SectionBlock{
+				Type: slack.MBTSection,
+				Text: &slack.TextBlockObject{
+					Type: slack.MarkdownType,
+					Text: help,
+				},
+			},
+		}},
+	}
+	return msg, nil
+}
+
+// splitCommand separates the subcommand from its arguments, keeping the
+// arguments exactly as they were typed.
+func splitCommand(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	i := strings.IndexFunc(text, unicode.IsSpace)
+	if i < 0 {
+		return text, ""
+	}
+	return text[:i], strings.TrimSpace(text[i:])
+}
@@ -0,0 +1,141 @@
+package slackoverload
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+func TestCommandRegistry(t *testing.T) {
+	var ran []string
+	record := func(name string) func(a *App, payload SlackPayload) (slack.Msg, error) {
+		return func(a *App, payload SlackPayload) (slack.Msg, error) {
+			ran = append(ran, name+":"+payload.Text)
+			return slack.Msg{}, nil
+		}
+	}
+
+	r := NewCommandRegistry()
+	r.Register(Command{Name: "trigger", Alias: "/trigger", Run: record("trigger")})
+	r.Register(Command{Name: "edit", Run: record("edit")})
+
+	cmd, ok := r.Lookup("TRIGGER")
+	if !ok || cmd.Name != "trigger" {
+		t.Fatalf("expected to find the trigger command, got %#v", cmd)
+	}
+	cmd, ok = r.LookupAlias("/trigger")
+	if !ok || cmd.Name != "trigger" {
+		t.Fatalf("expected to find the trigger command by its alias, got %#v", cmd)
+	}
+	if _, ok := r.LookupAlias("/edit"); ok {
+		t.Fatal("expected a command without an alias to only be found by name")
+	}
+	if _, ok := r.Lookup("missing"); ok {
+		t.Fatal("expected an unknown command to not be found")
+	}
+
+	cmd.Run(nil, SlackPayload{Text: "lunch"})
+	if !reflect.DeepEqual([]string{"trigger:lunch"}, ran) {
+		t.Fatalf("expected the trigger command to run, got %v", ran)
+	}
+
+	var names []string
+	for _, cmd := range r.Commands() {
+		names = append(names, cmd.Name)
+	}
+	if !reflect.DeepEqual([]string{"edit", "trigger"}, names) {
+		t.Fatalf("expected the commands sorted by name, got %v", names)
+	}
+
+	for _, dup := range []Command{{Name: "trigger"}, {Name: "run", Alias: "/trigger"}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected registering %#v again to panic", dup)
+				}
+			}()
+			r.Register(dup)
+		}()
+	}
+}
+
+func TestOverloadCommands_Routing(t *testing.T) {
+	a := &App{Storage: NewMemoryStorage()}
+
+	for _, cmd := range overloadCommands.Commands() {
+		t.Run(cmd.Name, func(t *testing.T) {
+			payload := SlackPayload{SlackId: "U1", TeamId: "T1", Text: "lunch"}
+			if cmd.Name == "help" {
+				payload.Text = ""
+			}
+
+			// /overload NAME ARGS should do the same thing as the command's own slash command
+			overload := payload
+			overload.Text = strings.TrimSpace(cmd.Name + " " + payload.Text)
+			want, wantErr := a.Overload(OverloadRequest{overload})
+			if wantErr != nil && strings.Contains(wantErr.Error(), "Unknown command") {
+				t.Fatalf("/overload %s was not routed: %v", cmd.Name, wantErr)
+			}
+
+			if cmd.Alias == "" {
+				return
+			}
+			got, gotErr := a.RunSlashCommand(cmd.Alias, payload)
+			if fmt.Sprint(wantErr) != fmt.Sprint(gotErr) {
+				t.Fatalf("expected %s to fail the same as /overload %s, got %v and %v", cmd.Alias, cmd.Name, gotErr, wantErr)
+			}
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("expected %s to respond the same as /overload %s\nwant: %#v\ngot:  %#v", cmd.Alias, cmd.Name, want, got)
+			}
+		})
+	}
+
+	_, err := a.Overload(OverloadRequest{SlackPayload{Text: "bogus lunch"}})
+	if err == nil || !strings.Contains(err.Error(), `Unknown command "bogus"`) {
+		t.Fatalf("expected an unknown command error, got %v", err)
+	}
+	_, err = a.RunSlashCommand("/bogus", SlackPayload{})
+	if err == nil || !strings.Contains(err.Error(), "Unknown command /bogus") {
+		t.Fatalf("expected an unknown command error, got %v", err)
+	}
+}
+
+func TestOverloadCommands_Help(t *testing.T) {
+	help := overloadCommands.Help()
+	for _, cmd := range overloadCommands.Commands() {
+		if !strings.Contains(help, "`/overload "+cmd.Name) {
+			t.Errorf("expected the help to include /overload %s", cmd.Name)
+		}
+		if cmd.Alias != "" && !strings.Contains(help, "(or "+cmd.Alias+")") {
+			t.Errorf("expected the help to include %s", cmd.Alias)
+		}
+		if cmd.Description == "" {
+			t.Errorf("expected %s to have a description", cmd.Name)
+		}
+	}
+
+	// Slack rejects a section with more than 3000 characters
+	if len(help) > 3000 {
+		t.Errorf("the help is %d characters, which is too long for a single section", len(help))
+	}
+
+	a := &App{}
+	msg, err := a.Help(HelpRequest{SlackPayload{Text: "trigger"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, _ := overloadCommands.Lookup("trigger")
+	if text := msg.Blocks.BlockSet[0].(slack.SectionBlock).Text.Text; text != cmd.ToString() {
+		t.Fatalf("expected the help for the trigger command, got %q", text)
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	name, args := splitCommand("  create  lunch =  \"a  b\" ")
+	if name != "create" || args != `lunch =  "a  b"` {
+		t.Fatalf("expected the arguments exactly as typed, got %q %q", name, args)
+	}
+}
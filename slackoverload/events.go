@@ -0,0 +1,248 @@
+package slackoverload
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The version of the slack library that we use doesn't include the Events
+// API, so these types fill in what is missing.
+// https://api.slack.com/events-api
+
+const (
+	EventTypeURLVerification = "url_verification"
+	EventTypeEventCallback   = "event_callback"
+
+	EventTypeAppHomeOpened  = "app_home_opened"
+	EventTypeAppUninstalled = "app_uninstalled"
+	EventTypeTokensRevoked  = "tokens_revoked"
+	EventTypeFileShared     = "file_shared"
+)
+
+const (
+	// DefaultEventWorkers is how many events are handled at the same time.
+	DefaultEventWorkers = 4
+
+	// eventQueueSize is how many events can wait for a worker before we ask
+	// Slack to send them again later.
+	eventQueueSize = 100
+
+	// eventDedupeTTL is how long to remember an event, Slack retries a
+	// failed event three times over about an hour.
+	eventDedupeTTL = 2 * time.Hour
+
+	// eventDedupeSize is how many events are remembered.
+	eventDedupeSize = 10000
+)
+
+// EventEnvelope wraps every request sent to the events endpoint.
+type EventEnvelope struct {
+	Type      string `json:"type"`
+	TeamId    string `json:"team_id"`
+	EventId   string `json:"event_id"`
+	EventTime int64  `json:"event_time"`
+
+	// Challenge is sent when Slack verifies the events endpoint.
+	Challenge string `json:"challenge"`
+
+	// Event is unmarshaled once we know its type.
+	Event json.RawMessage `json:"event"`
+}
+
+// InnerEvent holds the fields shared by every event.
+type InnerEvent struct {
+	Type string `json:"type"`
+}
+
+// Event is a single event delivered by the Events API.
+type Event struct {
+	Id     string
+	Type   string
+	TeamId string
+
+	// Data is the event, use Decode to read it as the type for the event.
+	Data json.RawMessage
+}
+
+// NewEvent reads the event out of its envelope.
+func NewEvent(envelope EventEnvelope) (Event, error) {
+	var inner InnerEvent
+	err := json.Unmarshal(envelope.Event, &inner)
+	if err != nil {
+		return Event{}, errors.Wrapf(err, "could not unmarshal event %s", envelope.EventId)
+	}
+
+	return Event{
+		Id:     envelope.EventId,
+		Type:   inner.Type,
+		TeamId: envelope.TeamId,
+		Data:   envelope.Event,
+	}, nil
+}
+
+// Decode the event into the struct for its type, such as AppHomeOpenedEvent.
+func (e Event) Decode(v interface{}) error {
+	err := json.Unmarshal(e.Data, v)
+	return errors.Wrapf(err, "could not unmarshal %s event %s", e.Type, e.Id)
+}
+
+// AppHomeOpenedEvent is sent when a user opens one of the tabs of our App Home.
+type AppHomeOpenedEvent struct {
+	Type    string `json:"type"`
+	User    string `json:"user"`
+	Channel string `json:"channel"`
+	Tab     string `json:"tab"`
+}
+
+// AppUninstalledEvent is sent when the app is removed from a workspace.
+type AppUninstalledEvent struct {
+	Type string `json:"type"`
+}
+
+// TokensRevokedEvent is sent when tokens for the workspace are revoked.
+type TokensRevokedEvent struct {
+	Type   string `json:"type"`
+	Tokens struct {
+		// OAuth are the ids of the users whose tokens were revoked.
+		OAuth []string `json:"oauth"`
+
+		// Bot are the ids of the bot users whose tokens were revoked.
+		Bot []string `json:"bot"`
+	} `json:"tokens"`
+}
+
+// EventHandler runs an event of the type that it was registered for.
+type EventHandler func(a *App, e Event) error
+
+// EventRegistry finds the handler for each type of event.
+type EventRegistry struct {
+	handlers map[string]EventHandler
+}
+
+func NewEventRegistry() *EventRegistry {
+	return &EventRegistry{handlers: make(map[string]EventHandler)}
+}
+
+// Register the handler for a type of event, panicking when the type already
+// has a handler since that is a programming error.
+func (r *EventRegistry) Register(eventType string, handler EventHandler) {
+	if _, ok := r.handlers[eventType]; ok {
+		panic(fmt.Sprintf("a handler for event %q is already registered", eventType))
+	}
+	r.handlers[eventType] = handler
+}
+
+// Lookup the handler for a type of event.
+func (r *EventRegistry) Lookup(eventType string) (EventHandler, bool) {
+	handler, ok := r.handlers[eventType]
+	return handler, ok
+}
+
+// eventHandlers are the events that we subscribe to.
+var eventHandlers = NewEventRegistry()
+
+func init() {
+	eventHandlers.Register(EventTypeAppUninstalled, func(a *App, e Event) error {
+		return a.AppUninstalled(e.TeamId)
+	})
+	eventHandlers.Register(EventTypeTokensRevoked, func(a *App, e Event) error {
+		var revoked TokensRevokedEvent
+		err := e.Decode(&revoked)
+		if err != nil {
+			return err
+		}
+		return a.TokensRevoked(e.TeamId, revoked)
+	})
+	eventHandlers.Register(EventTypeAppHomeOpened, func(a *App, e Event) error {
+		var opened AppHomeOpenedEvent
+		err := e.Decode(&opened)
+		if err != nil {
+			return err
+		}
+		if opened.Tab != "home" {
+			return nil
+		}
+		return a.PublishHome(opened.User, e.TeamId)
+	})
+	eventHandlers.Register(EventTypeFileShared, func(a *App, e Event) error {
+		var shared FileSharedEvent
+		err := e.Decode(&shared)
+		if err != nil {
+			return err
+		}
+		return a.ImportSharedFile(e.TeamId, shared)
+	})
+}
+
+// EventDispatcher hands events to a pool of workers, so that they can be
+// acknowledged right away, and drops events that Slack sends again because
+// we were too slow to acknowledge them the first time.
+type EventDispatcher struct {
+	app      *App
+	registry *EventRegistry
+	queue    chan Event
+	seen     *lruCache
+
+	// mu protects checking and recording the events that we have seen.
+	mu sync.Mutex
+}
+
+// NewEventDispatcher starts the workers that run the events.
+func NewEventDispatcher(app *App, registry *EventRegistry, workers int) *EventDispatcher {
+	if workers <= 0 {
+		workers = DefaultEventWorkers
+	}
+
+	d := &EventDispatcher{
+		app:      app,
+		registry: registry,
+		queue:    make(chan Event, eventQueueSize),
+		seen:     newLRUCache(eventDedupeTTL, eventDedupeSize),
+	}
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+// Dispatch queues an event to be run. Retries of an event that was already
+// queued are ignored. An error is returned when the queue is full, so that
+// Slack will send the event again later.
+func (d *EventDispatcher) Dispatch(e Event, retryNum int) error {
+	d.mu.Lock()
+	if _, ok := d.seen.get(e.Id); ok && retryNum > 0 {
+		d.mu.Unlock()
+		fmt.Printf("%s ignoring retry %d of %s event %s\n", now(), retryNum, e.Type, e.Id)
+		return nil
+	}
+	d.seen.set(e.Id, true)
+	d.mu.Unlock()
+
+	select {
+	case d.queue <- e:
+		return nil
+	default:
+		// Forget the event so that the retry is handled
+		d.seen.remove(e.Id)
+		return errors.Errorf("too many events are waiting, could not queue %s event %s", e.Type, e.Id)
+	}
+}
+
+func (d *EventDispatcher) work() {
+	for e := range d.queue {
+		handler, ok := d.registry.Lookup(e.Type)
+		if !ok {
+			fmt.Printf("%s ignoring %s event %s\n", now(), e.Type, e.Id)
+			continue
+		}
+
+		err := handler(d.app, e)
+		if err != nil {
+			fmt.Printf("%s error handling %s event %s: %v\n", now(), e.Type, e.Id, err)
+		}
+	}
+}
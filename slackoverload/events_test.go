@@ -0,0 +1,171 @@
+package slackoverload
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestDispatcher builds a dispatcher without any workers, so that the
+// test decides when queued events are run.
+func newTestDispatcher(registry *EventRegistry, queueSize int) *EventDispatcher {
+	return &EventDispatcher{
+		app:      &App{},
+		registry: registry,
+		queue:    make(chan Event, queueSize),
+		seen:     newLRUCache(eventDedupeTTL, eventDedupeSize),
+	}
+}
+
+func newTestEvent(t *testing.T, id string, eventType string) Event {
+	e, err := NewEvent(EventEnvelope{
+		Type:    EventTypeEventCallback,
+		EventId: id,
+		TeamId:  "T1",
+		Event:   json.RawMessage(fmt.Sprintf(`{"type":%q}`, eventType)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// recordEvents registers a handler that sends the id of each event that it handles.
+func recordEvents(registry *EventRegistry, eventType string) <-chan string {
+	handled := make(chan string, 10)
+	registry.Register(eventType, func(a *App, e Event) error {
+		handled <- e.Id
+		return nil
+	})
+	return handled
+}
+
+func waitForEvents(t *testing.T, handled <-chan string, count int) []string {
+	var ids []string
+	for len(ids) < count {
+		select {
+		case id := <-handled:
+			ids = append(ids, id)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for events, only got %v", ids)
+		}
+	}
+	return ids
+}
+
+func TestEventDispatcher_Retries(t *testing.T) {
+	registry := NewEventRegistry()
+	handled := recordEvents(registry, EventTypeAppHomeOpened)
+	d := newTestDispatcher(registry, 10)
+
+	e := newTestEvent(t, "E1", EventTypeAppHomeOpened)
+	for retryNum := 0; retryNum < 3; retryNum++ {
+		if err := d.Dispatch(e, retryNum); err != nil {
+			t.Fatalf("retry %d: %v", retryNum, err)
+		}
+	}
+
+	// A retry of an event that we haven't seen, such as after a restart, is handled
+	if err := d.Dispatch(newTestEvent(t, "E2", EventTypeAppHomeOpened), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	go d.work()
+	defer close(d.queue)
+
+	got := waitForEvents(t, handled, 2)
+	if !reflect.DeepEqual([]string{"E1", "E2"}, got) {
+		t.Fatalf("expected each event to be handled once, got %v", got)
+	}
+	select {
+	case id := <-handled:
+		t.Fatalf("expected the retries to be ignored, but %s was handled again", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestEventDispatcher_UnregisteredEvent(t *testing.T) {
+	registry := NewEventRegistry()
+	handled := recordEvents(registry, EventTypeAppHomeOpened)
+	d := newTestDispatcher(registry, 10)
+
+	// The worker runs the events in order, so the unregistered event is
+	// skipped by the time the next one is handled
+	for _, e := range []Event{
+		newTestEvent(t, "E1", "reaction_added"),
+		newTestEvent(t, "E2", EventTypeAppHomeOpened),
+	} {
+		if err := d.Dispatch(e, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	go d.work()
+	defer close(d.queue)
+
+	got := waitForEvents(t, handled, 1)
+	if !reflect.DeepEqual([]string{"E2"}, got) {
+		t.Fatalf("expected only the registered event to be handled, got %v", got)
+	}
+}
+
+func TestHandleEvents_QueueFull(t *testing.T) {
+	registry := NewEventRegistry()
+	handled := recordEvents(registry, EventTypeAppHomeOpened)
+	h := &SlackHandler{signingSecret: "shhh", events: newTestDispatcher(registry, 1)}
+
+	post := func(eventId string, retryNum int) int {
+		body, _ := json.Marshal(EventEnvelope{
+			Type:    EventTypeEventCallback,
+			EventId: eventId,
+			TeamId:  "T1",
+			Event:   json.RawMessage(`{"type":"app_home_opened"}`),
+		})
+
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(h.signingSecret))
+		fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+
+		request := httptest.NewRequest(http.MethodPost, "/events", bytes.NewReader(body))
+		request.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		request.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+		if retryNum > 0 {
+			request.Header.Set("X-Slack-Retry-Num", strconv.Itoa(retryNum))
+		}
+
+		response := httptest.NewRecorder()
+		h.HandleEvents(response, request)
+		return response.Code
+	}
+
+	if code := post("E1", 0); code != http.StatusOK {
+		t.Fatalf("expected the first event to be queued, got %d", code)
+	}
+	if code := post("E2", 0); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected a full queue to ask Slack to try again later, got %d", code)
+	}
+	if code := post("E1", 1); code != http.StatusOK {
+		t.Fatalf("expected a retry of a queued event to be acknowledged, got %d", code)
+	}
+
+	go h.events.work()
+	defer close(h.events.queue)
+	waitForEvents(t, handled, 1)
+
+	// The event that didn't fit is handled when Slack sends it again
+	if code := post("E2", 1); code != http.StatusOK {
+		t.Fatalf("expected the retry to be queued, got %d", code)
+	}
+	if got := waitForEvents(t, handled, 1); got[0] != "E2" {
+		t.Fatalf("expected the retried event to be handled, got %v", got)
+	}
+}
@@ -0,0 +1,734 @@
+package slackoverload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// TriggerDocumentVersion is the version of the document written by /export-triggers.
+	TriggerDocumentVersion = 1
+
+	// ImportMerge adds the triggers in a document to the existing ones,
+	// skipping triggers with the same name as an existing trigger.
+	ImportMerge = "merge"
+
+	// ImportReplace removes the triggers and schedules that aren't in the document.
+	ImportReplace = "replace"
+
+	// FormatJSON and FormatYAML are the formats that documents can be exported as.
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+const (
+	// importTriggersCallbackId identifies submissions of the import modal.
+	importTriggersCallbackId = "import-triggers"
+
+	// Block ids of the fields in the import modal.
+	importTriggersDocument = "document"
+	importTriggersMode     = "mode"
+
+	// maxPastedDocumentLength is the most that Slack allows in a text input,
+	// larger documents must be uploaded.
+	maxPastedDocumentLength = 3000
+
+	// maxImportDocumentSize is the largest document that is accepted in bytes.
+	maxImportDocumentSize = 1 << 20
+
+	// transferLinkMaxAge is how long an export or upload link works, in seconds.
+	transferLinkMaxAge = 15 * 60
+
+	// Names that the export and upload links are signed with, so that a
+	// download link can't be used to upload.
+	transferExport = "export"
+	transferImport = "import"
+)
+
+// TriggerDocument holds all of a user's triggers and schedules, so that they
+// can be backed up, edited and imported again. It is written as either JSON
+// or YAML, using the json field names for both.
+type TriggerDocument struct {
+	Version   int                `json:"version"`
+	Triggers  []ActionTemplate   `json:"triggers"`
+	Schedules []ExportedSchedule `json:"schedules"`
+}
+
+// ExportedSchedule is a schedule without the fields that are assigned when it
+// is saved.
+type ExportedSchedule struct {
+	Trigger  string         `json:"trigger"`
+	Days     []time.Weekday `json:"days"`
+	Hour     int            `json:"hour"`
+	Minute   int            `json:"minute"`
+	Duration string         `json:"duration,omitempty"`
+	Until    string         `json:"until,omitempty"`
+	TimeZone string         `json:"tz,omitempty"`
+}
+
+func (s ExportedSchedule) Schedule() Schedule {
+	return Schedule{
+		Trigger:  s.Trigger,
+		Days:     s.Days,
+		Hour:     s.Hour,
+		Minute:   s.Minute,
+		Duration: s.Duration,
+		Until:    s.Until,
+		TimeZone: s.TimeZone,
+	}
+}
+
+// parseTriggerDocument reads an exported document, written as JSON or YAML.
+func parseTriggerDocument(data []byte) (TriggerDocument, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return TriggerDocument{}, errors.New("The document is empty")
+	}
+
+	if data[0] != '{' {
+		// Convert YAML to JSON, so that both use the json field names
+		var value interface{}
+		err := yaml.Unmarshal(data, &value)
+		if err != nil {
+			return TriggerDocument{}, errors.Errorf("The document is not valid JSON or YAML: %s", err)
+		}
+		data, err = json.Marshal(yamlToJSON(value))
+		if err != nil {
+			return TriggerDocument{}, errors.Errorf("The document is not valid YAML: %s", err)
+		}
+	}
+
+	var doc TriggerDocument
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return TriggerDocument{}, errors.Errorf("The document is not a valid trigger document: %s", err)
+	}
+
+	if doc.Version != TriggerDocumentVersion {
+		return TriggerDocument{}, errors.Errorf("Unsupported document version %d, only version %d is supported", doc.Version, TriggerDocumentVersion)
+	}
+
+	return doc, nil
+}
+
+// yamlToJSON converts the maps from YAML, which can have keys of any type,
+// to maps with string keys that can be written as JSON.
+func yamlToJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = yamlToJSON(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = yamlToJSON(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// marshalTriggerDocument writes a document as JSON or YAML.
+func marshalTriggerDocument(doc TriggerDocument, format string) ([]byte, error) {
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil || format != FormatYAML {
+		return b, errors.Wrap(err, "error marshaling trigger document")
+	}
+
+	// Go through JSON so that YAML uses the same field names, in the same order
+	var ordered yaml.MapSlice
+	err = yaml.Unmarshal(b, &ordered)
+	if err != nil {
+		return nil, errors.Wrap(err, "error converting trigger document to YAML")
+	}
+	b, err = yaml.Marshal(ordered)
+	return b, errors.Wrap(err, "error marshaling trigger document as YAML")
+}
+
+// ImportResult describes what was imported.
+type ImportResult struct {
+	Triggers  int
+	Schedules int
+
+	// Skipped explains why each entry that wasn't imported was skipped.
+	Skipped []string
+}
+
+func (r ImportResult) ToString() string {
+	text := fmt.Sprintf("Imported %d triggers and %d schedules.", r.Triggers, r.Schedules)
+	if len(r.Skipped) == 0 {
+		return text
+	}
+
+	text += fmt.Sprintf(" Skipped %d entries:", len(r.Skipped))
+	for _, skipped := range r.Skipped {
+		text += "\n• " + skipped
+	}
+	return text
+}
+
+type ExportTriggersRequest struct {
+	SlackPayload
+}
+
+type ImportTriggersRequest struct {
+	SlackPayload
+}
+
+// transferToken is signed into the export and upload links, so that they
+// work without logging in.
+type transferToken struct {
+	UserId  string
+	SlackId string
+	TeamId  string
+}
+
+// ExportTriggers replies with a link to download the user's triggers and schedules.
+func (a *App) ExportTriggers(r ExportTriggersRequest) (slack.Msg, error) {
+	fmt.Printf("%s /export-triggers from %s(%s) on %s(%s)\n",
+		now(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+
+	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
+	if err != nil {
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
+	}
+
+	link, err := a.transferLink(transferExport, transferToken{UserId: userId, SlackId: r.SlackId, TeamId: r.TeamId})
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	msg := slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			markdownSection(fmt.Sprintf("Download your triggers and schedules as <%s|JSON> or <%s&format=%s|YAML>. The links expire in %d minutes.",
+				link, link, FormatYAML, transferLinkMaxAge/60)),
+		}},
+	}
+	return msg, nil
+}
+
+// exportTriggers builds a document with all of the user's triggers and schedules.
+func (a *App) exportTriggers(userId string) (TriggerDocument, error) {
+	triggers, err := a.getAllTriggers(userId)
+	if err != nil {
+		return TriggerDocument{}, err
+	}
+
+	schedules, err := a.getSchedules(userId + "/")
+	if err != nil {
+		return TriggerDocument{}, err
+	}
+
+	doc := TriggerDocument{
+		Version:   TriggerDocumentVersion,
+		Triggers:  triggers,
+		Schedules: make([]ExportedSchedule, 0, len(schedules)),
+	}
+	for _, s := range schedules {
+		doc.Schedules = append(doc.Schedules, ExportedSchedule{
+			Trigger:  s.Trigger,
+			Days:     s.Days,
+			Hour:     s.Hour,
+			Minute:   s.Minute,
+			Duration: s.Duration,
+			Until:    s.Until,
+			TimeZone: s.TimeZone,
+		})
+	}
+	return doc, nil
+}
+
+// ImportTriggers opens a modal to paste a document from /export-triggers,
+// with a link to upload it instead.
+func (a *App) ImportTriggers(r ImportTriggersRequest) (slack.Msg, error) {
+	fmt.Printf("%s /import-triggers from %s(%s) on %s(%s)\n",
+		now(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+
+	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
+	if err != nil {
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
+	}
+
+	link, err := a.transferLink(transferImport, transferToken{UserId: userId, SlackId: r.SlackId, TeamId: r.TeamId})
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	token, err := a.getSlackToken(r.SlackId)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	err = openView(token.AccessToken, r.TriggerId, buildImportTriggers(link))
+	return slack.Msg{}, errors.Wrap(err, "could not open the import form")
+}
+
+func buildImportTriggers(uploadLink string) View {
+	document := textInput(importTriggersDocument, "Triggers", "", `{"version": 1, "triggers": [...]}`, false, maxPastedDocumentLength, "")
+	element := document.Element.(PlainTextInputElement)
+	element.Multiline = true
+	document.Element = element
+
+	return View{
+		Type:       ViewTypeModal,
+		CallbackID: importTriggersCallbackId,
+		Title:      plainText("Import Triggers"),
+		Submit:     plainText("Import"),
+		Close:      plainText("Cancel"),
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			markdownSection(fmt.Sprintf("Paste the file from /export-triggers. Larger files can be <%s|uploaded>, "+
+				"or shared in a direct message with Slack Overload.", uploadLink)),
+			document,
+			selectInput(importTriggersMode, "Existing Triggers", selectOption("Keep", ImportMerge),
+				selectOption("Keep", ImportMerge),
+				selectOption("Replace", ImportReplace)),
+		}},
+	}
+}
+
+// SubmitImportTriggers imports the pasted document, replacing the modal with
+// what was imported.
+func (a *App) SubmitImportTriggers(p InteractionPayload) (*ViewSubmissionResponse, error) {
+	fmt.Printf("%s import triggers submitted by %s(%s) on %s(%s)\n",
+		now(), p.User.Name, p.User.ID, p.Team.Domain, p.Team.ID)
+
+	userId, err := a.lookupUserIdFromSlackId(p.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parseTriggerDocument([]byte(p.View.State.Get(importTriggersDocument, triggerEditorActionId)))
+	if err != nil {
+		return NewViewErrors(map[string]string{importTriggersDocument: err.Error()}), nil
+	}
+
+	mode := p.View.State.Get(importTriggersMode, triggerEditorActionId)
+	if err := checkImportMode(doc, mode); err != nil {
+		return NewViewErrors(map[string]string{importTriggersDocument: err.Error()}), nil
+	}
+	result, err := a.importTriggers(transferToken{UserId: userId, SlackId: p.User.ID, TeamId: p.Team.ID}, doc, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	view := View{
+		Type:  ViewTypeModal,
+		Title: plainText("Import Triggers"),
+		Close: plainText("Done"),
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			markdownSection(result.ToString()),
+		}},
+	}
+	return NewViewUpdate(view), nil
+}
+
+// importTriggers saves the valid triggers and schedules in a document, and
+// skips the rest. Nothing is changed when every entry is skipped.
+func (a *App) importTriggers(t transferToken, doc TriggerDocument, mode string) (ImportResult, error) {
+	if mode != ImportReplace {
+		mode = ImportMerge
+	}
+	fmt.Printf("%s importing %d triggers and %d schedules for %s mode=%s\n",
+		now(), len(doc.Triggers), len(doc.Schedules), t.UserId, mode)
+
+	err := checkImportMode(doc, mode)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	user, err := a.getCurrentUser(t.UserId)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	existingTriggers, err := a.getAllTriggers(t.UserId)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	existingSchedules, err := a.getSchedules(t.UserId + "/")
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	// Workspace triggers stay on their workspace when it is linked, otherwise
+	// they move to the workspace that they are imported from
+	linkedTeams := make(map[string]bool)
+	for _, su := range user.SlackUsers {
+		linkedTeams[su.TeamID] = true
+	}
+
+	existingNames := make(map[string]bool)
+	for _, existing := range existingTriggers {
+		existingNames[existing.Name] = true
+	}
+
+	var result ImportResult
+	var triggers []ActionTemplate
+	names := make(map[string]bool)
+	for i, imported := range doc.Triggers {
+		label := fmt.Sprintf("trigger %d", i+1)
+		if imported.Name != "" {
+			label = fmt.Sprintf("trigger %s", imported.Name)
+		}
+
+		tmpl, err := validateImportedTrigger(imported)
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %s", label, err))
+			continue
+		}
+		if names[tmpl.Name] {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: it is in the document more than once", label))
+			continue
+		}
+		names[tmpl.Name] = true
+
+		if mode == ImportMerge && existingNames[tmpl.Name] {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: you already have a trigger named %s", label, tmpl.Name))
+			continue
+		}
+
+		if !tmpl.Global && !linkedTeams[tmpl.TeamId] {
+			tmpl.TeamId = t.TeamId
+		}
+		triggers = append(triggers, tmpl)
+	}
+
+	if mode == ImportMerge {
+		for name := range existingNames {
+			names[name] = true
+		}
+	}
+
+	// Check the steps once every trigger is known, since they can run each other
+	lookup := func(name string) (ActionTemplate, error) {
+		for _, tmpl := range triggers {
+			if tmpl.Name == name {
+				return tmpl, nil
+			}
+		}
+		if mode == ImportMerge {
+			return a.getTrigger(t.UserId, name)
+		}
+		return ActionTemplate{}, TriggerNotFoundError{Name: name}
+	}
+	valid := triggers[:0]
+	for _, tmpl := range triggers {
+		_, err := expandTriggerSteps(tmpl, lookup)
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("trigger %s: %s", tmpl.Name, err))
+			delete(names, tmpl.Name)
+			continue
+		}
+		valid = append(valid, tmpl)
+	}
+	triggers = valid
+
+	var schedules []Schedule
+	for i, imported := range doc.Schedules {
+		label := fmt.Sprintf("schedule %d", i+1)
+		schedule, err := validateImportedSchedule(imported.Schedule())
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %s", label, err))
+			continue
+		}
+		label = fmt.Sprintf("schedule %s", schedule.ToString())
+
+		if !names[schedule.Trigger] {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: trigger %s is not defined", label, schedule.Trigger))
+			continue
+		}
+
+		if _, err := time.LoadLocation(schedule.TimeZone); schedule.TimeZone == "" || err != nil {
+			schedule.TimeZone = a.userLocation(user, t.SlackId).String()
+		}
+
+		if mode == ImportMerge && containsSchedule(existingSchedules, schedule) {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: it is already scheduled", label))
+			continue
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	if len(triggers) == 0 && len(schedules) == 0 && len(result.Skipped) > 0 {
+		return result, nil
+	}
+
+	for _, tmpl := range triggers {
+		tmpl := tmpl
+		if mode == ImportMerge {
+			// Keep a trigger that was created since we listed them
+			err = a.createTrigger(t.UserId, tmpl)
+			if IsConflict(err) {
+				result.Skipped = append(result.Skipped, fmt.Sprintf("trigger %s: you already have a trigger named %s", tmpl.Name, tmpl.Name))
+				continue
+			}
+		} else {
+			err = a.updateTrigger(t.UserId, tmpl.Name, func(existing *ActionTemplate) error {
+				*existing = tmpl
+				return nil
+			})
+		}
+		if err != nil {
+			return result, errors.Wrapf(err, "error saving trigger %s for %s", tmpl.Name, t.UserId)
+		}
+		result.Triggers++
+	}
+
+	if mode == ImportReplace {
+		// Remove what was there before only after the new triggers are saved
+		for _, existing := range existingTriggers {
+			if names[existing.Name] {
+				continue
+			}
+			err = a.Storage.DeleteBlob("triggers", path.Join(t.UserId, existing.Name))
+			if err != nil && !IsNotFound(err) {
+				return result, errors.Wrapf(err, "error removing trigger %s for %s", existing.Name, t.UserId)
+			}
+		}
+		for _, existing := range existingSchedules {
+			err = a.Storage.DeleteBlob("schedules", path.Join(t.UserId, existing.Id))
+			if err != nil && !IsNotFound(err) {
+				return result, errors.Wrapf(err, "error removing schedule %s for %s", existing.Id, t.UserId)
+			}
+		}
+	}
+
+	for _, schedule := range schedules {
+		schedule.Id, err = newScheduleId()
+		if err != nil {
+			return result, err
+		}
+		schedule.UserId = t.UserId
+		schedule.NextRun = schedule.Next(time.Now())
+
+		err = a.setSchedule(schedule)
+		if err != nil {
+			return result, err
+		}
+		result.Schedules++
+	}
+
+	return result, nil
+}
+
+// checkImportMode refuses to replace the user's triggers with a document
+// that doesn't have any, which would only delete them.
+func checkImportMode(doc TriggerDocument, mode string) error {
+	if mode == ImportReplace && len(doc.Triggers) == 0 && len(doc.Schedules) == 0 {
+		return errors.New("The document doesn't have any triggers or schedules, replacing your triggers with it would delete all of them. Nothing was imported.")
+	}
+	return nil
+}
+
+// validateImportedTrigger checks a trigger with the same rules as
+// /create-trigger, by parsing its definition and making sure that nothing
+// was lost along the way.
+func validateImportedTrigger(imported ActionTemplate) (ActionTemplate, error) {
+	if imported.Presence == "" {
+		imported.Presence = PresenceAway
+	}
+
+	// Differences for each workspace aren't part of the definition, check them separately
+	workspaces := imported.Workspaces
+	imported.Workspaces = nil
+	if err := validateWorkspaceOverrides(workspaces); err != nil {
+		return ActionTemplate{}, err
+	}
+	if imported.Presence != PresenceAway && imported.Presence != PresenceActive {
+		return ActionTemplate{}, errors.Errorf("invalid presence %q, must be %s or %s", imported.Presence, PresenceAway, PresenceActive)
+	}
+	if imported.StatusEmoji != "" && !isEmoji(imported.StatusEmoji) {
+		return ActionTemplate{}, errors.Errorf("invalid emoji %q, use a single emoji such as :boat: or ⛵️", imported.StatusEmoji)
+	}
+	if imported.Duration != "" && imported.Until != "" {
+		return ActionTemplate{}, errors.New("it can have a duration or an end time, but not both")
+	}
+	if _, err := imported.ParseDuration(); imported.Duration != "" && err != nil {
+		return ActionTemplate{}, errors.Errorf("invalid duration %q, here are some examples: 15m, 1h30m, 2d, 1w", imported.Duration)
+	}
+	if _, err := parseEndTime(imported.Until); imported.Until != "" && err != nil {
+		return ActionTemplate{}, errors.Errorf("invalid end time %q, %s", imported.Until, endTimeExamples)
+	}
+
+	tmpl, err := parseTemplate(imported.ToString(), Settings{})
+	if err != nil {
+		return ActionTemplate{}, err
+	}
+
+	if !reflect.DeepEqual(tmpl.Action, imported.Action) || !reflect.DeepEqual(tmpl.Steps, imported.Steps) {
+		return ActionTemplate{}, errors.Errorf("%q is not a valid trigger", imported.ToString())
+	}
+
+	tmpl.TeamId = imported.TeamId
+	tmpl.Global = imported.Global
+	tmpl.Workspaces = workspaces
+	return tmpl, nil
+}
+
+// validateImportedSchedule checks a schedule with the same rules as
+// /schedule-trigger.
+func validateImportedSchedule(imported Schedule) (Schedule, error) {
+	schedule, err := parseSchedule(imported.ToString())
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	if !reflect.DeepEqual(schedule.Days, imported.Days) || schedule.Hour != imported.Hour || schedule.Minute != imported.Minute ||
+		schedule.Duration != imported.Duration || schedule.Until != imported.Until {
+		return Schedule{}, errors.Errorf("%q is not a valid schedule", imported.ToString())
+	}
+
+	schedule.TimeZone = imported.TimeZone
+	return schedule, nil
+}
+
+func containsSchedule(schedules []Schedule, schedule Schedule) bool {
+	for _, s := range schedules {
+		if s.ToString() == schedule.ToString() && s.TimeZone == schedule.TimeZone {
+			return true
+		}
+	}
+	return false
+}
+
+// FileSharedEvent is sent when a file is shared in a conversation with our bot.
+type FileSharedEvent struct {
+	Type      string `json:"type"`
+	FileId    string `json:"file_id"`
+	UserId    string `json:"user_id"`
+	ChannelId string `json:"channel_id"`
+}
+
+// isTriggerDocumentFile determines if a shared file could be a document from
+// /export-triggers, by its Slack file type or extension.
+func isTriggerDocumentFile(filetype string, name string) bool {
+	switch filetype {
+	case "json", "yaml", "yml":
+		return true
+	}
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".json" || ext == ".yaml" || ext == ".yml"
+}
+
+// ImportSharedFile imports a document from /export-triggers that was shared
+// in a direct message with our bot, merging it with the existing triggers.
+// Other files are ignored.
+func (a *App) ImportSharedFile(teamId string, e FileSharedEvent) error {
+	// Only direct messages are imported, not files shared in channels with the bot
+	if !strings.HasPrefix(e.ChannelId, "D") {
+		return nil
+	}
+
+	userId, err := a.lookupUserIdFromSlackId(e.UserId)
+	if err != nil {
+		if IsNotFound(err) {
+			// Not registered, so there is nowhere to import to
+			return nil
+		}
+		return err
+	}
+
+	botToken, err := a.getBotToken(teamId)
+	if err != nil {
+		return err
+	}
+	api := slack.New(botToken, slack.OptionDebug(a.Debug))
+
+	file, _, _, err := api.GetFileInfo(e.FileId, 0, 0)
+	if err != nil {
+		return errors.Wrapf(err, "could not look up shared file %s", e.FileId)
+	}
+	if !isTriggerDocumentFile(file.Filetype, file.Name) {
+		return nil
+	}
+
+	fmt.Printf("%s importing shared file %s(%s) from %s on %s\n", now(), file.Name, file.ID, e.UserId, teamId)
+
+	var text string
+	if file.Size > maxImportDocumentSize {
+		text = fmt.Sprintf("Could not import %s because it is larger than %dMB", file.Name, maxImportDocumentSize>>20)
+	} else {
+		var buf bytes.Buffer
+		err = api.GetFile(file.URLPrivateDownload, &buf)
+		if err != nil {
+			return errors.Wrapf(err, "could not download shared file %s", e.FileId)
+		}
+
+		doc, err := parseTriggerDocument(buf.Bytes())
+		if err != nil {
+			text = fmt.Sprintf("Could not import %s. %s", file.Name, err)
+		} else {
+			result, err := a.importTriggers(transferToken{UserId: userId, SlackId: e.UserId, TeamId: teamId}, doc, ImportMerge)
+			if err != nil {
+				return err
+			}
+			text = result.ToString()
+		}
+	}
+
+	_, _, err = api.PostMessage(e.ChannelId, slack.MsgOptionText(text, false))
+	return errors.Wrapf(err, "could not reply to shared file %s", e.FileId)
+}
+
+// transferLink builds a link to download or upload a document, that is
+// signed so that it works without logging in and expires after a while.
+func (a *App) transferLink(name string, t transferToken) (string, error) {
+	codec, err := a.transferCodec()
+	if err != nil {
+		return "", err
+	}
+
+	value, err := codec.Encode(name, t)
+	if err != nil {
+		return "", errors.Wrapf(err, "error signing %s link for %s", name, t.UserId)
+	}
+
+	return fmt.Sprintf("%s/%s?token=%s", CmdURL, name, url.QueryEscape(value)), nil
+}
+
+// readTransferToken checks the token from a download or upload link.
+func (a *App) readTransferToken(name string, value string) (transferToken, error) {
+	codec, err := a.transferCodec()
+	if err != nil {
+		return transferToken{}, err
+	}
+
+	var t transferToken
+	err = codec.Decode(name, value, &t)
+	if err != nil {
+		return transferToken{}, errors.New("The link is invalid or has expired, run the command again for a new link")
+	}
+	return t, nil
+}
+
+func (a *App) transferCodec() (*securecookie.SecureCookie, error) {
+	key, err := GetSessionKey(a.Secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	codec := securecookie.New([]byte(key), nil)
+	codec.MaxAge(transferLinkMaxAge)
+	return codec, nil
+}
@@ -0,0 +1,206 @@
+package slackoverload
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTriggerDocumentFormats(t *testing.T) {
+	text := "in a meeting"
+	doc := TriggerDocument{
+		Version: TriggerDocumentVersion,
+		Triggers: []ActionTemplate{
+			{
+				Name:   "meeting",
+				TeamId: "T1",
+				Global: true,
+				Action: Action{
+					Presence:   PresenceAway,
+					StatusText: "in a meeting {{.Arg 1}}",
+					DnD:        true,
+					Duration:   "1h",
+					Workspaces: map[string]WorkspaceOverride{"T2": {TeamName: "community", StatusText: &text}},
+				},
+				Steps: []TriggerStep{{Trigger: "lunch", Action: Action{Duration: "30m"}}},
+			},
+		},
+		Schedules: []ExportedSchedule{
+			{Trigger: "meeting", Days: []time.Weekday{time.Monday, time.Friday}, Hour: 9, Minute: 30, TimeZone: "America/Chicago"},
+		},
+	}
+
+	for _, format := range []string{FormatJSON, FormatYAML} {
+		t.Run(format, func(t *testing.T) {
+			b, err := marshalTriggerDocument(doc, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format == FormatYAML && !strings.Contains(string(b), "status-text: in a meeting {{.Arg 1}}") {
+				t.Fatalf("expected the json field names in the YAML document:\n%s", b)
+			}
+
+			got, err := parseTriggerDocument(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(doc, got) {
+				t.Fatalf("expected %#v, got %#v", doc, got)
+			}
+		})
+	}
+}
+
+func TestParseTriggerDocument_HandWrittenYAML(t *testing.T) {
+	doc, err := parseTriggerDocument([]byte(`
+version: 1
+triggers:
+- name: lunch
+  team: T1
+  action:
+    presence: away
+    status-text: brb omnomnom
+    status-emoji: 🌯
+    duration: 1h
+schedules:
+- trigger: lunch
+  days: [1, 2, 3]
+  hour: 12
+  minute: 0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doc.Triggers) != 1 || doc.Triggers[0].StatusText != "brb omnomnom" || doc.Triggers[0].Duration != "1h" {
+		t.Fatalf("unexpected triggers %#v", doc.Triggers)
+	}
+	if len(doc.Schedules) != 1 || doc.Schedules[0].Hour != 12 || len(doc.Schedules[0].Days) != 3 {
+		t.Fatalf("unexpected schedules %#v", doc.Schedules)
+	}
+}
+
+func TestParseTriggerDocument_Invalid(t *testing.T) {
+	testcases := map[string]string{
+		"empty":        "  ",
+		"bad json":     `{"version": 1,`,
+		"bad yaml":     "version: [1",
+		"not a doc":    "just some text",
+		"old version":  `{"version": 2}`,
+		"yaml version": "version: 2",
+	}
+	for name, data := range testcases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseTriggerDocument([]byte(data)); err == nil {
+				t.Fatalf("expected %q to be rejected", data)
+			}
+		})
+	}
+}
+
+func TestIsTriggerDocumentFile(t *testing.T) {
+	testcases := []struct {
+		filetype string
+		name     string
+		want     bool
+	}{
+		{"json", "triggers", true},
+		{"yaml", "triggers", true},
+		{"text", "slackoverload-triggers.YML", true},
+		{"text", "slackoverload-triggers.json", true},
+		{"text", "notes.txt", false},
+		{"png", "screenshot.png", false},
+	}
+	for _, tc := range testcases {
+		if got := isTriggerDocumentFile(tc.filetype, tc.name); got != tc.want {
+			t.Errorf("isTriggerDocumentFile(%q, %q) = %t, expected %t", tc.filetype, tc.name, got, tc.want)
+		}
+	}
+}
+
+func newImportApp(t *testing.T) *App {
+	a := newTwoWorkspaceApp(t)
+	for _, tmpl := range []ActionTemplate{
+		{Name: "lunch", TeamId: "T1", Action: Action{Presence: PresenceAway, StatusText: "lunch"}},
+		{Name: "meeting", TeamId: "T1", Action: Action{Presence: PresenceAway, StatusText: "meeting"}},
+	} {
+		if err := a.createTrigger("u1", tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return a
+}
+
+func TestImportTriggers_Merge(t *testing.T) {
+	a := newImportApp(t)
+	doc := TriggerDocument{
+		Version: TriggerDocumentVersion,
+		Triggers: []ActionTemplate{
+			{Name: "lunch", TeamId: "T1", Action: Action{Presence: PresenceAway, StatusText: "imported"}},
+			{Name: "coffee", TeamId: "T1", Action: Action{Presence: PresenceAway, StatusText: "imported"}},
+		},
+	}
+
+	result, err := a.importTriggers(transferToken{UserId: "u1", SlackId: "U1", TeamId: "T1"}, doc, ImportMerge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Triggers != 1 || len(result.Skipped) != 1 || !strings.Contains(result.Skipped[0], "trigger lunch: you already have a trigger named lunch") {
+		t.Fatalf("expected lunch to be skipped, got %#v", result)
+	}
+
+	for name, want := range map[string]string{"lunch": "lunch", "meeting": "meeting", "coffee": "imported"} {
+		tmpl, err := a.getTrigger("u1", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tmpl.StatusText != want {
+			t.Errorf("expected %s to have the status %q, got %q", name, want, tmpl.StatusText)
+		}
+	}
+}
+
+func TestImportTriggers_Replace(t *testing.T) {
+	token := transferToken{UserId: "u1", SlackId: "U1", TeamId: "T1"}
+
+	t.Run("document with triggers", func(t *testing.T) {
+		a := newImportApp(t)
+		doc := TriggerDocument{
+			Version:  TriggerDocumentVersion,
+			Triggers: []ActionTemplate{{Name: "lunch", TeamId: "T1", Action: Action{Presence: PresenceAway, StatusText: "imported"}}},
+		}
+
+		result, err := a.importTriggers(token, doc, ImportReplace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Triggers != 1 || len(result.Skipped) != 0 {
+			t.Fatalf("expected lunch to be imported, got %#v", result)
+		}
+
+		triggers, err := a.getAllTriggers("u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(triggers) != 1 || triggers[0].StatusText != "imported" {
+			t.Fatalf("expected only the imported trigger, got %#v", triggers)
+		}
+	})
+
+	t.Run("empty document", func(t *testing.T) {
+		a := newImportApp(t)
+		_, err := a.importTriggers(token, TriggerDocument{Version: TriggerDocumentVersion}, ImportReplace)
+		if err == nil || !strings.Contains(err.Error(), "doesn't have any triggers or schedules") {
+			t.Fatalf("expected an empty document to be refused, got %v", err)
+		}
+
+		triggers, err := a.getAllTriggers("u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(triggers) != 2 {
+			t.Fatalf("expected the existing triggers to be kept, got %#v", triggers)
+		}
+	})
+}
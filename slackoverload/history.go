@@ -0,0 +1,297 @@
+package slackoverload
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxStatusHistory is how many status changes are remembered for /undo-status.
+const maxStatusHistory = 5
+
+// StatusSnapshot is the status of a Slack account before it was changed.
+type StatusSnapshot struct {
+	SlackId          string   `json:"slack-id"`
+	TeamId           string   `json:"team"`
+	StatusText       string   `json:"status-text,omitempty"`
+	StatusEmoji      string   `json:"status-emoji,omitempty"`
+	StatusExpiration int64    `json:"status-expiration,omitempty"`
+	Presence         Presence `json:"presence"`
+	SnoozeEnabled    bool     `json:"snooze-enabled,omitempty"`
+	SnoozeEndTime    int64    `json:"snooze-end-time,omitempty"`
+}
+
+// StatusChange holds the snapshots of every account affected by a single status change.
+type StatusChange struct {
+	Time      time.Time        `json:"time"`
+	Snapshots []StatusSnapshot `json:"snapshots"`
+}
+
+// StatusHistory is a stack of the most recent status changes, newest last.
+type StatusHistory struct {
+	Changes []StatusChange `json:"changes"`
+}
+
+type UndoStatusRequest struct {
+	SlackPayload
+}
+
+func (a *App) UndoStatus(r UndoStatusRequest) (slack.Msg, error) {
+	fmt.Printf("%s /undo-status for %s(%s) on %s(%s)\n",
+		now(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+
+	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
+	if err != nil {
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
+	}
+
+	change, ok, err := a.lastStatusChange(userId)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+	if !ok {
+		return slack.Msg{
+			Type: slack.ResponseTypeEphemeral,
+			Text: "There aren't any status changes to undo",
+		}, nil
+	}
+
+	var g errgroup.Group
+	for _, snapshot := range change.Snapshots {
+		snapshot := snapshot
+		g.Go(func() error {
+			err := a.restoreSlackStatus(snapshot)
+			if err != nil {
+				return err
+			}
+
+			// The change being undone shouldn't revert the restored status
+			// later, or move on to its next step
+			err = a.cancelRevert(userId, snapshot.TeamId)
+			if err != nil {
+				return err
+			}
+			return a.cancelSequences(userId, snapshot.TeamId)
+		})
+	}
+	err = g.Wait()
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	// Only forget the change once it's undone, so that a failed undo can be retried
+	err = a.removeStatusChange(userId, change)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	msg := slack.Msg{
+		Type: slack.ResponseTypeEphemeral,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.SectionBlock{
+				Type: slack.MBTSection,
+				Text: &slack.TextBlockObject{
+					Type: slack.MarkdownType,
+					Text: fmt.Sprintf("Restored your status from before %s :rewind:", change.Time.Format("Mon Jan 2 3:04pm MST")),
+				},
+			},
+		}},
+	}
+
+	return msg, nil
+}
+
+// snapshotSlackStatuses saves the current status of each Slack account before
+// it is changed, so that the change can be undone.
+func (a *App) snapshotSlackStatuses(userId string, slackUsers []SlackUser) error {
+	var mu sync.Mutex
+	var g errgroup.Group
+	change := StatusChange{Time: time.Now()}
+	for _, slackUser := range slackUsers {
+		slackUser := slackUser
+		g.Go(func() error {
+			snapshot, err := a.getSlackStatus(slackUser)
+			if err != nil {
+				// Accounts linked before we asked for read access can't be snapshotted
+				fmt.Printf("Could not snapshot status for %s (%s) on team %s: %v\n", userId, slackUser.ID, slackUser.TeamID, err)
+				return nil
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			change.Snapshots = append(change.Snapshots, snapshot)
+			return nil
+		})
+	}
+	g.Wait()
+
+	if len(change.Snapshots) == 0 {
+		return nil
+	}
+
+	return a.updateStatusHistory(userId, func(history *StatusHistory) {
+		history.Changes = append(history.Changes, change)
+		if len(history.Changes) > maxStatusHistory {
+			history.Changes = history.Changes[len(history.Changes)-maxStatusHistory:]
+		}
+	})
+}
+
+func (a *App) getSlackStatus(slackUser SlackUser) (StatusSnapshot, error) {
+	slackId := slackUser.ID
+	token, err := a.getSlackToken(slackId)
+	if err != nil {
+		return StatusSnapshot{}, err
+	}
+
+	api := slack.New(token.AccessToken, slack.OptionDebug(a.Debug))
+	snapshot := StatusSnapshot{SlackId: slackId, TeamId: slackUser.TeamID}
+
+	var g errgroup.Group
+
+	g.Go(func() error {
+		profile, err := api.GetUserProfile(slackId, false)
+		if err != nil {
+			return errors.Wrap(err, "could not get profile")
+		}
+		snapshot.StatusText = profile.StatusText
+		snapshot.StatusEmoji = profile.StatusEmoji
+		snapshot.StatusExpiration = int64(profile.StatusExpiration)
+		return nil
+	})
+
+	g.Go(func() error {
+		presence, err := api.GetUserPresence(slackId)
+		if err != nil {
+			return errors.Wrap(err, "could not get presence")
+		}
+		snapshot.Presence = PresenceActive
+		if presence.ManualAway {
+			snapshot.Presence = PresenceAway
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		dndState, err := api.GetDNDInfo(&slackId)
+		if err != nil {
+			return errors.Wrap(err, "could not get do not disturb")
+		}
+		snapshot.SnoozeEnabled = dndState.SnoozeEnabled
+		snapshot.SnoozeEndTime = int64(dndState.SnoozeEndTime)
+		return nil
+	})
+
+	err = g.Wait()
+	return snapshot, err
+}
+
+func (a *App) restoreSlackStatus(snapshot StatusSnapshot) error {
+	slackId := snapshot.SlackId
+	token, err := a.getSlackToken(slackId)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Restoring slack status for %s on team %s to %#v\n", slackId, snapshot.TeamId, snapshot)
+
+	api := slack.New(token.AccessToken, slack.OptionDebug(a.Debug))
+	nowUnix := time.Now().Unix()
+
+	var g errgroup.Group
+
+	g.Go(func() error {
+		err := api.SetUserPresence(string(snapshot.Presence))
+		return errors.Wrap(err, "could not restore presence")
+	})
+
+	g.Go(func() error {
+		text, emoji := snapshot.StatusText, snapshot.StatusEmoji
+		if snapshot.StatusExpiration != 0 && snapshot.StatusExpiration <= nowUnix {
+			// The old status would have expired by now
+			text, emoji = "", ""
+		}
+		err := api.SetUserCustomStatus(text, emoji, snapshot.StatusExpiration)
+		return errors.Wrap(err, "could not restore status")
+	})
+
+	g.Go(func() error {
+		if snapshot.SnoozeEnabled && snapshot.SnoozeEndTime > nowUnix {
+			minutes := (snapshot.SnoozeEndTime - nowUnix + 59) / 60
+			_, err := api.SetSnooze(int(minutes))
+			return errors.Wrap(err, "could not restore do not disturb")
+		}
+
+		dndState, err := api.GetDNDInfo(&slackId)
+		if err != nil {
+			return errors.Wrapf(err, "could not retrieve user's current DND state")
+		}
+		if dndState.SnoozeEnabled {
+			_, err = api.EndSnooze()
+			return errors.Wrap(err, "could not end do not disturb")
+		}
+		return nil
+	})
+
+	return g.Wait()
+}
+
+// lastStatusChange returns the most recent status change from the user's history.
+func (a *App) lastStatusChange(userId string) (StatusChange, bool, error) {
+	data, err := a.Storage.GetBlob("history", userId)
+	if err != nil {
+		if IsNotFound(err) {
+			return StatusChange{}, false, nil
+		}
+		return StatusChange{}, false, err
+	}
+
+	var history StatusHistory
+	err = json.Unmarshal(data, &history)
+	if err != nil {
+		return StatusChange{}, false, errors.Wrapf(err, "error parsing status history for %q", userId)
+	}
+
+	if len(history.Changes) == 0 {
+		return StatusChange{}, false, nil
+	}
+	return history.Changes[len(history.Changes)-1], true, nil
+}
+
+// removeStatusChange removes a status change from the user's history. Other
+// changes may have been saved since it was read, so it's found by its time.
+func (a *App) removeStatusChange(userId string, change StatusChange) error {
+	return a.updateStatusHistory(userId, func(history *StatusHistory) {
+		for i := len(history.Changes) - 1; i >= 0; i-- {
+			if history.Changes[i].Time.Equal(change.Time) {
+				history.Changes = append(history.Changes[:i], history.Changes[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+func (a *App) updateStatusHistory(userId string, update func(history *StatusHistory)) error {
+	return updateBlob(a.Storage, "history", userId, func(data []byte) ([]byte, error) {
+		var history StatusHistory
+		if data != nil {
+			err := json.Unmarshal(data, &history)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error parsing status history for %q", userId)
+			}
+		}
+
+		update(&history)
+
+		b, err := json.Marshal(history)
+		return b, errors.Wrapf(err, "error marshaling status history for %q", userId)
+	})
+}
@@ -0,0 +1,64 @@
+package slackoverload
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUndoStatus_KeepsChangeWhenRestoreFails(t *testing.T) {
+	secrets, err := NewEncryptedFileSecrets(t.TempDir(), newSecretsKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &App{Storage: NewMemoryStorage(), Secrets: secrets}
+	err = a.setIdentity(Identity{SlackId: "U1", UserId: "u1", TeamId: "T1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	older := StatusChange{Time: time.Unix(1000, 0), Snapshots: []StatusSnapshot{{SlackId: "U1", TeamId: "T1"}}}
+	change := StatusChange{Time: time.Unix(2000, 0), Snapshots: []StatusSnapshot{{SlackId: "U1", TeamId: "T1"}}}
+	err = a.updateStatusHistory("u1", func(history *StatusHistory) {
+		history.Changes = append(history.Changes, older, change)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// There isn't a token saved for U1, so the status can't be restored
+	_, err = a.UndoStatus(UndoStatusRequest{SlackPayload{SlackId: "U1", TeamId: "T1"}})
+	if err == nil {
+		t.Fatal("expected the undo to fail without a token")
+	}
+
+	got, ok, err := a.lastStatusChange("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || !got.Time.Equal(change.Time) {
+		t.Fatalf("expected the change to be kept so that the undo can be retried, got %v", got)
+	}
+
+	err = a.removeStatusChange("u1", change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err = a.lastStatusChange("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || !got.Time.Equal(older.Time) {
+		t.Fatalf("expected only the undone change to be removed, got %v", got)
+	}
+}
+
+func TestLastStatusChange_NoHistory(t *testing.T) {
+	a := &App{Storage: NewMemoryStorage()}
+	_, ok, err := a.lastStatusChange("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("expected no status change without any history")
+	}
+}
@@ -0,0 +1,165 @@
+package slackoverload
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxHomeTriggers is how many triggers are shown in the App Home, since
+// Slack limits a view to 100 blocks.
+const maxHomeTriggers = 40
+
+// PublishHome shows the user's triggers, their active status on each linked
+// workspace and their linked workspaces in the App Home.
+func (a *App) PublishHome(slackId string, teamId string) error {
+	fmt.Printf("%s publishing home for %s on %s\n", now(), slackId, teamId)
+
+	token, err := a.getBotToken(teamId)
+	if err != nil {
+		return errors.Wrapf(err, "cannot publish the home for %s, the app must be reinstalled on %s", slackId, teamId)
+	}
+
+	view, err := a.buildHome(slackId, teamId)
+	if err != nil {
+		return err
+	}
+
+	err = publishView(token, slackId, view)
+	return errors.Wrapf(err, "could not publish the home for %s on %s", slackId, teamId)
+}
+
+func (a *App) buildHome(slackId string, teamId string) (View, error) {
+	view := View{Type: ViewTypeHome}
+
+	userId, err := a.lookupUserIdFromSlackId(slackId)
+	if err != nil {
+		if IsNotFound(err) {
+			view.Blocks = a.handleUserNotRegistered().Blocks
+			return view, nil
+		}
+		return View{}, err
+	}
+
+	user, err := a.getCurrentUser(userId)
+	if err != nil {
+		return View{}, err
+	}
+
+	triggers, err := a.listTriggers(userId, teamId, false)
+	if err != nil {
+		return View{}, err
+	}
+
+	blocks := []slack.Block{markdownSection("*Triggers*"), slack.NewDividerBlock()}
+	if len(triggers) == 0 {
+		blocks = append(blocks, markdownSection("You haven't created any triggers for this workspace yet. Run `/create-trigger` to make one."))
+	}
+	for i, trigger := range triggers {
+		if i == maxHomeTriggers {
+			blocks = append(blocks, markdownSection(fmt.Sprintf("And %d more, run `/list-triggers` to see them all.", len(triggers)-i)))
+			break
+		}
+		blocks = append(blocks, triggerSection(trigger), triggerButtons(trigger.Name))
+	}
+
+	statuses, workspaces, err := a.describeSlackUsers(userId, user.SlackUsers)
+	if err != nil {
+		return View{}, err
+	}
+
+	blocks = append(blocks, markdownSection("*Active Status*"), slack.NewDividerBlock())
+	blocks = append(blocks, markdownSection(strings.Join(statuses, "\n")))
+
+	blocks = append(blocks, markdownSection("*Linked Workspaces*"), slack.NewDividerBlock())
+	blocks = append(blocks, markdownSection(fmt.Sprintf("%s\n\nRun `/link-slack` to link another Slack account.", strings.Join(workspaces, "\n"))))
+
+	view.Blocks = slack.Blocks{BlockSet: blocks}
+	return view, nil
+}
+
+// describeSlackUsers looks up the name of the workspace, and the active status,
+// of each of the user's linked Slack accounts.
+func (a *App) describeSlackUsers(userId string, slackUsers []SlackUser) ([]string, []string, error) {
+	now := time.Now()
+	statuses := make([]string, len(slackUsers))
+	workspaces := make([]string, len(slackUsers))
+
+	var g errgroup.Group
+	for i, slackUser := range slackUsers {
+		i, slackUser := i, slackUser
+		g.Go(func() error {
+			workspace := slackUser.TeamID
+			if id, err := a.getIdentity(slackUser.ID); err == nil && id.TeamName != "" {
+				workspace = id.TeamName
+			}
+
+			triggers, err := a.listTriggers(userId, slackUser.TeamID, false)
+			if err != nil {
+				return err
+			}
+
+			var status string
+			snapshot, err := a.getSlackStatus(slackUser)
+			if err != nil {
+				fmt.Printf("Could not get the status for %s (%s) on team %s: %v\n", userId, slackUser.ID, slackUser.TeamID, err)
+				status = fmt.Sprintf("*%s*: unknown", workspace)
+			} else {
+				status = formatActiveStatus(workspace, snapshot, triggers, now)
+			}
+
+			statuses[i] = status
+			workspaces[i] = fmt.Sprintf("• %s", workspace)
+			return nil
+		})
+	}
+	err := g.Wait()
+	return statuses, workspaces, err
+}
+
+// formatActiveStatus describes the status of a Slack account, and the trigger
+// that set it when the status matches one of the user's triggers.
+func formatActiveStatus(workspace string, snapshot StatusSnapshot, triggers []ActionTemplate, now time.Time) string {
+	if snapshot.StatusText == "" && snapshot.StatusEmoji == "" {
+		return fmt.Sprintf("*%s*: no status", workspace)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s*:", workspace)
+	for _, trigger := range triggers {
+		if trigger.StatusText == snapshot.StatusText && (snapshot.StatusText != "" || trigger.StatusEmoji == snapshot.StatusEmoji) {
+			fmt.Fprintf(&b, " _%s_", trigger.Name)
+			break
+		}
+	}
+	if snapshot.StatusEmoji != "" {
+		fmt.Fprintf(&b, " %s", snapshot.StatusEmoji)
+	}
+	if snapshot.StatusText != "" {
+		fmt.Fprintf(&b, " %s", snapshot.StatusText)
+	}
+	if snapshot.SnoozeEnabled {
+		b.WriteString(" :no_bell:")
+	}
+	if snapshot.StatusExpiration > 0 {
+		remaining := time.Unix(snapshot.StatusExpiration, 0).Sub(now)
+		if remaining > 0 {
+			fmt.Fprintf(&b, " (%s left)", formatDuration(remaining))
+		}
+	}
+	return b.String()
+}
+
+func markdownSection(text string) slack.SectionBlock {
+	return slack.SectionBlock{
+		Type: slack.MBTSection,
+		Text: &slack.TextBlockObject{
+			Type: slack.MarkdownType,
+			Text: text,
+		},
+	}
+}
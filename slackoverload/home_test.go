@@ -0,0 +1,49 @@
+package slackoverload
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+func TestBuildHome_ManyTriggers(t *testing.T) {
+	a := newTwoWorkspaceApp(t)
+	a.Secrets = ChainedSecrets{}
+
+	// Slack rejects a view with more than 100 blocks
+	const maxViewBlocks = 100
+
+	count := maxHomeTriggers + 10
+	for i := 0; i < count; i++ {
+		tmpl := ActionTemplate{Name: fmt.Sprintf("trigger%02d", i), TeamId: "T1", Global: i%2 == 0}
+		if err := a.createTrigger("u1", tmpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	view, err := a.buildHome("U1", "T1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := view.Blocks.BlockSet
+	if len(blocks) > maxViewBlocks {
+		t.Fatalf("expected at most %d blocks, got %d", maxViewBlocks, len(blocks))
+	}
+
+	var buttons int
+	for _, block := range blocks {
+		if actions, ok := block.(*slack.ActionBlock); ok && strings.HasPrefix(actions.BlockID, "trigger-") {
+			buttons++
+		}
+	}
+	more := strings.Contains(messageText(slack.Msg{Blocks: view.Blocks}), fmt.Sprintf("And %d more", count-maxHomeTriggers))
+	if buttons != maxHomeTriggers {
+		t.Fatalf("expected buttons for %d triggers, got %d", maxHomeTriggers, buttons)
+	}
+	if !more {
+		t.Fatal("expected the home to say how many triggers were left out")
+	}
+}
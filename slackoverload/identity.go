@@ -0,0 +1,144 @@
+package slackoverload
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+// Identity links a Slack user on a workspace to a Slack Overload user.
+// Identities are stored in the identities container, indexed by Slack user id.
+type Identity struct {
+	SlackId  string `json:"slack-id"`
+	UserId   string `json:"user"`
+	TeamId   string `json:"team"`
+	TeamName string `json:"team-name,omitempty"`
+	Scopes   string `json:"scopes,omitempty"`
+}
+
+// IdentityNotFoundError is returned when a Slack user hasn't authorized the app.
+type IdentityNotFoundError struct {
+	SlackId string
+}
+
+func (e IdentityNotFoundError) Error() string {
+	return fmt.Sprintf("Slack user %s has not authorized the Slack Overload app", e.SlackId)
+}
+
+func (e IdentityNotFoundError) NotFound() bool {
+	return true
+}
+
+func (a *App) getIdentity(slackId string) (Identity, error) {
+	b, err := a.Storage.GetBlob("identities", slackId)
+	if err != nil {
+		if IsNotFound(err) {
+			return Identity{}, IdentityNotFoundError{SlackId: slackId}
+		}
+		return Identity{}, err
+	}
+
+	var id Identity
+	err = json.Unmarshal(b, &id)
+	if err != nil {
+		return Identity{}, errors.Wrapf(err, "error parsing identity for slack user %s", slackId)
+	}
+
+	return id, nil
+}
+
+func (a *App) setIdentity(id Identity) error {
+	if id.SlackId == "" || id.UserId == "" {
+		return errors.Errorf("cannot save identity, both the slack id and user id are required: %#v", id)
+	}
+
+	b, err := json.Marshal(id)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling identity\n%#v", id)
+	}
+
+	return a.Storage.SetBlob("identities", id.SlackId, b)
+}
+
+func (a *App) lookupUserIdFromSlackId(slackId string) (string, error) {
+	id, err := a.getIdentity(slackId)
+	if err != nil {
+		return "", err
+	}
+	return id.UserId, nil
+}
+
+// MigrateIdentities builds the identity index from the tags on the oauth
+// tokens saved in the secrets store. Previously the tags were the only
+// record of which user a Slack account belonged to.
+// Identities that are already indexed are left alone.
+func (a *App) MigrateIdentities() error {
+	lister, ok := a.Secrets.(SecretLister)
+	if !ok {
+		return errors.Errorf("the secrets backend %T does not support listing secrets", a.Secrets)
+	}
+
+	keys, err := lister.ListSecrets("oauth-")
+	if err != nil {
+		return err
+	}
+
+	var migrated, skipped int
+	for _, key := range keys {
+		slackId := strings.TrimPrefix(key, "oauth-")
+		_, err := a.getIdentity(slackId)
+		if err == nil {
+			skipped++
+			continue
+		}
+		if !IsNotFound(err) {
+			return err
+		}
+
+		accessToken, tags, err := a.GetSecret(key)
+		if err != nil {
+			return err
+		}
+
+		getTag := func(key string) string {
+			value, ok := tags[key]
+			if !ok || value == nil {
+				return ""
+			}
+			return *value
+		}
+
+		id := Identity{
+			SlackId: slackId,
+			UserId:  getTag("user"),
+			TeamId:  getTag("team"),
+			Scopes:  getTag("scopes"),
+		}
+		if id.UserId == "" {
+			fmt.Printf("Skipping %s, it is not tagged with a user\n", key)
+			skipped++
+			continue
+		}
+
+		// The team name was never saved, ask Slack for it
+		api := slack.New(accessToken, slack.OptionDebug(a.Debug))
+		if auth, err := api.AuthTest(); err == nil {
+			id.TeamName = auth.Team
+		} else {
+			fmt.Printf("Could not look up the team name for %s: %s\n", slackId, err)
+		}
+
+		err = a.setIdentity(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Migrated %s -> %s on %s(%s)\n", slackId, id.UserId, id.TeamName, id.TeamId)
+		migrated++
+	}
+
+	fmt.Printf("Migrated %d identities, skipped %d\n", migrated, skipped)
+	return nil
+}
@@ -0,0 +1,77 @@
+package slackoverload
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+// unavailableStorage fails to read from a container, like a storage outage.
+type unavailableStorage struct {
+	Storage
+	container string
+}
+
+func (s unavailableStorage) GetBlob(containerName string, blobName string) ([]byte, error) {
+	if containerName == s.container {
+		return nil, errors.Errorf("%s is unavailable", containerName)
+	}
+	return s.Storage.GetBlob(containerName, blobName)
+}
+
+func TestGetIdentity_NotFound(t *testing.T) {
+	a := &App{Storage: NewMemoryStorage()}
+
+	_, err := a.getIdentity("U1")
+	if !IsNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+	if _, ok := err.(IdentityNotFoundError); !ok {
+		t.Fatalf("expected an IdentityNotFoundError, got %T", err)
+	}
+
+	_, err = a.lookupUserIdFromSlackId("U1")
+	if !IsNotFound(err) {
+		t.Fatalf("expected lookupUserIdFromSlackId to return a not found error, got %v", err)
+	}
+}
+
+func TestUserNotRegistered(t *testing.T) {
+	payload := SlackPayload{SlackId: "U1", TeamId: "T1"}
+
+	t.Run("not registered", func(t *testing.T) {
+		a := &App{Storage: NewMemoryStorage()}
+		msg, err := a.ListTriggers(ListTriggersRequest{SlackPayload: payload})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(messageText(msg), "hasn't activated the Slack Overload app") {
+			t.Fatalf("expected the not registered message, got %#v", msg)
+		}
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		a := &App{Storage: unavailableStorage{Storage: NewMemoryStorage(), container: "identities"}}
+		_, err := a.ListTriggers(ListTriggersRequest{SlackPayload: payload})
+		if err == nil || !strings.Contains(err.Error(), "identities is unavailable") {
+			t.Fatalf("expected the storage error, got %v", err)
+		}
+
+		_, err = a.buildHome("U1", "T1")
+		if err == nil || !strings.Contains(err.Error(), "identities is unavailable") {
+			t.Fatalf("expected the storage error from the home, got %v", err)
+		}
+	})
+}
+
+func messageText(msg slack.Msg) string {
+	var text []string
+	for _, block := range msg.Blocks.BlockSet {
+		if section, ok := block.(slack.SectionBlock); ok && section.Text != nil {
+			text = append(text, section.Text.Text)
+		}
+	}
+	return strings.Join(text, "\n")
+}
@@ -0,0 +1,394 @@
+package slackoverload
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+// Action ids of the buttons shown next to each trigger in the library, the
+// value of the button is the name of the trigger.
+const (
+	libraryActionAdopt     = "library-adopt"
+	libraryActionUnpublish = "library-unpublish"
+)
+
+// LibraryEntry is a trigger that was published to a workspace's library, so
+// that everyone on the workspace can copy it.
+type LibraryEntry struct {
+	ActionTemplate
+
+	// AuthorId is the Slack user that published the trigger.
+	AuthorId string `json:"author"`
+
+	// AuthorName is the Slack user name of the author when it was published.
+	AuthorName string `json:"author-name"`
+
+	Published time.Time `json:"published"`
+}
+
+type PublishTriggerRequest struct {
+	SlackPayload
+}
+
+func (r PublishTriggerRequest) GetName() string {
+	return strings.TrimSpace(r.Text)
+}
+
+type UnpublishTriggerRequest struct {
+	SlackPayload
+}
+
+func (r UnpublishTriggerRequest) GetName() string {
+	return strings.TrimSpace(r.Text)
+}
+
+type BrowseTriggersRequest struct {
+	SlackPayload
+}
+
+type AdoptTriggerRequest struct {
+	SlackPayload
+}
+
+// Parse the name of the trigger to adopt, and the name to save it as.
+// Example:
+// lunch as long-lunch
+// name = lunch
+// as = long-lunch
+func (r AdoptTriggerRequest) Parse() (string, string, error) {
+	fields := strings.Fields(r.Text)
+	switch {
+	case len(fields) == 1:
+		if err := validateTriggerName(fields[0]); err != nil {
+			return "", "", err
+		}
+		return fields[0], fields[0], nil
+	case len(fields) == 3 && strings.EqualFold(fields[1], "as"):
+		if err := validateTriggerName(fields[0]); err != nil {
+			return "", "", err
+		}
+		if err := validateTriggerName(fields[2]); err != nil {
+			return "", "", err
+		}
+		return fields[0], fields[2], nil
+	default:
+		return "", "", errors.New("Which trigger? Try /adopt-trigger lunch, or /adopt-trigger lunch as long-lunch to save it with another name")
+	}
+}
+
+// PublishTrigger copies one of the user's triggers to the library for the
+// current workspace. Publishing a trigger again updates it.
+func (a *App) PublishTrigger(r PublishTriggerRequest) (slack.Msg, error) {
+	fmt.Printf("%s /publish-trigger %s from %s(%s) on %s(%s)\n",
+		now(), r.GetName(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+
+	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
+	if err != nil {
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
+	}
+
+	if r.GetName() == "" {
+		return slack.Msg{}, errors.New("Which trigger? Try /publish-trigger lunch")
+	}
+
+	tmpl, err := a.getTrigger(userId, r.GetName())
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	// How the trigger is different on your other workspaces isn't shared
+	tmpl.Workspaces = nil
+
+	for _, step := range tmpl.Steps {
+		if step.Trigger != "" {
+			return slack.Msg{}, errors.Errorf("Could not publish %s because it runs %s, which other people don't have. Only triggers with their own steps can be published.",
+				tmpl.Name, step.Trigger)
+		}
+	}
+
+	key, err := triggerKey(r.TeamId, tmpl.Name)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	err = updateBlob(a.Storage, "library", key, func(data []byte) ([]byte, error) {
+		if data != nil {
+			existing, err := parseLibraryEntry(tmpl.Name, data)
+			if err != nil {
+				return nil, err
+			}
+			if existing.AuthorId != r.SlackId {
+				return nil, errors.Errorf("Could not publish %s because @%s already published a trigger with that name. Rename yours with /overload edit %s first.",
+					tmpl.Name, existing.AuthorName, tmpl.Name)
+			}
+		}
+
+		entry := LibraryEntry{
+			ActionTemplate: ActionTemplate{
+				Name:   tmpl.Name,
+				TeamId: r.TeamId,
+				Action: tmpl.Action,
+				Steps:  tmpl.Steps,
+			},
+			AuthorId:   r.SlackId,
+			AuthorName: r.UserName,
+			Published:  time.Now(),
+		}
+		b, err := json.Marshal(entry)
+		return b, errors.Wrapf(err, "error marshaling library entry %s: %#v", key, entry)
+	})
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	msg := slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			markdownSection(fmt.Sprintf("Published *%s* to the trigger library for this workspace. Anyone here can copy it with `/adopt-trigger %s`.",
+				tmpl.Name, tmpl.Name)),
+		}},
+	}
+	return msg, nil
+}
+
+// UnpublishTrigger removes a trigger from the library for the current
+// workspace. Only its author or a workspace admin can remove it.
+func (a *App) UnpublishTrigger(r UnpublishTriggerRequest) (slack.Msg, error) {
+	fmt.Printf("%s /unpublish-trigger %s from %s(%s) on %s(%s)\n",
+		now(), r.GetName(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+
+	if r.GetName() == "" {
+		return slack.Msg{}, errors.New("Which trigger? Try /unpublish-trigger lunch")
+	}
+
+	entry, err := a.getLibraryEntry(r.TeamId, r.GetName())
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	if entry.AuthorId != r.SlackId {
+		admin, err := a.isWorkspaceAdmin(r.SlackId)
+		if err != nil {
+			return slack.Msg{}, err
+		}
+		if !admin {
+			return slack.Msg{}, errors.Errorf("Only @%s, who published %s, or a workspace admin can remove it from the library",
+				entry.AuthorName, entry.Name)
+		}
+	}
+
+	key, err := triggerKey(r.TeamId, entry.Name)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	err = a.Storage.DeleteBlob("library", key)
+	if err != nil && !IsNotFound(err) {
+		return slack.Msg{}, errors.Wrapf(err, "error removing %s from the library for %s", entry.Name, r.TeamId)
+	}
+
+	msg := slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			markdownSection(fmt.Sprintf("Removed *%s* from the trigger library", entry.Name)),
+		}},
+	}
+	return msg, nil
+}
+
+// BrowseTriggers lists the triggers in the library for the current workspace.
+func (a *App) BrowseTriggers(r BrowseTriggersRequest) (slack.Msg, error) {
+	fmt.Printf("%s /browse-triggers from %s(%s) on %s(%s)\n",
+		now(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+
+	entries, err := a.listLibrary(r.TeamId)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	headerText := "Here are the triggers that have been published for this workspace:"
+	if len(entries) == 0 {
+		headerText = "Nobody has published a trigger for this workspace yet. Share one of yours with `/publish-trigger NAME`."
+	}
+
+	msg := slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			markdownSection(headerText),
+			slack.NewDividerBlock(),
+		}},
+	}
+
+	for _, entry := range entries {
+		msg.Blocks.BlockSet = append(msg.Blocks.BlockSet, librarySection(entry), libraryButtons(entry, r.SlackId))
+	}
+
+	return msg, nil
+}
+
+func librarySection(entry LibraryEntry) slack.SectionBlock {
+	section := triggerSection(entry.ActionTemplate)
+	section.Fields[0].Text = fmt.Sprintf("*Name*: %s\n*Status*: %s\n*Do Not Disturb*: %t\n*Default Duration*: %s%s\n*Published By*: <@%s>",
+		entry.Name, entry.StatusText, entry.DnD, entry.Duration, stepsText(entry.Steps), entry.AuthorId)
+	return section
+}
+
+// libraryButtons builds the buttons to adopt a trigger from the library, and
+// to remove it when it was published by the user.
+func libraryButtons(entry LibraryEntry, slackId string) *slack.ActionBlock {
+	adopt := slack.NewButtonBlockElement(libraryActionAdopt, entry.Name, plainText("Adopt"))
+	adopt.WithStyle(slack.StylePrimary)
+	buttons := []slack.BlockElement{adopt}
+
+	if entry.AuthorId == slackId {
+		unpublish := slack.NewButtonBlockElement(libraryActionUnpublish, entry.Name, plainText("Unpublish"))
+		unpublish.WithStyle(slack.StyleDanger)
+		unpublish.Confirm = slack.NewConfirmationBlockObject(
+			plainText("Unpublish Trigger"),
+			slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("Are you sure that you want to remove *%s* from the library?", entry.Name), false, false),
+			plainText("Unpublish"),
+			plainText("Cancel"))
+		buttons = append(buttons, unpublish)
+	}
+
+	return slack.NewActionBlock(buildBlockId("library-", entry.Name), buttons...)
+}
+
+// AdoptTrigger copies a trigger from the library for the current workspace
+// into the user's triggers for the workspace.
+func (a *App) AdoptTrigger(r AdoptTriggerRequest) (slack.Msg, error) {
+	fmt.Printf("%s /adopt-trigger %s from %s(%s) on %s(%s)\n",
+		now(), r.Text, r.UserName, r.SlackId, r.TeamName, r.TeamId)
+
+	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
+	if err != nil {
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
+	}
+
+	name, as, err := r.Parse()
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	entry, err := a.getLibraryEntry(r.TeamId, name)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	tmpl := ActionTemplate{
+		Name:   as,
+		TeamId: r.TeamId,
+		Action: entry.Action,
+		Steps:  entry.Steps,
+	}
+
+	// Only create the trigger, never overwrite one that the user already has
+	err = a.createTrigger(userId, tmpl)
+	if err != nil {
+		if IsConflict(err) {
+			return slack.Msg{}, errors.Errorf("You already have a trigger named %s. Try /adopt-trigger %s as another-name", as, name)
+		}
+		return slack.Msg{}, errors.Wrapf(err, "error saving trigger %s for %s(%s)", as, r.UserName, r.SlackId)
+	}
+
+	msg := slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			markdownSection(fmt.Sprintf("Adopted *%s* from <@%s>, run it with `/trigger %s`", entry.Name, entry.AuthorId, as)),
+		}},
+	}
+	return msg, nil
+}
+
+// LibraryEntryNotFoundError is returned when a trigger isn't in the library.
+type LibraryEntryNotFoundError struct {
+	Name string
+}
+
+func (e LibraryEntryNotFoundError) Error() string {
+	return fmt.Sprintf("Nobody has published a trigger named %s for this workspace. Use /browse-triggers to see what has been published.", e.Name)
+}
+
+func (e LibraryEntryNotFoundError) NotFound() bool {
+	return true
+}
+
+func (a *App) getLibraryEntry(teamId string, name string) (LibraryEntry, error) {
+	key, err := triggerKey(teamId, name)
+	if err != nil {
+		return LibraryEntry{}, err
+	}
+
+	b, err := a.Storage.GetBlob("library", key)
+	if err != nil {
+		if IsNotFound(err) {
+			return LibraryEntry{}, LibraryEntryNotFoundError{Name: name}
+		}
+		return LibraryEntry{}, err
+	}
+
+	return parseLibraryEntry(name, b)
+}
+
+// listLibrary returns the triggers published for a workspace, sorted by name.
+func (a *App) listLibrary(teamId string) ([]LibraryEntry, error) {
+	teamDir := teamId + "/"
+	blobNames, err := a.Storage.ListContainer("library", teamDir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]LibraryEntry, 0, len(blobNames))
+	for _, blobName := range blobNames {
+		entry, err := a.getLibraryEntry(teamId, strings.TrimPrefix(blobName, teamDir))
+		if err != nil {
+			if IsNotFound(err) {
+				// Unpublished while we were listing
+				continue
+			}
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+func parseLibraryEntry(name string, data []byte) (LibraryEntry, error) {
+	var entry LibraryEntry
+	err := json.Unmarshal(data, &entry)
+	if err != nil {
+		return LibraryEntry{}, errors.Wrapf(err, "error unmarshaling library entry %s: %s", name, string(data))
+	}
+	return entry, nil
+}
+
+// isWorkspaceAdmin checks if a Slack user is an admin or owner of their workspace.
+func (a *App) isWorkspaceAdmin(slackId string) (bool, error) {
+	token, err := a.getSlackToken(slackId)
+	if err != nil {
+		return false, err
+	}
+
+	api := slack.New(token.AccessToken, slack.OptionDebug(a.Debug))
+	info, err := api.GetUserInfo(slackId)
+	if err != nil {
+		return false, errors.Wrapf(err, "could not look up if %s is a workspace admin", slackId)
+	}
+	return info.IsAdmin || info.IsOwner, nil
+}
@@ -0,0 +1,82 @@
+package slackoverload
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAdoptTriggerRequest_Parse(t *testing.T) {
+	testcases := []struct {
+		text string
+		name string
+		as   string
+		err  string
+	}{
+		{text: "lunch", name: "lunch", as: "lunch"},
+		{text: " lunch  AS long-lunch ", name: "lunch", as: "long-lunch"},
+		{text: "", err: "Which trigger?"},
+		{text: "lunch as", err: "Which trigger?"},
+		{text: "../U2/lunch", err: "Invalid name"},
+		{text: "lunch as ../U2/lunch", err: "Invalid name"},
+		{text: "../../T2/lunch as lunch", err: "Invalid name"},
+	}
+
+	for _, tc := range testcases {
+		r := AdoptTriggerRequest{SlackPayload: SlackPayload{Text: tc.text}}
+		name, as, err := r.Parse()
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.text, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tc.text, err)
+			continue
+		}
+		if name != tc.name || as != tc.as {
+			t.Errorf("%q: expected %s as %s, got %s as %s", tc.text, tc.name, tc.as, name, as)
+		}
+	}
+}
+
+func TestLibrary_InvalidNames(t *testing.T) {
+	a := &App{Storage: NewMemoryStorage()}
+	err := a.setIdentity(Identity{SlackId: "U1", UserId: "u1", TeamId: "T1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A library entry and a trigger belonging to someone else, that a
+	// relative name could otherwise reach
+	err = a.Storage.SetBlob("library", "T2/lunch", []byte(`{"name":"lunch","author":"U2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Storage.SetBlob("triggers", "u2/lunch", []byte(`{"name":"lunch"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := SlackPayload{SlackId: "U1", TeamId: "T1"}
+
+	payload.Text = "../u2/lunch"
+	_, err = a.PublishTrigger(PublishTriggerRequest{SlackPayload: payload})
+	if err == nil || !strings.Contains(err.Error(), "Invalid name") {
+		t.Fatalf("expected publish to reject the name, got %v", err)
+	}
+
+	payload.Text = "../T2/lunch"
+	_, err = a.UnpublishTrigger(UnpublishTriggerRequest{SlackPayload: payload})
+	if err == nil || !strings.Contains(err.Error(), "Invalid name") {
+		t.Fatalf("expected unpublish to reject the name, got %v", err)
+	}
+	if _, err := a.Storage.GetBlob("library", "T2/lunch"); err != nil {
+		t.Fatalf("expected the other workspace's library to be untouched, got %v", err)
+	}
+
+	_, err = a.getLibraryEntry("T1", "../T2/lunch")
+	if err == nil || IsNotFound(err) {
+		t.Fatalf("expected the library entry name to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package slackoverload
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// revertRetryInterval is how long to wait before trying a failed revert again.
+const revertRetryInterval = 5 * time.Minute
+
+// maxRevertAttempts is how many times a revert is attempted before giving up.
+const maxRevertAttempts = 3
+
+// RevertJob puts a Slack account back to active, and ends Do Not Disturb when
+// the trigger turned it on, when a trigger's duration elapses. Slack expires
+// the status text on its own, but presence never expires. Jobs are persisted
+// so that they survive restarts.
+type RevertJob struct {
+	Id       string    `json:"id"`
+	UserId   string    `json:"user"`
+	SlackId  string    `json:"slack-id"`
+	TeamId   string    `json:"team"`
+	RevertAt time.Time `json:"revert-at"`
+	Attempts int       `json:"attempts,omitempty"`
+
+	// DnD is set when the trigger turned on Do Not Disturb, otherwise it was
+	// turned on by the user and is left alone.
+	DnD bool `json:"dnd,omitempty"`
+}
+
+func (j RevertJob) key() string {
+	return path.Join(j.UserId, j.TeamId)
+}
+
+// scheduleRevert replaces the pending revert for the workspace with one for
+// the action that was just applied. Actions without a duration don't revert,
+// so any pending revert is removed instead.
+func (a *App) scheduleRevert(userId string, slackUser SlackUser, action Action, start time.Time) error {
+	job := RevertJob{
+		Id:      uuid.New().String(),
+		UserId:  userId,
+		SlackId: slackUser.ID,
+		TeamId:  slackUser.TeamID,
+		DnD:     action.DnD,
+	}
+
+	d, err := action.ParseDuration()
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return a.cancelRevert(userId, slackUser.TeamID)
+	}
+
+	job.RevertAt = start.Add(d)
+	b, err := json.Marshal(job)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling revert job %#v", job)
+	}
+
+	return a.Storage.SetBlob("reverts", job.key(), b)
+}
+
+func (a *App) cancelRevert(userId string, teamId string) error {
+	err := a.Storage.DeleteBlob("reverts", path.Join(userId, teamId))
+	if IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (a *App) runDueReverts(t time.Time) error {
+	jobs, err := a.getRevertJobs("")
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if job.RevertAt.After(t) {
+			continue
+		}
+
+		// Claim the job by pushing the revert time out, so that only one
+		// instance runs it, and it is retried later if we don't finish
+		claimed, err := a.claimRevert(job, t)
+		if err != nil {
+			fmt.Printf("%s could not claim revert for %s on team %s: %v\n", now(), job.UserId, job.TeamId, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		err = a.revertSlackStatus(job)
+		if err != nil {
+			fmt.Printf("%s error reverting status for %s on team %s (attempt %d): %v\n", now(), job.UserId, job.TeamId, job.Attempts+1, err)
+			if job.Attempts+1 < maxRevertAttempts {
+				continue
+			}
+		}
+
+		err = a.completeRevert(job)
+		if err != nil {
+			fmt.Printf("%s could not remove revert for %s on team %s: %v\n", now(), job.UserId, job.TeamId, err)
+		}
+	}
+
+	return nil
+}
+
+func (a *App) claimRevert(job RevertJob, t time.Time) (bool, error) {
+	data, etag, err := a.Storage.GetBlobVersion("reverts", job.key())
+	if err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var current RevertJob
+	err = json.Unmarshal(data, &current)
+	if err != nil {
+		return false, errors.Wrapf(err, "error unmarshaling revert job %s", job.key())
+	}
+	if current.Id != job.Id || !current.RevertAt.Equal(job.RevertAt) {
+		// Someone else claimed it, or the status was changed again
+		return false, nil
+	}
+
+	current.RevertAt = t.Add(revertRetryInterval)
+	current.Attempts++
+	b, err := json.Marshal(current)
+	if err != nil {
+		return false, errors.Wrapf(err, "error marshaling revert job %s", job.key())
+	}
+
+	err = a.Storage.SetBlobIfMatch("reverts", job.key(), b, etag)
+	if IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// completeRevert removes the job, unless it was replaced by a newer status change.
+func (a *App) completeRevert(job RevertJob) error {
+	data, etag, err := a.Storage.GetBlobVersion("reverts", job.key())
+	if err != nil {
+		if IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	var current RevertJob
+	err = json.Unmarshal(data, &current)
+	if err != nil {
+		return errors.Wrapf(err, "error unmarshaling revert job %s", job.key())
+	}
+	if current.Id != job.Id {
+		return nil
+	}
+
+	// Only delete the version that was read, a newer status change may have replaced it since
+	err = a.Storage.DeleteBlobIfMatch("reverts", job.key(), etag)
+	if IsNotFound(err) || IsConflict(err) {
+		return nil
+	}
+	return err
+}
+
+func (a *App) revertSlackStatus(job RevertJob) error {
+	token, err := a.getSlackToken(job.SlackId)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s reverting slack status for %s (%s) on team %s\n", now(), job.UserId, job.SlackId, job.TeamId)
+
+	api := slack.New(token.AccessToken, slack.OptionDebug(a.Debug))
+
+	var g errgroup.Group
+
+	g.Go(func() error {
+		err := api.SetUserPresence(PresenceActive)
+		return errors.Wrap(err, "could not set presence")
+	})
+
+	g.Go(func() error {
+		if !job.DnD {
+			return nil
+		}
+
+		dndState, err := api.GetDNDInfo(&job.SlackId)
+		if err != nil {
+			return errors.Wrapf(err, "could not retrieve user's current DND state")
+		}
+		if dndState.SnoozeEnabled {
+			_, err = api.EndSnooze()
+			return errors.Wrap(err, "could not end do not disturb")
+		}
+		return nil
+	})
+
+	return g.Wait()
+}
+
+func (a *App) getRevertJobs(prefix string) ([]RevertJob, error) {
+	blobNames, err := a.Storage.ListContainer("reverts", prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]RevertJob, 0, len(blobNames))
+	for _, blobName := range blobNames {
+		b, err := a.Storage.GetBlob("reverts", blobName)
+		if err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		var job RevertJob
+		err = json.Unmarshal(b, &job)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling revert job %s: %s", blobName, string(b))
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
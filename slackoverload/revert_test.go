@@ -0,0 +1,203 @@
+package slackoverload
+
+import (
+	"testing"
+	"time"
+)
+
+// interruptedStorage calls interrupt once, right after a blob is read, to
+// simulate another request changing the blob in the meantime.
+type interruptedStorage struct {
+	Storage
+	interrupt func()
+}
+
+func (s *interruptedStorage) GetBlobVersion(containerName string, blobName string) ([]byte, ETag, error) {
+	data, etag, err := s.Storage.GetBlobVersion(containerName, blobName)
+	if s.interrupt != nil {
+		interrupt := s.interrupt
+		s.interrupt = nil
+		interrupt()
+	}
+	return data, etag, err
+}
+
+func getRevertJob(t *testing.T, a *App) (RevertJob, bool) {
+	jobs, err := a.getRevertJobs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) > 1 {
+		t.Fatalf("expected at most one revert job, got %#v", jobs)
+	}
+	if len(jobs) == 0 {
+		return RevertJob{}, false
+	}
+	return jobs[0], true
+}
+
+func TestScheduleRevert(t *testing.T) {
+	a := &App{Storage: NewMemoryStorage()}
+	slackUser := SlackUser{ID: "U1", TeamID: "T1"}
+	start := time.Unix(1000000, 0)
+
+	err := a.scheduleRevert("u1", slackUser, Action{Duration: "30m", DnD: true}, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, ok := getRevertJob(t, a)
+	if !ok {
+		t.Fatal("expected a revert job")
+	}
+	if job.UserId != "u1" || job.SlackId != "U1" || job.TeamId != "T1" || !job.DnD || !job.RevertAt.Equal(start.Add(30*time.Minute)) {
+		t.Fatalf("unexpected revert job %#v", job)
+	}
+
+	// A newer status change replaces the job
+	err = a.scheduleRevert("u1", slackUser, Action{Duration: "1h"}, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced, _ := getRevertJob(t, a)
+	if replaced.Id == job.Id || replaced.DnD || !replaced.RevertAt.Equal(start.Add(time.Hour)) {
+		t.Fatalf("expected the job to be replaced, got %#v", replaced)
+	}
+
+	// A status without a duration doesn't revert
+	err = a.scheduleRevert("u1", slackUser, Action{}, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, ok := getRevertJob(t, a); ok {
+		t.Fatalf("expected the pending revert to be removed, got %#v", job)
+	}
+}
+
+func TestClaimRevert(t *testing.T) {
+	a := &App{Storage: NewMemoryStorage()}
+	start := time.Unix(1000000, 0)
+	err := a.scheduleRevert("u1", SlackUser{ID: "U1", TeamID: "T1"}, Action{Duration: "30m"}, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, _ := getRevertJob(t, a)
+
+	due := start.Add(time.Hour)
+	claimed, err := a.claimRevert(job, due)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claimed {
+		t.Fatal("expected to claim the job")
+	}
+
+	claimed, err = a.claimRevert(job, due)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed {
+		t.Fatal("expected the job to only be claimed once")
+	}
+
+	current, _ := getRevertJob(t, a)
+	if current.Attempts != 1 || !current.RevertAt.Equal(due.Add(revertRetryInterval)) {
+		t.Fatalf("expected the claim to push out the revert for a retry, got %#v", current)
+	}
+}
+
+func TestCompleteRevert(t *testing.T) {
+	slackUser := SlackUser{ID: "U1", TeamID: "T1"}
+	start := time.Unix(1000000, 0)
+
+	t.Run("removes the job", func(t *testing.T) {
+		a := &App{Storage: NewMemoryStorage()}
+		if err := a.scheduleRevert("u1", slackUser, Action{Duration: "30m"}, start); err != nil {
+			t.Fatal(err)
+		}
+		job, _ := getRevertJob(t, a)
+
+		if err := a.completeRevert(job); err != nil {
+			t.Fatal(err)
+		}
+		if job, ok := getRevertJob(t, a); ok {
+			t.Fatalf("expected the job to be removed, got %#v", job)
+		}
+	})
+
+	t.Run("keeps a newer job", func(t *testing.T) {
+		a := &App{Storage: NewMemoryStorage()}
+		if err := a.scheduleRevert("u1", slackUser, Action{Duration: "30m"}, start); err != nil {
+			t.Fatal(err)
+		}
+		job, _ := getRevertJob(t, a)
+		if err := a.scheduleRevert("u1", slackUser, Action{Duration: "1h"}, start); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := a.completeRevert(job); err != nil {
+			t.Fatal(err)
+		}
+		if current, ok := getRevertJob(t, a); !ok || current.Id == job.Id {
+			t.Fatalf("expected the newer job to be kept, got %#v", current)
+		}
+	})
+
+	t.Run("keeps a job saved while completing", func(t *testing.T) {
+		s := &interruptedStorage{Storage: NewMemoryStorage()}
+		a := &App{Storage: s}
+		if err := a.scheduleRevert("u1", slackUser, Action{Duration: "30m"}, start); err != nil {
+			t.Fatal(err)
+		}
+		job, _ := getRevertJob(t, a)
+
+		// The status is changed again between reading and deleting the job
+		s.interrupt = func() {
+			if err := a.scheduleRevert("u1", slackUser, Action{Duration: "1h"}, start); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := a.completeRevert(job); err != nil {
+			t.Fatal(err)
+		}
+		if current, ok := getRevertJob(t, a); !ok || current.Id == job.Id {
+			t.Fatalf("expected the newer job to be kept, got %#v", current)
+		}
+	})
+}
+
+func TestRunDueReverts_GivesUp(t *testing.T) {
+	// There isn't a token saved for U1, so every attempt fails
+	a := &App{Storage: NewMemoryStorage(), Secrets: ChainedSecrets{}}
+	start := time.Unix(1000000, 0)
+	err := a.scheduleRevert("u1", SlackUser{ID: "U1", TeamID: "T1"}, Action{Duration: "30m"}, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Not due yet
+	if err := a.runDueReverts(start); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := getRevertJob(t, a); job.Attempts != 0 {
+		t.Fatalf("expected the job to wait until it is due, got %#v", job)
+	}
+
+	due := start.Add(30 * time.Minute)
+	for attempt := 1; attempt < maxRevertAttempts; attempt++ {
+		if err := a.runDueReverts(due); err != nil {
+			t.Fatal(err)
+		}
+		job, ok := getRevertJob(t, a)
+		if !ok || job.Attempts != attempt {
+			t.Fatalf("expected the job to be retried after attempt %d, got %#v", attempt, job)
+		}
+		due = job.RevertAt
+	}
+
+	if err := a.runDueReverts(due); err != nil {
+		t.Fatal(err)
+	}
+	if job, ok := getRevertJob(t, a); ok {
+		t.Fatalf("expected the job to be removed after %d attempts, got %#v", maxRevertAttempts, job)
+	}
+}
@@ -0,0 +1,683 @@
+package slackoverload
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+// schedulerInterval is how often the scheduler checks for schedules that are due.
+const schedulerInterval = time.Minute
+
+// scheduleGracePeriod is how late a schedule can still run, for example after
+// the app was down. Older runs are skipped instead of setting a stale status.
+const scheduleGracePeriod = 15 * time.Minute
+
+// scheduleIdPattern matches the ids generated by newScheduleId.
+var scheduleIdPattern = regexp.MustCompile(`^[0-9a-f]{8}$`)
+
+// Schedule runs a trigger on certain days of the week at a time of day.
+type Schedule struct {
+	Id      string         `json:"id"`
+	UserId  string         `json:"user"`
+	Trigger string         `json:"trigger"`
+	Days    []time.Weekday `json:"days"`
+	Hour    int            `json:"hour"`
+	Minute  int            `json:"minute"`
+
+	// Duration overrides the duration of the trigger.
+	Duration string `json:"duration,omitempty"`
+
+	// Until is when the trigger should end, such as "tomorrow" or "9am".
+	Until string `json:"until,omitempty"`
+
+	// TimeZone is the IANA time zone of the user when the schedule was created.
+	TimeZone string `json:"tz"`
+
+	NextRun time.Time `json:"next-run"`
+}
+
+var dayAbbreviations = []struct {
+	abbr string
+	day  time.Weekday
+}{
+	// Check the two letter abbreviations first so that Tu isn't read as T + u
+	{"Tu", time.Tuesday},
+	{"Th", time.Thursday},
+	{"Sa", time.Saturday},
+	{"Su", time.Sunday},
+	{"M", time.Monday},
+	{"W", time.Wednesday},
+	{"F", time.Friday},
+}
+
+func (s Schedule) Location() *time.Location {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// Next calculates the first time after the specified time that the schedule should run.
+func (s Schedule) Next(after time.Time) time.Time {
+	after = after.In(s.Location())
+	for i := 0; i <= 7; i++ {
+		day := after.AddDate(0, 0, i)
+		if !s.runsOn(day.Weekday()) {
+			continue
+		}
+
+		next := time.Date(day.Year(), day.Month(), day.Day(), s.Hour, s.Minute, 0, 0, day.Location())
+		if next.After(after) {
+			return next
+		}
+	}
+
+	// No days were selected
+	return time.Time{}
+}
+
+func (s Schedule) runsOn(day time.Weekday) bool {
+	for _, d := range s.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveDuration converts the schedule's duration or end time to a duration
+// starting at the specified time.
+func (s Schedule) ResolveDuration(start time.Time, settings Settings) (string, error) {
+	if s.Until == "" {
+		return s.Duration, nil
+	}
+
+	action, err := resolveEndTime(Action{Until: s.Until}, start.In(s.Location()), settings)
+	return action.Duration, err
+}
+
+func (s Schedule) ToString() string {
+	var days string
+	for _, day := range s.Days {
+		for _, d := range dayAbbreviations {
+			if d.day == day {
+				days += d.abbr
+				break
+			}
+		}
+	}
+
+	endText := ""
+	if s.Until != "" {
+		endText = fmt.Sprintf(" until %s", s.Until)
+	} else if s.Duration != "" {
+		endText = fmt.Sprintf(" for %s", s.Duration)
+	}
+
+	return fmt.Sprintf("%s %s %s%s", s.Trigger, days, formatClock(s.Hour, s.Minute), endText)
+}
+
+type ScheduleTriggerRequest struct {
+	SlackPayload
+}
+
+func (r ScheduleTriggerRequest) GetDefinition() string {
+	return r.Text
+}
+
+type ListSchedulesRequest struct {
+	SlackPayload
+}
+
+type DeleteScheduleRequest struct {
+	SlackPayload
+}
+
+func (r DeleteScheduleRequest) GetId() string {
+	return strings.TrimSpace(r.Text)
+}
+
+// ScheduleTrigger accepts a schedule definition and saves it
+func (a *App) ScheduleTrigger(r ScheduleTriggerRequest) (slack.Msg, error) {
+	fmt.Printf("%s /schedule-trigger %q from %s(%s) on %s(%s)\n",
+		now(), r.GetDefinition(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+
+	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
+	if err != nil {
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
+	}
+
+	schedule, err := parseSchedule(r.GetDefinition())
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	// Make sure the trigger exists so that typos are caught now instead of when it runs
+	_, err = a.getTrigger(userId, schedule.Trigger)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	schedule.Id, err = newScheduleId()
+	if err != nil {
+		return slack.Msg{}, err
+	}
+	schedule.UserId = userId
+	user, err := a.getCurrentUser(userId)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+	schedule.TimeZone = a.userLocation(user, r.SlackId).String()
+	schedule.NextRun = schedule.Next(time.Now())
+
+	err = a.setSchedule(schedule)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	msg := slack.Msg{
+		Type: slack.ResponseTypeEphemeral,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.SectionBlock{
+				Type: slack.MBTSection,
+				Text: &slack.TextBlockObject{
+					Type: slack.MarkdownType,
+					Text: fmt.Sprintf("Scheduled *%s* (%s), it will next run %s",
+						schedule.ToString(), schedule.Id, formatScheduleTime(schedule.NextRun, schedule.Location())),
+				},
+			},
+		}},
+	}
+	return msg, nil
+}
+
+func (a *App) ListSchedules(r ListSchedulesRequest) (slack.Msg, error) {
+	fmt.Printf("%s /list-schedules for %s(%s) on %s(%s)\n",
+		now(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+
+	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
+	if err != nil {
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
+	}
+
+	schedules, err := a.getSchedules(userId + "/")
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	msg := slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.SectionBlock{
+				Type: slack.MBTSection,
+				Text: &slack.TextBlockObject{
+					Type: slack.MarkdownType,
+					Text: "Here are the triggers that you have scheduled:",
+				},
+			},
+			slack.NewDividerBlock(),
+		}},
+	}
+
+	for _, schedule := range schedules {
+		scheduleBlock := slack.SectionBlock{
+			Type: slack.MBTSection,
+			Text: &slack.TextBlockObject{
+				Type: slack.MarkdownType,
+				Text: fmt.Sprintf("*Id*: %s\n*Schedule*: %s\n*Next Run*: %s",
+					schedule.Id, schedule.ToString(), formatScheduleTime(schedule.NextRun, schedule.Location())),
+			},
+		}
+		msg.Blocks.BlockSet = append(msg.Blocks.BlockSet, scheduleBlock)
+	}
+
+	return msg, nil
+}
+
+func (a *App) DeleteSchedule(r DeleteScheduleRequest) (slack.Msg, error) {
+	fmt.Printf("%s /delete-schedule %s from %s(%s) on %s(%s)\n",
+		now(), r.GetId(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+
+	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
+	if err != nil {
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
+	}
+
+	if !scheduleIdPattern.MatchString(r.GetId()) {
+		return slack.Msg{}, errors.Errorf("Invalid schedule id %q. Use /list-schedules to find its id.", r.GetId())
+	}
+
+	key := path.Join(userId, r.GetId())
+	err = a.Storage.DeleteBlob("schedules", key)
+	if err != nil {
+		if IsNotFound(err) {
+			return slack.Msg{}, errors.Errorf("Could not delete schedule %q because it is not defined. Use /list-schedules to find its id.", r.GetId())
+		}
+		return slack.Msg{}, err
+	}
+
+	msg := slack.Msg{
+		Type: slack.ResponseTypeEphemeral,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.SectionBlock{
+				Type: slack.MBTSection,
+				Text: &slack.TextBlockObject{
+					Type: slack.MarkdownType,
+					Text: fmt.Sprintf("Deleted schedule *%s*", r.GetId()),
+				},
+			},
+		}},
+	}
+
+	return msg, nil
+}
+
+// RunScheduler runs scheduled triggers, the next steps of triggers and status
+// reverts when they are due, until the process exits.
+func (a *App) RunScheduler() {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for t := range ticker.C {
+		err := a.runDueSchedules(t)
+		if err != nil {
+			fmt.Printf("%s scheduler error: %v\n", now(), err)
+		}
+
+		// Run the next steps before reverting the steps that just ended
+		err = a.runDueSequences(t)
+		if err != nil {
+			fmt.Printf("%s sequence error: %v\n", now(), err)
+		}
+
+		err = a.runDueReverts(t)
+		if err != nil {
+			fmt.Printf("%s revert error: %v\n", now(), err)
+		}
+	}
+}
+
+func (a *App) runDueSchedules(t time.Time) error {
+	schedules, err := a.getSchedules("")
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		if schedule.NextRun.IsZero() || schedule.NextRun.After(t) {
+			continue
+		}
+
+		// Claim the run by moving the next run time forward, so that when
+		// multiple instances are running only one fires the trigger
+		claimed, err := a.claimScheduleRun(schedule, t)
+		if err != nil {
+			fmt.Printf("%s could not claim schedule %s for %s: %v\n", now(), schedule.Id, schedule.UserId, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		// The claim moved the next run forward, so a missed run is skipped
+		if t.Sub(schedule.NextRun) > scheduleGracePeriod {
+			fmt.Printf("%s skipping schedule %s for %s, it was due at %s\n", now(), schedule.Id, schedule.UserId, schedule.NextRun.Format(time.RFC3339))
+			continue
+		}
+
+		err = a.runSchedule(schedule, t)
+		if err != nil {
+			fmt.Printf("%s error running schedule %s for %s: %v\n", now(), schedule.Id, schedule.UserId, err)
+		}
+	}
+
+	return nil
+}
+
+func (a *App) claimScheduleRun(schedule Schedule, t time.Time) (bool, error) {
+	key := path.Join(schedule.UserId, schedule.Id)
+	data, etag, err := a.Storage.GetBlobVersion("schedules", key)
+	if err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var current Schedule
+	err = json.Unmarshal(data, &current)
+	if err != nil {
+		return false, errors.Wrapf(err, "error unmarshaling schedule %s", key)
+	}
+	if !current.NextRun.Equal(schedule.NextRun) {
+		// Someone else already ran it
+		return false, nil
+	}
+
+	current.NextRun = current.Next(t)
+	b, err := json.Marshal(current)
+	if err != nil {
+		return false, errors.Wrapf(err, "error marshaling schedule %s", key)
+	}
+
+	err = a.Storage.SetBlobIfMatch("schedules", key, b, etag)
+	if IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (a *App) runSchedule(schedule Schedule, t time.Time) error {
+	fmt.Printf("%s running schedule %s (%s) for %s\n", now(), schedule.Id, schedule.ToString(), schedule.UserId)
+
+	tmpl, err := a.getTrigger(schedule.UserId, schedule.Trigger)
+	if err != nil {
+		return err
+	}
+
+	user, err := a.getCurrentUser(schedule.UserId)
+	if err != nil {
+		return err
+	}
+
+	duration, err := schedule.ResolveDuration(t, user.Settings)
+	if err != nil {
+		return err
+	}
+
+	steps, err := expandTriggerSteps(tmpl, a.triggerLookup(schedule.UserId))
+	if err != nil {
+		return err
+	}
+
+	overrides := TriggerOverrides{Duration: duration}
+	action, _ := overrides.Apply(steps[0])
+	action, err = resolveEndTime(action, t.In(schedule.Location()), user.Settings)
+	if err != nil {
+		return err
+	}
+
+	run := triggerRun{Start: t, Location: schedule.Location()}
+	err = a.applyActionToSlacks(schedule.UserId, tmpl.ScopeTeamId(), action, run)
+	if err != nil {
+		return err
+	}
+
+	if len(steps) > 1 {
+		d, _ := action.ParseDuration()
+		return a.startSequence(schedule.UserId, run, tmpl, steps, t.Add(d))
+	}
+	return a.cancelReplacedSequences(schedule.UserId, tmpl.ScopeTeamId())
+}
+
+// updateScheduleTimeZones moves the user's schedules to a new time zone, so
+// that they keep running at the same time of day.
+func (a *App) updateScheduleTimeZones(userId string, loc *time.Location) error {
+	schedules, err := a.getSchedules(userId + "/")
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		if schedule.TimeZone == loc.String() {
+			continue
+		}
+
+		schedule.TimeZone = loc.String()
+		schedule.NextRun = schedule.Next(time.Now())
+		err = a.setSchedule(schedule)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *App) getSchedules(prefix string) ([]Schedule, error) {
+	blobNames, err := a.Storage.ListContainer("schedules", prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := make([]Schedule, 0, len(blobNames))
+	for _, blobName := range blobNames {
+		b, err := a.Storage.GetBlob("schedules", blobName)
+		if err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		var schedule Schedule
+		err = json.Unmarshal(b, &schedule)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling schedule %s: %s", blobName, string(b))
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, nil
+}
+
+// newScheduleId generates a short id that is easy to type in /delete-schedule.
+func newScheduleId() (string, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", errors.Wrap(err, "error generating schedule id")
+	}
+	return strings.Split(id.String(), "-")[0], nil
+}
+
+func (a *App) setSchedule(schedule Schedule) error {
+	b, err := json.Marshal(schedule)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling schedule %#v", schedule)
+	}
+
+	key := path.Join(schedule.UserId, schedule.Id)
+	return a.Storage.SetBlob("schedules", key, b)
+}
+
+const (
+	// timeZoneCacheTTL is how long the time zone from a user's Slack profile
+	// is remembered, so that changing it is picked up within the hour.
+	timeZoneCacheTTL = time.Hour
+
+	// timeZoneCacheSize is how many users' time zones are remembered.
+	timeZoneCacheSize = 10000
+)
+
+// lookupTimeZone returns the time zone from the user's Slack profile,
+// falling back to the server's time zone when it isn't available.
+func (a *App) lookupTimeZone(slackId string) *time.Location {
+	if a.timeZones != nil {
+		if loc, ok := a.timeZones.get(slackId); ok {
+			return loc.(*time.Location)
+		}
+	}
+
+	token, err := a.getSlackToken(slackId)
+	if err != nil {
+		fmt.Printf("%s Could not look up the time zone for %s, using %s instead: %v\n", now(), slackId, time.Local, err)
+		return time.Local
+	}
+
+	api := slack.New(token.AccessToken, slack.OptionDebug(a.Debug))
+	info, err := api.GetUserInfo(slackId)
+	if err != nil {
+		// Accounts linked before we asked for users:read need to run /link-slack again
+		fmt.Printf("%s Could not look up the time zone for %s, using %s instead: %v\n", now(), slackId, time.Local, err)
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(info.TZ)
+	if err != nil || info.TZ == "" {
+		fmt.Printf("%s Could not load the time zone %q for %s, using %s instead: %v\n", now(), info.TZ, slackId, time.Local, err)
+		return time.Local
+	}
+
+	if a.timeZones != nil {
+		a.timeZones.set(slackId, loc)
+	}
+	return loc
+}
+
+// parseSchedule definition into a Schedule
+// Example:
+// off-work MTuWTh 5pm until tomorrow
+// trigger = off-work
+// days = Monday, Tuesday, Wednesday, Thursday
+// time = 17:00
+// until = tomorrow
+func parseSchedule(def string) (Schedule, error) {
+	const usage = "Try /schedule-trigger off-work MTuWTh 5pm until tomorrow, or /schedule-trigger lunch weekdays 12pm for 1h"
+
+	fields := strings.Fields(def)
+	if len(fields) < 3 {
+		return Schedule{}, errors.Errorf("Invalid schedule %q. %s", def, usage)
+	}
+
+	if err := validateTriggerName(fields[0]); err != nil {
+		return Schedule{}, errors.Errorf("%s. %s", err, usage)
+	}
+
+	days, err := parseDays(fields[1])
+	if err != nil {
+		return Schedule{}, errors.Errorf("%s. %s", err, usage)
+	}
+
+	hour, minute, err := parseClock(fields[2])
+	if err != nil {
+		return Schedule{}, errors.Errorf("%s. %s", err, usage)
+	}
+
+	schedule := Schedule{
+		Trigger: fields[0],
+		Days:    days,
+		Hour:    hour,
+		Minute:  minute,
+	}
+
+	rest := fields[3:]
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 2 && strings.EqualFold(rest[0], "for"):
+		schedule.Duration = rest[1]
+		_, err := Action{Duration: schedule.Duration}.ParseDuration()
+		if err != nil {
+			return Schedule{}, errors.Errorf("invalid duration %q, here are some examples: 15m, 1h30m, 2d, 1w", schedule.Duration)
+		}
+	case len(rest) >= 2 && strings.EqualFold(rest[0], "until"):
+		schedule.Until = strings.Join(rest[1:], " ")
+		if _, err := parseEndTime(schedule.Until); err != nil {
+			return Schedule{}, err
+		}
+	default:
+		return Schedule{}, errors.Errorf("Invalid schedule %q. %s", def, usage)
+	}
+
+	return schedule, nil
+}
+
+// parseDays converts days of the week, such as MTuWTh, into weekdays.
+// The shortcuts daily, weekdays and weekends are also supported.
+func parseDays(value string) ([]time.Weekday, error) {
+	switch strings.ToLower(value) {
+	case "daily":
+		return []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}, nil
+	case "weekdays":
+		return []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, nil
+	case "weekends":
+		return []time.Weekday{time.Saturday, time.Sunday}, nil
+	}
+
+	var days []time.Weekday
+	remaining := value
+	for remaining != "" {
+		found := false
+		for _, d := range dayAbbreviations {
+			if strings.HasPrefix(remaining, d.abbr) {
+				days = append(days, d.day)
+				remaining = remaining[len(d.abbr):]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("invalid days %q, use M, Tu, W, Th, F, Sa, Su, for example MWF", value)
+		}
+	}
+
+	return days, nil
+}
+
+var clockPattern = regexp.MustCompile(`(?i)^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+
+// parseClock converts a time of day, such as 5pm, 5:30pm or 17:30, into hours and minutes.
+func parseClock(value string) (int, int, error) {
+	match := clockPattern.FindStringSubmatch(value)
+	if len(match) == 0 {
+		return 0, 0, errors.Errorf("invalid time %q, here are some examples: 9am, 5:30pm, 17:30", value)
+	}
+
+	hour, _ := strconv.Atoi(match[1])
+	minute := 0
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+
+	switch strings.ToLower(match[3]) {
+	case "am":
+		if hour < 1 || hour > 12 {
+			return 0, 0, errors.Errorf("invalid time %q, the hour must be between 1 and 12", value)
+		}
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 1 || hour > 12 {
+			return 0, 0, errors.Errorf("invalid time %q, the hour must be between 1 and 12", value)
+		}
+		if hour != 12 {
+			hour += 12
+		}
+	}
+
+	if hour > 23 || minute > 59 {
+		return 0, 0, errors.Errorf("invalid time %q", value)
+	}
+
+	return hour, minute, nil
+}
+
+func formatClock(hour int, minute int) string {
+	return time.Date(2000, 1, 1, hour, minute, 0, 0, time.UTC).Format("3:04pm")
+}
+
+func formatScheduleTime(t time.Time, loc *time.Location) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.In(loc).Format("Mon Jan 2 3:04pm MST")
+}
@@ -0,0 +1,95 @@
+package slackoverload
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeleteSchedule_InvalidId(t *testing.T) {
+	a := &App{Storage: NewMemoryStorage()}
+	err := a.setIdentity(Identity{SlackId: "U1", UserId: "u1", TeamId: "T1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.setSchedule(Schedule{Id: "0a1b2c3d", UserId: "u2", Trigger: "lunch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"../u2/0a1b2c3d", "0a1b2c3d/..", "lunch", ""} {
+		r := DeleteScheduleRequest{SlackPayload: SlackPayload{SlackId: "U1", TeamId: "T1", Text: id}}
+		_, err := a.DeleteSchedule(r)
+		if err == nil || !strings.Contains(err.Error(), "Invalid schedule id") {
+			t.Errorf("%q: expected the id to be rejected, got %v", id, err)
+		}
+	}
+
+	schedules, err := a.getSchedules("u2/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedules) != 1 {
+		t.Fatalf("expected the other user's schedule to be untouched, got %v", schedules)
+	}
+}
+
+func TestRunDueSchedules_GracePeriod(t *testing.T) {
+	a := &App{Storage: NewMemoryStorage()}
+	tmpl, err := parseTemplate(`focus = heads down for 1h then "back"`, Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.updateTrigger("u1", tmpl.Name, func(existing *ActionTemplate) error {
+		*existing = tmpl
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	daily := []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}
+	due := time.Date(2020, time.March, 2, 9, 0, 0, 0, time.UTC)
+	testcases := []struct {
+		name string
+		late time.Duration
+		runs bool
+	}{
+		{"on time", 0, true},
+		{"late", scheduleGracePeriod, true},
+		{"missed", scheduleGracePeriod + time.Minute, false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			a.cancelSequences("u1", "")
+			schedule := Schedule{Id: "0a1b2c3d", UserId: "u1", Trigger: "focus", Days: daily, Hour: 9, TimeZone: "UTC", NextRun: due}
+			err := a.setSchedule(schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = a.runDueSchedules(due.Add(tc.late))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Running the trigger starts its next step
+			sequences, err := a.getSequences("u1/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ran := len(sequences) > 0; ran != tc.runs {
+				t.Fatalf("expected the schedule to run: %t, but it ran: %t", tc.runs, ran)
+			}
+
+			schedules, err := a.getSchedules("u1/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := due.AddDate(0, 0, 1); len(schedules) != 1 || !schedules[0].NextRun.Equal(want) {
+				t.Fatalf("expected the next run to be %s, got %v", want, schedules)
+			}
+		})
+	}
+}
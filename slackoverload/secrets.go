@@ -1,73 +1,128 @@
 package slackoverload
 
 import (
-	"context"
-	"time"
+	"fmt"
 
-	"github.com/Azure/azure-sdk-for-go/services/keyvault/v7.0/keyvault"
 	"github.com/pkg/errors"
 )
 
-const vaultURL = "https://slackoverload.vault.azure.net"
+const (
+	SecretsKeyVault = "keyvault"
+	SecretsVault    = "vault"
+	SecretsLocal    = "local"
+)
 
-type Secrets struct {
-	Client keyvault.BaseClient
-}
+// Secrets stores sensitive values, such as oauth tokens, along with optional
+// tags that describe the value.
+type Secrets interface {
+	// GetSecret returns the value and tags of a secret, or a SecretNotFoundError when it doesn't exist.
+	GetSecret(key string) (string, map[string]*string, error)
 
-func NewSecretsClient() (Secrets, error) {
-	authorizer, err := getAzureAuth("https://vault.azure.net")
-	if err != nil {
-		return Secrets{}, err
-	}
+	// SetSecret creates or overwrites a secret.
+	SetSecret(key string, value string, tags map[string]*string) error
+}
 
-	client := keyvault.New()
-	client.Authorizer = authorizer
+// SecretLister is implemented by secrets backends that can list the names
+// of the secrets that they hold.
+type SecretLister interface {
+	// ListSecrets returns the names of the secrets that start with prefix.
+	ListSecrets(prefix string) ([]string, error)
+}
 
-	return Secrets{Client: client}, nil
+// NewSecrets creates the secrets backend with the specified name.
+// The directory is only used by the local backend.
+func NewSecrets(backend string, dir string) (Secrets, error) {
+	switch backend {
+	case SecretsKeyVault, "":
+		return NewSecretsClient()
+	case SecretsVault:
+		return NewVaultSecretsFromEnvironment()
+	case SecretsLocal:
+		return NewLocalSecrets(dir)
+	default:
+		return nil, errors.Errorf("unsupported secrets backend %q, must be one of: %s, %s, %s",
+			backend, SecretsKeyVault, SecretsVault, SecretsLocal)
+	}
 }
 
-func (s *Secrets) GetSlackSigningSecret() (string, error) {
+func GetSlackSigningSecret(s Secrets) (string, error) {
 	value, _, err := s.GetSecret("slack-signing-secret")
 	return value, err
 }
 
-func (s *Secrets) GetSessionKey() (string, error) {
+func GetSessionKey(s Secrets) (string, error) {
 	value, _, err := s.GetSecret("session-key")
 	return value, err
 }
 
-func (s *Secrets) GetSlackClientId() (string, error) {
+func GetSlackClientId(s Secrets) (string, error) {
 	value, _, err := s.GetSecret("slack-client-id")
 	return value, err
 }
 
-func (s *Secrets) GetSlackClientSecret() (string, error) {
+func GetSlackClientSecret(s Secrets) (string, error) {
 	value, _, err := s.GetSecret("slack-client-secret")
 	return value, err
 }
 
-func (s *Secrets) GetSecret(key string) (string, map[string]*string, error) {
-	cxt, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	result, err := s.Client.GetSecret(cxt, vaultURL, key, "")
-	if err != nil {
-		defer cancel()
-		return "", nil, errors.Wrapf(err, "could not load secret %q from vault", key)
+// GetSlackAppToken returns the app-level token used to connect with Socket Mode.
+func GetSlackAppToken(s Secrets) (string, error) {
+	value, _, err := s.GetSecret("slack-app-token")
+	return value, err
+}
+
+// SecretNotFoundError is returned when the requested secret does not exist.
+type SecretNotFoundError struct {
+	Key string
+}
+
+func (e SecretNotFoundError) Error() string {
+	return fmt.Sprintf("secret %q not found", e.Key)
+}
+
+func (e SecretNotFoundError) NotFound() bool {
+	return true
+}
+
+// ChainedSecrets looks up a secret in each provider in order, returning the
+// first one found. New secrets are always saved to the last provider.
+type ChainedSecrets []Secrets
+
+func (c ChainedSecrets) GetSecret(key string) (string, map[string]*string, error) {
+	for _, s := range c {
+		value, tags, err := s.GetSecret(key)
+		if IsNotFound(err) {
+			continue
+		}
+		return value, tags, err
 	}
 
-	return *result.Value, result.Tags, nil
+	return "", nil, SecretNotFoundError{Key: key}
 }
 
-func (s *Secrets) SetSecret(key string, value string, tags map[string]*string) error {
-	// Timebox getting the secret because a bad client or auth will hang forever
-	cxt, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	_, err := s.Client.SetSecret(cxt, vaultURL, key, keyvault.SecretSetParameters{
-		Value: &value,
-		Tags:  tags,
-	})
-	if err != nil {
-		defer cancel()
-		return errors.Wrapf(err, "error saving secret %s", key)
+func (c ChainedSecrets) SetSecret(key string, value string, tags map[string]*string) error {
+	if len(c) == 0 {
+		return errors.Errorf("cannot save secret %s, no secrets providers are configured", key)
+	}
+
+	return c[len(c)-1].SetSecret(key, value, tags)
+}
+
+// ListSecrets combines the secrets listed by each provider that supports listing.
+func (c ChainedSecrets) ListSecrets(prefix string) ([]string, error) {
+	var keys []string
+	for _, s := range c {
+		lister, ok := s.(SecretLister)
+		if !ok {
+			continue
+		}
+
+		results, err := lister.ListSecrets(prefix)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, results...)
 	}
 
-	return nil
+	return keys, nil
 }
@@ -0,0 +1,88 @@
+package slackoverload
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/keyvault/v7.0/keyvault"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/pkg/errors"
+)
+
+const vaultURL = "https://slackoverload.vault.azure.net"
+
+// KeyVaultSecrets stores secrets in Azure Key Vault.
+type KeyVaultSecrets struct {
+	Client   keyvault.BaseClient
+	VaultURL string
+}
+
+func NewSecretsClient() (*KeyVaultSecrets, error) {
+	authorizer, err := getAzureAuth("https://vault.azure.net")
+	if err != nil {
+		return nil, err
+	}
+
+	client := keyvault.New()
+	client.Authorizer = authorizer
+
+	return &KeyVaultSecrets{Client: client, VaultURL: vaultURL}, nil
+}
+
+func (s *KeyVaultSecrets) GetSecret(key string) (string, map[string]*string, error) {
+	cxt, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := s.Client.GetSecret(cxt, s.VaultURL, key, "")
+	if err != nil {
+		if derr, ok := err.(autorest.DetailedError); ok && derr.StatusCode == http.StatusNotFound {
+			return "", nil, SecretNotFoundError{Key: key}
+		}
+		return "", nil, errors.Wrapf(err, "could not load secret %q from vault", key)
+	}
+
+	return *result.Value, result.Tags, nil
+}
+
+func (s *KeyVaultSecrets) SetSecret(key string, value string, tags map[string]*string) error {
+	// Timebox getting the secret because a bad client or auth will hang forever
+	cxt, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	_, err := s.Client.SetSecret(cxt, s.VaultURL, key, keyvault.SecretSetParameters{
+		Value: &value,
+		Tags:  tags,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error saving secret %s", key)
+	}
+
+	return nil
+}
+
+func (s *KeyVaultSecrets) ListSecrets(prefix string) ([]string, error) {
+	cxt, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var keys []string
+	page, err := s.Client.GetSecrets(cxt, s.VaultURL, nil)
+	for ; err == nil && page.NotDone(); err = page.NextWithContext(cxt) {
+		for _, item := range page.Values() {
+			if item.ID == nil {
+				continue
+			}
+
+			// The id is the secret's url, https://VAULT/secrets/NAME
+			key := path.Base(*item.ID)
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list secrets in vault")
+	}
+
+	return keys, nil
+}
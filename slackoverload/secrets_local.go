@@ -0,0 +1,209 @@
+package slackoverload
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SecretsKeyEnvVar is the environment variable holding the key used to
+// encrypt secrets saved by the local secrets backend. It must be 32 random
+// bytes, base64 encoded, for example: openssl rand -base64 32
+const SecretsKeyEnvVar = "SLACKOVERLOAD_SECRETS_KEY"
+
+// secretsKeySize is the size of the AES-256 key used to encrypt local secrets.
+const secretsKeySize = 32
+
+// NewLocalSecrets reads app configuration, such as the signing secret and session
+// key, from environment variables or files in dir, and saves per-user tokens
+// encrypted in dir/tokens.
+func NewLocalSecrets(dir string) (ChainedSecrets, error) {
+	if dir == "" {
+		return nil, errors.New("a directory is required for the local secrets backend")
+	}
+
+	encodedKey := os.Getenv(SecretsKeyEnvVar)
+	if encodedKey == "" {
+		return nil, errors.Errorf("%s must be set to use the local secrets backend", SecretsKeyEnvVar)
+	}
+
+	key, err := parseSecretsKey(encodedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := NewEncryptedFileSecrets(filepath.Join(dir, "tokens"), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ChainedSecrets{StaticSecrets{Dir: dir}, tokens}, nil
+}
+
+// parseSecretsKey decodes the base64 encoded key for the local secrets backend.
+// A passphrase isn't accepted, the key is used as is so it must be random.
+func parseSecretsKey(encodedKey string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil || len(key) != secretsKeySize {
+		return nil, errors.Errorf("%s must be %d random bytes, base64 encoded. Generate one with: openssl rand -base64 %d",
+			SecretsKeyEnvVar, secretsKeySize, secretsKeySize)
+	}
+	return key, nil
+}
+
+// StaticSecrets is a read-only provider for secrets that are defined when
+// the app is deployed. The secret named "slack-signing-secret" is read from
+// the environment variable SLACKOVERLOAD_SLACK_SIGNING_SECRET, or when that
+// isn't set, from the file DIR/slack-signing-secret.
+type StaticSecrets struct {
+	Dir string
+}
+
+func (s StaticSecrets) GetSecret(key string) (string, map[string]*string, error) {
+	envVar := "SLACKOVERLOAD_" + strings.ToUpper(strings.Replace(key, "-", "_", -1))
+	if value, ok := os.LookupEnv(envVar); ok {
+		return value, nil, nil
+	}
+
+	if s.Dir == "" || strings.ContainsAny(key, `/\`) {
+		return "", nil, SecretNotFoundError{Key: key}
+	}
+
+	value, err := ioutil.ReadFile(filepath.Join(s.Dir, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, SecretNotFoundError{Key: key}
+		}
+		return "", nil, errors.Wrapf(err, "could not load secret %q", key)
+	}
+
+	return strings.TrimSpace(string(value)), nil, nil
+}
+
+func (s StaticSecrets) SetSecret(key string, value string, tags map[string]*string) error {
+	return errors.Errorf("cannot save secret %s, static secrets are read-only", key)
+}
+
+// EncryptedFileSecrets saves each secret to a file, encrypted with AES-GCM.
+type EncryptedFileSecrets struct {
+	Dir  string
+	aead cipher.AEAD
+}
+
+type encryptedFileSecret struct {
+	Value string             `json:"value"`
+	Tags  map[string]*string `json:"tags,omitempty"`
+}
+
+// NewEncryptedFileSecrets saves secrets to dir, encrypted with a random 32 byte key.
+func NewEncryptedFileSecrets(dir string, key []byte) (*EncryptedFileSecrets, error) {
+	if len(key) != secretsKeySize {
+		return nil, errors.Errorf("the secrets key must be %d bytes, got %d", secretsKeySize, len(key))
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating secrets directory %s", dir)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating secrets cipher")
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating secrets cipher")
+	}
+
+	return &EncryptedFileSecrets{Dir: dir, aead: aead}, nil
+}
+
+func (s *EncryptedFileSecrets) GetSecret(key string) (string, map[string]*string, error) {
+	secretPath, err := s.buildPath(key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := ioutil.ReadFile(secretPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, SecretNotFoundError{Key: key}
+		}
+		return "", nil, errors.Wrapf(err, "could not load secret %q", key)
+	}
+
+	nonceSize := s.aead.NonceSize()
+	if len(data) < nonceSize {
+		return "", nil, errors.Errorf("could not decrypt secret %q, the file is corrupt", key)
+	}
+
+	// Bind the ciphertext to the key so that files cannot be swapped
+	plaintext, err := s.aead.Open(nil, data[:nonceSize], data[nonceSize:], []byte(key))
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "could not decrypt secret %q", key)
+	}
+
+	var secret encryptedFileSecret
+	err = json.Unmarshal(plaintext, &secret)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "error parsing secret %q", key)
+	}
+
+	return secret.Value, secret.Tags, nil
+}
+
+func (s *EncryptedFileSecrets) SetSecret(key string, value string, tags map[string]*string) error {
+	secretPath, err := s.buildPath(key)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(encryptedFileSecret{Value: value, Tags: tags})
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling secret %s", key)
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return errors.Wrapf(err, "error generating nonce for secret %s", key)
+	}
+
+	data := s.aead.Seal(nonce, nonce, plaintext, []byte(key))
+	err = ioutil.WriteFile(secretPath, data, 0600)
+	return errors.Wrapf(err, "error saving secret %s", key)
+}
+
+func (s *EncryptedFileSecrets) ListSecrets(prefix string) ([]string, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not list secrets in %s", s.Dir)
+	}
+
+	var keys []string
+	for _, file := range files {
+		if !file.IsDir() && strings.HasPrefix(file.Name(), prefix) {
+			keys = append(keys, file.Name())
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *EncryptedFileSecrets) buildPath(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", errors.Errorf("invalid secret name %q", key)
+	}
+
+	return filepath.Join(s.Dir, key), nil
+}
@@ -0,0 +1,340 @@
+package slackoverload
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedFileSecrets(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewEncryptedFileSecrets(dir, newSecretsKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	team := "T1"
+	tags := map[string]*string{"team": &team}
+	err = s.SetSecret("U1-token", "xoxp-secret", tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		value, gotTags, err := s.GetSecret("U1-token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != "xoxp-secret" {
+			t.Fatalf("expected xoxp-secret, got %q", value)
+		}
+		if !reflect.DeepEqual(tags, gotTags) {
+			t.Fatalf("expected tags %v, got %v", tags, gotTags)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "U1-token"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("xoxp-secret")) {
+			t.Fatal("the secret was saved in plain text")
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, _, err := s.GetSecret("U2-token")
+		if !IsNotFound(err) {
+			t.Fatalf("expected a not found error, got %v", err)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "U1-token"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-1] ^= 1
+		err = ioutil.WriteFile(filepath.Join(dir, "tampered"), data, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = s.GetSecret("tampered")
+		if err == nil || IsNotFound(err) {
+			t.Fatalf("expected tampered ciphertext to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("swapped", func(t *testing.T) {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "U1-token"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, "U2-token"), data, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = s.GetSecret("U2-token")
+		if err == nil || IsNotFound(err) {
+			t.Fatalf("expected a secret copied to another key to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		other, err := NewEncryptedFileSecrets(dir, newSecretsKey(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = other.GetSecret("U1-token")
+		if err == nil || IsNotFound(err) {
+			t.Fatalf("expected the wrong key to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		err := s.SetSecret("../U1-token", "xoxp-secret", nil)
+		if err == nil {
+			t.Fatal("expected a secret name with a path to be rejected")
+		}
+	})
+}
+
+func newSecretsKey(t *testing.T) []byte {
+	key := make([]byte, secretsKeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestNewLocalSecrets_Key(t *testing.T) {
+	testcases := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "random key", key: base64.StdEncoding.EncodeToString(newSecretsKey(t))},
+		{name: "missing", key: "", wantErr: true},
+		{name: "passphrase", key: "correct horse battery staple", wantErr: true},
+		{name: "short key", key: base64.StdEncoding.EncodeToString([]byte("too short")), wantErr: true},
+		{name: "long key", key: base64.StdEncoding.EncodeToString(make([]byte, 64)), wantErr: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(SecretsKeyEnvVar, tc.key)
+			_, err := NewLocalSecrets(t.TempDir())
+			if tc.wantErr && err == nil {
+				t.Fatal("expected the key to be rejected")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestStaticSecrets(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "slack-signing-secret"), []byte("from-file\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "session-key"), []byte("file-session-key"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SLACKOVERLOAD_SESSION_KEY", "env-session-key")
+
+	s := StaticSecrets{Dir: dir}
+
+	value, err := GetSlackSigningSecret(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "from-file" {
+		t.Fatalf("expected the secret from the file, got %q", value)
+	}
+
+	value, err = GetSessionKey(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "env-session-key" {
+		t.Fatalf("expected the environment variable to take precedence over the file, got %q", value)
+	}
+
+	_, err = GetSlackClientId(s)
+	if !IsNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+
+	_, _, err = s.GetSecret("../slack-signing-secret")
+	if !IsNotFound(err) {
+		t.Fatalf("expected a secret name with a path to be ignored, got %v", err)
+	}
+
+	err = s.SetSecret("session-key", "new", nil)
+	if err == nil {
+		t.Fatal("expected static secrets to be read-only")
+	}
+}
+
+func TestChainedSecrets(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "slack-client-secret"), []byte("static-client-secret"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := NewEncryptedFileSecrets(filepath.Join(dir, "tokens"), newSecretsKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tokens.SetSecret("slack-client-secret", "shadowed", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := ChainedSecrets{StaticSecrets{Dir: dir}, tokens}
+
+	value, err := GetSlackClientSecret(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "static-client-secret" {
+		t.Fatalf("expected the first provider to win, got %q", value)
+	}
+
+	err = s.SetSecret("U1-token", "xoxp-secret", nil)
+	if err != nil {
+		t.Fatalf("expected the secret to be saved to the last provider, got %v", err)
+	}
+	value, _, err = s.GetSecret("U1-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "xoxp-secret" {
+		t.Fatalf("expected to fall through to the last provider, got %q", value)
+	}
+
+	_, _, err = s.GetSecret("U2-token")
+	if !IsNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+
+	keys, err := s.ListSecrets("U1-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string{"U1-token"}, keys) {
+		t.Fatalf("expected [U1-token], got %v", keys)
+	}
+
+	err = ChainedSecrets{}.SetSecret("U1-token", "xoxp-secret", nil)
+	if err == nil {
+		t.Fatal("expected an error saving without any providers")
+	}
+}
+
+func TestVaultSecrets(t *testing.T) {
+	stored := map[string]vaultSecretData{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.test" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		const dataPath = "/v1/kv/data/slackoverload/"
+		switch {
+		case r.Method == "LIST" && r.URL.EscapedPath() == "/v1/kv/metadata/slackoverload":
+			var result vaultListResponse
+			for key := range stored {
+				result.Data.Keys = append(result.Data.Keys, key)
+			}
+			result.Data.Keys = append(result.Data.Keys, "folder/")
+			json.NewEncoder(w).Encode(result)
+		case strings.HasPrefix(r.URL.EscapedPath(), dataPath):
+			key := strings.TrimPrefix(r.URL.EscapedPath(), dataPath)
+			switch r.Method {
+			case http.MethodGet:
+				secret, ok := stored[key]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"errors":[]}`))
+					return
+				}
+				var result vaultReadResponse
+				result.Data.Data = secret
+				json.NewEncoder(w).Encode(result)
+			case http.MethodPost:
+				var request vaultWriteRequest
+				err := json.NewDecoder(r.Body).Decode(&request)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				stored[key] = request.Data
+				w.WriteHeader(http.StatusNoContent)
+			}
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.EscapedPath())
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	s := &VaultSecrets{
+		Address: srv.URL + "/",
+		Token:   "s.test",
+		Mount:   "kv",
+		Prefix:  "slackoverload",
+		Client:  srv.Client(),
+	}
+
+	team := "T1"
+	err := s.SetSecret("U1/T1 token", "xoxp-secret", map[string]*string{"team": &team})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stored["U1%2FT1%20token"]; !ok {
+		t.Fatalf("expected the key to be escaped in the secret path, got %v", stored)
+	}
+
+	value, tags, err := s.GetSecret("U1/T1 token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "xoxp-secret" || tags["team"] == nil || *tags["team"] != "T1" {
+		t.Fatalf("expected the secret with its tags, got %q %v", value, tags)
+	}
+
+	_, _, err = s.GetSecret("missing")
+	if !IsNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+
+	keys, err := s.ListSecrets("U1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string{"U1%2FT1%20token"}, keys) {
+		t.Fatalf("expected the secret and not the folder, got %v", keys)
+	}
+
+	s.Token = "s.wrong"
+	_, _, err = s.GetSecret("U1/T1 token")
+	if err == nil || IsNotFound(err) {
+		t.Fatalf("expected the wrong token to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package slackoverload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VaultSecrets stores secrets in a HashiCorp Vault KV version 2 secrets engine.
+type VaultSecrets struct {
+	// Address of the Vault server, for example http://127.0.0.1:8200.
+	Address string
+
+	// Token used to authenticate with Vault.
+	Token string
+
+	// Mount is the path where the KV secrets engine is mounted.
+	Mount string
+
+	// Prefix is prepended to the path of every secret.
+	Prefix string
+
+	Client *http.Client
+}
+
+type vaultSecretData struct {
+	Value string             `json:"value"`
+	Tags  map[string]*string `json:"tags,omitempty"`
+}
+
+type vaultReadResponse struct {
+	Data struct {
+		Data vaultSecretData `json:"data"`
+	} `json:"data"`
+}
+
+type vaultWriteRequest struct {
+	Data vaultSecretData `json:"data"`
+}
+
+type vaultListResponse struct {
+	Data struct {
+		Keys []string `json:"keys"`
+	} `json:"data"`
+}
+
+type vaultErrorResponse struct {
+	Errors []string `json:"errors"`
+}
+
+// NewVaultSecretsFromEnvironment configures a Vault client using the standard
+// VAULT_ADDR and VAULT_TOKEN environment variables. The KV mount defaults
+// to "secret" and can be changed with VAULT_KV_MOUNT.
+func NewVaultSecretsFromEnvironment() (*VaultSecrets, error) {
+	s := &VaultSecrets{
+		Address: os.Getenv("VAULT_ADDR"),
+		Token:   os.Getenv("VAULT_TOKEN"),
+		Mount:   os.Getenv("VAULT_KV_MOUNT"),
+		Prefix:  "slackoverload",
+		Client:  &http.Client{Timeout: 3 * time.Second},
+	}
+
+	if s.Address == "" || s.Token == "" {
+		return nil, errors.New("VAULT_ADDR and VAULT_TOKEN must be set to use the vault secrets backend")
+	}
+	if s.Mount == "" {
+		s.Mount = "secret"
+	}
+
+	return s, nil
+}
+
+func (s *VaultSecrets) GetSecret(key string) (string, map[string]*string, error) {
+	response, err := s.do(http.MethodGet, key, nil)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "could not load secret %q from vault", key)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return "", nil, SecretNotFoundError{Key: key}
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", nil, errors.Wrapf(readVaultError(response), "could not load secret %q from vault", key)
+	}
+
+	var result vaultReadResponse
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "error parsing secret %q from vault", key)
+	}
+
+	return result.Data.Data.Value, result.Data.Data.Tags, nil
+}
+
+func (s *VaultSecrets) SetSecret(key string, value string, tags map[string]*string) error {
+	body, err := json.Marshal(vaultWriteRequest{Data: vaultSecretData{Value: value, Tags: tags}})
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling secret %s", key)
+	}
+
+	response, err := s.do(http.MethodPost, key, body)
+	if err != nil {
+		return errors.Wrapf(err, "error saving secret %s", key)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		return errors.Wrapf(readVaultError(response), "error saving secret %s", key)
+	}
+
+	return nil
+}
+
+func (s *VaultSecrets) ListSecrets(prefix string) ([]string, error) {
+	response, err := s.doPath("LIST", path.Join(s.Mount, "metadata", s.Prefix), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list secrets in vault")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.Wrap(readVaultError(response), "could not list secrets in vault")
+	}
+
+	var result vaultListResponse
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing secrets list from vault")
+	}
+
+	var keys []string
+	for _, key := range result.Data.Keys {
+		// Keys ending in a slash are folders, not secrets
+		if strings.HasPrefix(key, prefix) && !strings.HasSuffix(key, "/") {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *VaultSecrets) do(method string, key string, body []byte) (*http.Response, error) {
+	return s.doPath(method, path.Join(s.Mount, "data", s.Prefix, url.PathEscape(key)), body)
+}
+
+func (s *VaultSecrets) doPath(method string, secretPath string, body []byte) (*http.Response, error) {
+	secretURL := fmt.Sprintf("%s/v1/%s", strings.TrimSuffix(s.Address, "/"), secretPath)
+
+	request, err := http.NewRequest(method, secretURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-Vault-Token", s.Token)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	return s.Client.Do(request)
+}
+
+func readVaultError(response *http.Response) error {
+	var result vaultErrorResponse
+	json.NewDecoder(response.Body).Decode(&result)
+	if len(result.Errors) == 0 {
+		return errors.Errorf("vault returned %s", response.Status)
+	}
+	return errors.Errorf("vault returned %s: %s", response.Status, strings.Join(result.Errors, ", "))
+}
@@ -0,0 +1,454 @@
+package slackoverload
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// maxTriggerSteps is the most steps that a trigger can run, including the
+// steps of the triggers that it runs.
+const maxTriggerSteps = 20
+
+// sequenceRetryInterval is how long to wait before trying a failed step again.
+const sequenceRetryInterval = 5 * time.Minute
+
+// maxSequenceAttempts is how many times a step is attempted before the
+// sequence is stopped.
+const maxSequenceAttempts = 3
+
+// sequenceScopeGlobal is used in place of the team id for sequences that
+// apply to every workspace.
+const sequenceScopeGlobal = "global"
+
+// SequenceJob runs the remaining steps of a trigger, one after another.
+// Jobs are persisted so that they survive restarts.
+type SequenceJob struct {
+	Id     string `json:"id"`
+	UserId string `json:"user"`
+
+	// TimeZone is the IANA time zone used for steps that end at a certain time.
+	TimeZone string `json:"tz"`
+
+	// TeamId is the workspace that the steps apply to, or empty for every workspace.
+	TeamId string `json:"team,omitempty"`
+
+	Trigger string `json:"trigger"`
+
+	// Args are the arguments from /trigger for the status text of each step.
+	Args []string `json:"args,omitempty"`
+
+	// Steps are all of the steps of the trigger, with references to other
+	// triggers already replaced by their steps.
+	Steps []Action `json:"steps"`
+
+	// Step is the index of the next step to run.
+	Step int `json:"step"`
+
+	NextRun  time.Time `json:"next-run"`
+	Attempts int       `json:"attempts,omitempty"`
+}
+
+func (j SequenceJob) key() string {
+	return sequenceKey(j.UserId, j.TeamId)
+}
+
+func (j SequenceJob) Location() *time.Location {
+	loc, err := time.LoadLocation(j.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+func sequenceKey(userId string, teamId string) string {
+	if teamId == "" {
+		teamId = sequenceScopeGlobal
+	}
+	return path.Join(userId, teamId)
+}
+
+// ToString describes the progress of the sequence.
+func (j SequenceJob) ToString(loc *time.Location) string {
+	next := j.Steps[j.Step]
+	description := strings.TrimSpace(actionDefinition(next, false))
+	return fmt.Sprintf("*%s* is on step %d of %d, *%s* starts %s",
+		j.Trigger, j.Step, len(j.Steps), description, formatScheduleTime(j.NextRun, loc))
+}
+
+// expandTriggerSteps lists every step that a trigger runs, starting with its
+// own action, and replacing references to other triggers with their steps.
+// An error is returned when the triggers reference each other in a loop, when
+// a referenced trigger doesn't exist, or when a step before the last never ends.
+func expandTriggerSteps(tmpl ActionTemplate, lookup func(name string) (ActionTemplate, error)) ([]Action, error) {
+	var steps []Action
+	// skipped holds the workspaces that a trigger skips, which are skipped
+	// by its steps and the triggers that it runs too
+	var expand func(tmpl ActionTemplate, first Action, chain []string, skipped map[string]WorkspaceOverride) error
+	expand = func(tmpl ActionTemplate, first Action, chain []string, skipped map[string]WorkspaceOverride) error {
+		for _, name := range chain {
+			if name == tmpl.Name {
+				return errors.Errorf("Trigger %s runs itself in a loop: %s -> %s",
+					chain[0], strings.Join(chain, " -> "), tmpl.Name)
+			}
+		}
+		chain = append(chain, tmpl.Name)
+		skipped = first.skipWorkspaces(skipped).Workspaces
+
+		steps = append(steps, first.skipWorkspaces(skipped))
+		for _, step := range tmpl.Steps {
+			if len(steps) > maxTriggerSteps {
+				return errors.Errorf("Trigger %s has more than %d steps", chain[0], maxTriggerSteps)
+			}
+
+			if step.Trigger == "" {
+				steps = append(steps, step.Action.skipWorkspaces(skipped))
+				continue
+			}
+
+			ref, err := lookup(step.Trigger)
+			if err != nil {
+				if IsNotFound(err) {
+					return errors.Errorf("Trigger %s runs %s, which is not defined", tmpl.Name, step.Trigger)
+				}
+				return err
+			}
+
+			// The step's duration replaces the duration of the trigger that it runs
+			refFirst := ref.Action
+			if step.Duration != "" || step.Until != "" {
+				refFirst.Duration = step.Duration
+				refFirst.Until = step.Until
+			}
+			err = expand(ref, refFirst, chain, skipped)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := expand(tmpl, tmpl.Action, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) > maxTriggerSteps {
+		return nil, errors.Errorf("Trigger %s has more than %d steps", tmpl.Name, maxTriggerSteps)
+	}
+
+	for i, step := range steps[:len(steps)-1] {
+		if step.Duration == "" && step.Until == "" {
+			return nil, errors.Errorf("Step %d of trigger %s never ends, so the steps after it would never run. Give it a duration with for DURATION or until END.",
+				i+1, tmpl.Name)
+		}
+	}
+	return steps, nil
+}
+
+// triggerLookup finds the user's triggers by name, using the definition of a
+// trigger that hasn't been saved yet in place of the saved one.
+func (a *App) triggerLookup(userId string, unsaved ...ActionTemplate) func(name string) (ActionTemplate, error) {
+	return func(name string) (ActionTemplate, error) {
+		for _, tmpl := range unsaved {
+			if tmpl.Name == name {
+				return tmpl, nil
+			}
+		}
+		return a.getTrigger(userId, name)
+	}
+}
+
+// startSequence saves the steps that run after the first step of a trigger,
+// replacing any sequence that was running for the same workspaces.
+func (a *App) startSequence(userId string, run triggerRun, tmpl ActionTemplate, steps []Action, firstEnds time.Time) error {
+	err := a.cancelReplacedSequences(userId, tmpl.ScopeTeamId())
+	if err != nil {
+		return err
+	}
+
+	job := SequenceJob{
+		Id:       uuid.New().String(),
+		UserId:   userId,
+		TeamId:   tmpl.ScopeTeamId(),
+		Trigger:  tmpl.Name,
+		Steps:    steps,
+		Step:     1,
+		NextRun:  firstEnds,
+		TimeZone: run.location().String(),
+		Args:     run.Args,
+	}
+	return a.setSequence(job)
+}
+
+func (a *App) setSequence(job SequenceJob) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling sequence %#v", job)
+	}
+	return a.Storage.SetBlob("sequences", job.key(), b)
+}
+
+// cancelSequences stops the sequences that change the status on a workspace,
+// including sequences for every workspace, or all of the user's sequences
+// when teamId is empty.
+func (a *App) cancelSequences(userId string, teamId string) error {
+	jobs, err := a.getSequences(userId + "/")
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if teamId != "" && job.TeamId != "" && job.TeamId != teamId {
+			continue
+		}
+
+		err = a.Storage.DeleteBlob("sequences", job.key())
+		if err != nil && !IsNotFound(err) {
+			return errors.Wrapf(err, "error canceling sequence %s for %s", job.Trigger, userId)
+		}
+	}
+	return nil
+}
+
+// cancelReplacedSequences stops the sequences that a trigger replaces. A
+// trigger for every workspace replaces all of the user's sequences, and a
+// trigger for a workspace only replaces the sequence for that workspace.
+func (a *App) cancelReplacedSequences(userId string, teamId string) error {
+	if teamId == "" {
+		return a.cancelSequences(userId, "")
+	}
+
+	err := a.Storage.DeleteBlob("sequences", sequenceKey(userId, teamId))
+	if err != nil && !IsNotFound(err) {
+		return errors.Wrapf(err, "error canceling the sequence on %s for %s", teamId, userId)
+	}
+	return nil
+}
+
+// listSequences returns the sequences in progress that change the status on a
+// workspace, or only the sequences for every workspace when global is true.
+func (a *App) listSequences(userId string, teamId string, global bool) ([]SequenceJob, error) {
+	jobs, err := a.getSequences(userId + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SequenceJob
+	for _, job := range jobs {
+		if global && job.TeamId != "" || !global && job.TeamId != "" && job.TeamId != teamId {
+			continue
+		}
+		results = append(results, job)
+	}
+	return results, nil
+}
+
+func (a *App) runDueSequences(t time.Time) error {
+	jobs, err := a.getSequences("")
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if job.NextRun.After(t) {
+			continue
+		}
+
+		// Claim the job by pushing the next run out, so that only one
+		// instance runs it, and it is retried later if we don't finish
+		claimed, err := a.claimSequence(job, t)
+		if err != nil {
+			fmt.Printf("%s could not claim sequence %s for %s: %v\n", now(), job.Trigger, job.UserId, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		ends, err := a.runSequenceStep(job, t)
+		if err != nil {
+			fmt.Printf("%s error running step %d of %s for %s (attempt %d): %v\n", now(), job.Step+1, job.Trigger, job.UserId, job.Attempts+1, err)
+			if job.Attempts+1 < maxSequenceAttempts {
+				continue
+			}
+
+			// The steps after this one expect it to have run, so stop the sequence
+			fmt.Printf("%s giving up on sequence %s for %s\n", now(), job.Trigger, job.UserId)
+			err = a.removeSequence(job)
+			if err != nil {
+				fmt.Printf("%s could not stop sequence %s for %s: %v\n", now(), job.Trigger, job.UserId, err)
+			}
+			continue
+		}
+
+		err = a.advanceSequence(job, ends)
+		if err != nil {
+			fmt.Printf("%s could not advance sequence %s for %s: %v\n", now(), job.Trigger, job.UserId, err)
+		}
+	}
+
+	return nil
+}
+
+// runSequenceStep applies the next step, returning when it ends.
+func (a *App) runSequenceStep(job SequenceJob, t time.Time) (time.Time, error) {
+	fmt.Printf("%s running step %d of %d of %s for %s\n", now(), job.Step+1, len(job.Steps), job.Trigger, job.UserId)
+
+	user, err := a.getCurrentUser(job.UserId)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	step, err := resolveEndTime(job.Steps[job.Step], t.In(job.Location()), user.Settings)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	run := triggerRun{Args: job.Args, Start: t, Location: job.Location()}
+	err = a.applyActionToSlacks(job.UserId, job.TeamId, step, run)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	d, _ := step.ParseDuration()
+	return t.Add(d), nil
+}
+
+func (a *App) claimSequence(job SequenceJob, t time.Time) (bool, error) {
+	data, etag, err := a.Storage.GetBlobVersion("sequences", job.key())
+	if err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var current SequenceJob
+	err = json.Unmarshal(data, &current)
+	if err != nil {
+		return false, errors.Wrapf(err, "error unmarshaling sequence %s", job.key())
+	}
+	if current.Id != job.Id || current.Step != job.Step || !current.NextRun.Equal(job.NextRun) {
+		// Someone else claimed it, or another trigger replaced it
+		return false, nil
+	}
+
+	current.NextRun = t.Add(sequenceRetryInterval)
+	current.Attempts++
+	b, err := json.Marshal(current)
+	if err != nil {
+		return false, errors.Wrapf(err, "error marshaling sequence %s", job.key())
+	}
+
+	err = a.Storage.SetBlobIfMatch("sequences", job.key(), b, etag)
+	if IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// advanceSequence moves on to the step after the one that just ran, or
+// removes the sequence after the last step, unless it was replaced by
+// another trigger in the meantime.
+func (a *App) advanceSequence(job SequenceJob, nextRun time.Time) error {
+	data, etag, err := a.Storage.GetBlobVersion("sequences", job.key())
+	if err != nil {
+		if IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	var current SequenceJob
+	err = json.Unmarshal(data, &current)
+	if err != nil {
+		return errors.Wrapf(err, "error unmarshaling sequence %s", job.key())
+	}
+	if current.Id != job.Id {
+		return nil
+	}
+
+	current.Step++
+	if current.Step >= len(current.Steps) {
+		return a.deleteSequence(job, etag)
+	}
+
+	current.NextRun = nextRun
+	current.Attempts = 0
+	b, err := json.Marshal(current)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling sequence %s", job.key())
+	}
+
+	err = a.Storage.SetBlobIfMatch("sequences", job.key(), b, etag)
+	if IsConflict(err) {
+		// Another trigger replaced it
+		return nil
+	}
+	return err
+}
+
+// removeSequence stops a sequence, unless it was replaced by another trigger
+// in the meantime.
+func (a *App) removeSequence(job SequenceJob) error {
+	data, etag, err := a.Storage.GetBlobVersion("sequences", job.key())
+	if err != nil {
+		if IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	var current SequenceJob
+	err = json.Unmarshal(data, &current)
+	if err != nil {
+		return errors.Wrapf(err, "error unmarshaling sequence %s", job.key())
+	}
+	if current.Id != job.Id {
+		return nil
+	}
+
+	return a.deleteSequence(job, etag)
+}
+
+// deleteSequence removes the version of a sequence that was read, leaving it
+// alone when another trigger replaced it since.
+func (a *App) deleteSequence(job SequenceJob, etag ETag) error {
+	err := a.Storage.DeleteBlobIfMatch("sequences", job.key(), etag)
+	if IsNotFound(err) || IsConflict(err) {
+		return nil
+	}
+	return err
+}
+
+func (a *App) getSequences(prefix string) ([]SequenceJob, error) {
+	blobNames, err := a.Storage.ListContainer("sequences", prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]SequenceJob, 0, len(blobNames))
+	for _, blobName := range blobNames {
+		b, err := a.Storage.GetBlob("sequences", blobName)
+		if err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		var job SequenceJob
+		err = json.Unmarshal(b, &job)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling sequence %s: %s", blobName, string(b))
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
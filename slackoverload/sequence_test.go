@@ -0,0 +1,277 @@
+package slackoverload
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandTriggerSteps(t *testing.T) {
+	triggers := map[string]ActionTemplate{
+		"lunch":   {Name: "lunch", Action: Action{StatusText: "lunch", Duration: "1h"}},
+		"back":    {Name: "back", Action: Action{StatusText: "back"}},
+		"forever": {Name: "forever", Action: Action{StatusText: "forever"}},
+		"ping":    {Name: "ping", Action: Action{Duration: "1m"}, Steps: []TriggerStep{{Trigger: "pong"}}},
+		"pong":    {Name: "pong", Action: Action{Duration: "1m"}, Steps: []TriggerStep{{Trigger: "ping"}}},
+		"self":    {Name: "self", Action: Action{Duration: "1m"}, Steps: []TriggerStep{{Trigger: "self"}}},
+		"missing": {Name: "missing", Action: Action{Duration: "1m"}, Steps: []TriggerStep{{Trigger: "nope"}}},
+	}
+	lookup := func(name string) (ActionTemplate, error) {
+		if tmpl, ok := triggers[name]; ok {
+			return tmpl, nil
+		}
+		return ActionTemplate{}, TriggerNotFoundError{Name: name}
+	}
+
+	// stepsOf builds a trigger with n steps in total, including its own action
+	stepsOf := func(n int, step TriggerStep) ActionTemplate {
+		tmpl := ActionTemplate{Name: "many", Action: Action{Duration: "1m"}}
+		for i := 1; i < n; i++ {
+			tmpl.Steps = append(tmpl.Steps, step)
+		}
+		return tmpl
+	}
+
+	testcases := []struct {
+		name    string
+		tmpl    ActionTemplate
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "own steps",
+			tmpl: ActionTemplate{Name: "focus", Action: Action{StatusText: "focus", Duration: "90m"},
+				Steps: []TriggerStep{{Action: Action{StatusText: "break", Duration: "15m"}}, {Trigger: "back"}}},
+			want: []string{"focus 90m", "break 15m", "back "},
+		},
+		{
+			name: "step duration replaces the trigger's",
+			tmpl: ActionTemplate{Name: "long-lunch", Action: Action{StatusText: "meeting", Duration: "30m"},
+				Steps: []TriggerStep{{Trigger: "lunch", Action: Action{Duration: "2h"}}, {Trigger: "lunch"}}},
+			want: []string{"meeting 30m", "lunch 2h", "lunch 1h"},
+		},
+		{
+			name:    "loop",
+			tmpl:    triggers["ping"],
+			wantErr: "Trigger ping runs itself in a loop: ping -> pong -> ping",
+		},
+		{
+			name:    "runs itself",
+			tmpl:    triggers["self"],
+			wantErr: "Trigger self runs itself in a loop: self -> self",
+		},
+		{
+			name:    "missing trigger",
+			tmpl:    triggers["missing"],
+			wantErr: "Trigger missing runs nope, which is not defined",
+		},
+		{
+			name:    "step never ends",
+			tmpl:    ActionTemplate{Name: "stuck", Action: Action{Duration: "1m"}, Steps: []TriggerStep{{Trigger: "forever"}, {Trigger: "lunch"}}},
+			wantErr: "Step 2 of trigger stuck never ends",
+		},
+		{
+			name: "at most steps",
+			tmpl: stepsOf(maxTriggerSteps, TriggerStep{Action: Action{Duration: "1m"}}),
+			want: strings.Split(strings.Repeat(" 1m,", maxTriggerSteps-1)+" 1m", ","),
+		},
+		{
+			name:    "too many steps",
+			tmpl:    stepsOf(maxTriggerSteps+1, TriggerStep{Action: Action{Duration: "1m"}}),
+			wantErr: fmt.Sprintf("Trigger many has more than %d steps", maxTriggerSteps),
+		},
+		{
+			name:    "too many steps from other triggers",
+			tmpl:    stepsOf(maxTriggerSteps/2+1, TriggerStep{Trigger: "long-lunch"}),
+			wantErr: fmt.Sprintf("Trigger many has more than %d steps", maxTriggerSteps),
+		},
+	}
+	triggers["long-lunch"] = ActionTemplate{Name: "long-lunch", Action: Action{Duration: "1h"}, Steps: []TriggerStep{{Trigger: "lunch"}}}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			steps, err := expandTriggerSteps(tc.tmpl, lookup)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, step := range steps {
+				got = append(got, step.StatusText+" "+step.Duration)
+			}
+			if strings.Join(tc.want, ",") != strings.Join(got, ",") {
+				t.Fatalf("expected steps %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func getSequence(t *testing.T, a *App, userId string, teamId string) (SequenceJob, bool) {
+	jobs, err := a.getSequences(userId + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range jobs {
+		if job.TeamId == teamId {
+			return job, true
+		}
+	}
+	return SequenceJob{}, false
+}
+
+func TestRunDueSequences(t *testing.T) {
+	// The user doesn't have any linked accounts, so each step succeeds without calling Slack
+	a := &App{Storage: NewMemoryStorage()}
+	start := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	tmpl := ActionTemplate{Name: "focus", TeamId: "T1", Action: Action{StatusText: "focus", Duration: "90m"}}
+	steps := []Action{tmpl.Action, {StatusText: "break", Duration: "15m"}, {StatusText: "back"}}
+
+	err := a.startSequence("u1", triggerRun{Location: time.UTC}, tmpl, steps, start.Add(90*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.runDueSequences(start.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := getSequence(t, a, "u1", "T1"); job.Step != 1 {
+		t.Fatalf("expected the sequence to wait for the first step to end, got step %d", job.Step)
+	}
+
+	due := start.Add(90 * time.Minute)
+	err = a.runDueSequences(due)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, ok := getSequence(t, a, "u1", "T1")
+	if !ok || job.Step != 2 || !job.NextRun.Equal(due.Add(15*time.Minute)) || job.Attempts != 0 {
+		t.Fatalf("expected the last step to run when the break ends, got %#v", job)
+	}
+
+	err = a.runDueSequences(job.NextRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, ok := getSequence(t, a, "u1", "T1"); ok {
+		t.Fatalf("expected the sequence to be removed after the last step, got %#v", job)
+	}
+}
+
+func TestRunDueSequences_GivesUp(t *testing.T) {
+	a := &App{Storage: NewMemoryStorage()}
+	start := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+	// The end time of the second step can't be resolved, so it always fails
+	job := SequenceJob{
+		Id:      "seq1",
+		UserId:  "u1",
+		TeamId:  "T1",
+		Trigger: "focus",
+		Steps:   []Action{{Duration: "1h"}, {Until: "whenever"}, {StatusText: "back"}},
+		Step:    1,
+		NextRun: start,
+	}
+	err := a.setSequence(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due := start
+	for attempt := 1; attempt < maxSequenceAttempts; attempt++ {
+		err = a.runDueSequences(due)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		job, ok := getSequence(t, a, "u1", "T1")
+		if !ok || job.Step != 1 || job.Attempts != attempt || !job.NextRun.Equal(due.Add(sequenceRetryInterval)) {
+			t.Fatalf("attempt %d: expected the step to be retried later, got %#v", attempt, job)
+		}
+		due = job.NextRun
+	}
+
+	err = a.runDueSequences(due)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, ok := getSequence(t, a, "u1", "T1"); ok {
+		t.Fatalf("expected the sequence to be stopped, got %#v", job)
+	}
+}
+
+func TestCancelSequences(t *testing.T) {
+	steps := []Action{{Duration: "1h"}, {StatusText: "back"}}
+	start := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+	newApp := func(t *testing.T) *App {
+		a := &App{Storage: NewMemoryStorage()}
+		for _, tmpl := range []ActionTemplate{
+			{Name: "everywhere", Global: true},
+			{Name: "work", TeamId: "T1"},
+			{Name: "community", TeamId: "T2"},
+		} {
+			err := a.setSequence(SequenceJob{Id: tmpl.Name, UserId: "u1", TeamId: tmpl.ScopeTeamId(), Trigger: tmpl.Name, Steps: steps, Step: 1, NextRun: start})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return a
+	}
+
+	remaining := func(t *testing.T, a *App) string {
+		jobs, err := a.getSequences("u1/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var triggers []string
+		for _, job := range jobs {
+			triggers = append(triggers, job.Trigger)
+		}
+		sort.Strings(triggers)
+		return strings.Join(triggers, ",")
+	}
+
+	t.Run("workspace trigger", func(t *testing.T) {
+		a := newApp(t)
+		tmpl := ActionTemplate{Name: "lunch", TeamId: "T1"}
+		err := a.startSequence("u1", triggerRun{Location: time.UTC}, tmpl, steps, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := remaining(t, a); got != "community,everywhere,lunch" {
+			t.Fatalf("expected only the sequence on the workspace to be replaced, got %s", got)
+		}
+	})
+
+	t.Run("global trigger", func(t *testing.T) {
+		a := newApp(t)
+		tmpl := ActionTemplate{Name: "lunch", Global: true}
+		err := a.startSequence("u1", triggerRun{Location: time.UTC}, tmpl, steps, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := remaining(t, a); got != "lunch" {
+			t.Fatalf("expected every sequence to be replaced, got %s", got)
+		}
+	})
+
+	t.Run("clear a workspace", func(t *testing.T) {
+		a := newApp(t)
+		err := a.cancelSequences("u1", "T1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := remaining(t, a); got != "community" {
+			t.Fatalf("expected the sequences that change the workspace to be stopped, got %s", got)
+		}
+	})
+}
@@ -18,7 +18,7 @@ type SessionStore struct {
 }
 
 func (s *SessionStore) Init(secrets Secrets) error {
-	sessionKey, err := secrets.GetSessionKey()
+	sessionKey, err := GetSessionKey(secrets)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,316 @@
+package slackoverload
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+const settingsUsage = "Try /overload-settings tz America/New_York, /overload-settings hours weekdays 9am-5pm, /overload-settings dnd on or /overload-settings duration 1h"
+
+// Settings are a user's preferences that apply to all of their triggers.
+type Settings struct {
+	// TimeZone is the IANA time zone to use instead of the one from the Slack profile.
+	TimeZone string `json:"tz,omitempty"`
+
+	// WorkingHours are the hours worked on each day, days off are left out.
+	// When not set, the work week is Monday to Friday 9am to 5pm.
+	WorkingHours []WorkingDay `json:"working-hours"`
+
+	// DefaultDnD is used by new triggers that don't say DND or NODND.
+	DefaultDnD *bool `json:"default-dnd,omitempty"`
+
+	// DefaultDuration is used by new triggers that don't have a duration or end time.
+	DefaultDuration string `json:"default-duration,omitempty"`
+}
+
+// WorkingDay is the hours worked on a day of the week.
+type WorkingDay struct {
+	Day         time.Weekday `json:"day"`
+	StartHour   int          `json:"start-hour"`
+	StartMinute int          `json:"start-minute"`
+	EndHour     int          `json:"end-hour"`
+	EndMinute   int          `json:"end-minute"`
+}
+
+func (d WorkingDay) ToString() string {
+	return fmt.Sprintf("%s %s-%s", d.Day, formatClock(d.StartHour, d.StartMinute), formatClock(d.EndHour, d.EndMinute))
+}
+
+// Hours returns the user's working hours, or the default work week when they
+// haven't been set.
+func (s Settings) Hours() []WorkingDay {
+	if s.WorkingHours != nil {
+		return s.WorkingHours
+	}
+
+	var hours []WorkingDay
+	for day := time.Monday; day <= time.Friday; day++ {
+		hours = append(hours, WorkingDay{
+			Day:       day,
+			StartHour: defaultWorkdayStartHour,
+			EndHour:   defaultWorkdayEndHour,
+		})
+	}
+	return hours
+}
+
+// WorkingDay returns the hours worked on a day of the week, and false on a day off.
+func (s Settings) WorkingDay(day time.Weekday) (WorkingDay, bool) {
+	for _, d := range s.Hours() {
+		if d.Day == day {
+			return d, true
+		}
+	}
+	return WorkingDay{}, false
+}
+
+// SetHours replaces the working hours for the specified days. A nil hours
+// marks the days as days off.
+func (s *Settings) SetHours(days []time.Weekday, hours *WorkingDay) {
+	var updated []WorkingDay
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if containsWeekday(days, day) {
+			if hours != nil {
+				d := *hours
+				d.Day = day
+				updated = append(updated, d)
+			}
+			continue
+		}
+
+		if d, ok := s.WorkingDay(day); ok {
+			updated = append(updated, d)
+		}
+	}
+
+	// Remember that every day is a day off, instead of falling back to the default
+	if len(updated) == 0 {
+		updated = []WorkingDay{}
+	}
+	s.WorkingHours = updated
+}
+
+// Location returns the preferred time zone, or the fallback when one isn't set.
+func (s Settings) Location(fallback *time.Location) *time.Location {
+	if s.TimeZone == "" {
+		return fallback
+	}
+
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return fallback
+	}
+	return loc
+}
+
+func (s Settings) ToString() string {
+	tz := "from your Slack profile"
+	if s.TimeZone != "" {
+		tz = s.TimeZone
+	}
+
+	var hours []string
+	for _, d := range s.Hours() {
+		hours = append(hours, d.ToString())
+	}
+	hoursText := "none"
+	if len(hours) > 0 {
+		hoursText = strings.Join(hours, ", ")
+	}
+
+	dnd := "off"
+	if s.DefaultDnD != nil && *s.DefaultDnD {
+		dnd = "on"
+	}
+
+	duration := "none"
+	if s.DefaultDuration != "" {
+		duration = s.DefaultDuration
+	}
+
+	return fmt.Sprintf("*Time Zone*: %s\n*Working Hours*: %s\n*Default DND*: %s\n*Default Duration*: %s",
+		tz, hoursText, dnd, duration)
+}
+
+type OverloadSettingsRequest struct {
+	SlackPayload
+}
+
+// OverloadSettings shows the user's settings, or changes one of them
+// Example:
+// hours MTuWTh 8am-4pm
+// setting = hours
+// value = MTuWTh 8am-4pm
+func (a *App) OverloadSettings(r OverloadSettingsRequest) (slack.Msg, error) {
+	fmt.Printf("%s /overload-settings %q from %s(%s) on %s(%s)\n",
+		now(), r.Text, r.UserName, r.SlackId, r.TeamName, r.TeamId)
+
+	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
+	if err != nil {
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
+	}
+
+	fields := strings.Fields(r.Text)
+	if len(fields) == 0 {
+		user, err := a.getCurrentUser(userId)
+		if err != nil {
+			return slack.Msg{}, err
+		}
+		return settingsMessage("Here are your settings", user.Settings), nil
+	}
+
+	update, err := parseSettingsUpdate(fields[0], fields[1:])
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	user, err := a.updateCurrentUser(userId, func(user *User) {
+		update(&user.Settings)
+	})
+	if err != nil {
+		return slack.Msg{}, errors.Wrapf(err, "error saving settings for %s(%s) on %s(%s)",
+			r.UserName, r.SlackId, r.TeamName, r.TeamId)
+	}
+
+	if strings.EqualFold(fields[0], "tz") {
+		// Move existing schedules to the new time zone
+		err = a.updateScheduleTimeZones(userId, a.userLocation(user, r.SlackId))
+		if err != nil {
+			return slack.Msg{}, err
+		}
+	}
+
+	return settingsMessage("Updated your settings", user.Settings), nil
+}
+
+func settingsMessage(title string, settings Settings) slack.Msg {
+	return slack.Msg{
+		Type: slack.ResponseTypeEphemeral,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.SectionBlock{
+				Type: slack.MBTSection,
+				Text: &slack.TextBlockObject{
+					Type: slack.MarkdownType,
+					Text: fmt.Sprintf("%s :gear:\n%s", title, settings.ToString()),
+				},
+			},
+		}},
+	}
+}
+
+// parseSettingsUpdate validates a change to a setting, returning a function
+// that applies it.
+func parseSettingsUpdate(name string, args []string) (func(s *Settings), error) {
+	value := strings.Join(args, " ")
+	if value == "" {
+		return nil, errors.Errorf("missing a value for %q. %s", name, settingsUsage)
+	}
+
+	switch strings.ToLower(name) {
+	case "tz":
+		if strings.EqualFold(value, "slack") {
+			return func(s *Settings) { s.TimeZone = "" }, nil
+		}
+		loc, err := time.LoadLocation(value)
+		if err != nil || value == "Local" {
+			return nil, errors.Errorf("unknown time zone %q, use a name like America/New_York, or slack to use the time zone from your Slack profile", value)
+		}
+		return func(s *Settings) { s.TimeZone = loc.String() }, nil
+
+	case "hours":
+		if len(args) != 2 {
+			return nil, errors.Errorf("invalid working hours %q. Try /overload-settings hours weekdays 9am-5pm or /overload-settings hours SaSu off", value)
+		}
+		days, err := parseDays(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(args[1], "off") {
+			return func(s *Settings) { s.SetHours(days, nil) }, nil
+		}
+		hours, err := parseWorkingHours(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return func(s *Settings) { s.SetHours(days, &hours) }, nil
+
+	case "dnd":
+		var dnd *bool
+		switch strings.ToLower(value) {
+		case "on":
+			on := true
+			dnd = &on
+		case "off":
+			off := false
+			dnd = &off
+		default:
+			return nil, errors.Errorf("invalid default DND %q, use on or off", value)
+		}
+		return func(s *Settings) { s.DefaultDnD = dnd }, nil
+
+	case "duration":
+		if strings.EqualFold(value, "none") {
+			return func(s *Settings) { s.DefaultDuration = "" }, nil
+		}
+		_, err := Action{Duration: value}.ParseDuration()
+		if err != nil {
+			return nil, errors.Errorf("invalid default duration %q, use none or a duration such as 15m, 1h30m, 2d, 1w", value)
+		}
+		return func(s *Settings) { s.DefaultDuration = value }, nil
+
+	default:
+		return nil, errors.Errorf("unknown setting %q. %s", name, settingsUsage)
+	}
+}
+
+// parseWorkingHours converts a range of time, such as 9am-5pm, into working hours.
+func parseWorkingHours(value string) (WorkingDay, error) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return WorkingDay{}, errors.Errorf("invalid working hours %q, use a range of time such as 9am-5pm", value)
+	}
+
+	startHour, startMinute, err := parseTimeOfDay(parts[0])
+	if err != nil {
+		return WorkingDay{}, err
+	}
+	endHour, endMinute, err := parseTimeOfDay(parts[1])
+	if err != nil {
+		return WorkingDay{}, err
+	}
+	if endHour*60+endMinute <= startHour*60+startMinute {
+		return WorkingDay{}, errors.Errorf("invalid working hours %q, the end must be after the start", value)
+	}
+
+	return WorkingDay{
+		StartHour:   startHour,
+		StartMinute: startMinute,
+		EndHour:     endHour,
+		EndMinute:   endMinute,
+	}, nil
+}
+
+// userLocation returns the user's preferred time zone, falling back to the
+// time zone from their Slack profile.
+func (a *App) userLocation(user User, slackId string) *time.Location {
+	if user.Settings.TimeZone != "" {
+		return user.Settings.Location(time.Local)
+	}
+	return a.lookupTimeZone(slackId)
+}
+
+func containsWeekday(days []time.Weekday, day time.Weekday) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package slackoverload
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSettingsUpdate(t *testing.T) {
+	on, off := true, false
+	nineToFive := func(day time.Weekday) WorkingDay {
+		return WorkingDay{Day: day, StartHour: 9, EndHour: 17}
+	}
+
+	testcases := []struct {
+		name    string
+		update  string
+		want    Settings
+		wantErr string
+	}{
+		{name: "time zone", update: "tz America/Denver", want: Settings{TimeZone: "America/Denver"}},
+		{name: "utc", update: "tz UTC", want: Settings{TimeZone: "UTC"}},
+		{name: "slack time zone", update: "tz slack", want: Settings{}},
+		{name: "local time zone", update: "tz Local", wantErr: "unknown time zone"},
+		{name: "unknown time zone", update: "tz Mars/Base", wantErr: "unknown time zone"},
+		{
+			name:   "working hours",
+			update: "hours MTuWTh 8am-4:30pm",
+			want: Settings{WorkingHours: []WorkingDay{
+				{Day: time.Monday, StartHour: 8, EndHour: 16, EndMinute: 30},
+				{Day: time.Tuesday, StartHour: 8, EndHour: 16, EndMinute: 30},
+				{Day: time.Wednesday, StartHour: 8, EndHour: 16, EndMinute: 30},
+				{Day: time.Thursday, StartHour: 8, EndHour: 16, EndMinute: 30},
+				nineToFive(time.Friday),
+			}},
+		},
+		{
+			name:   "day off",
+			update: "hours F off",
+			want: Settings{WorkingHours: []WorkingDay{
+				nineToFive(time.Monday), nineToFive(time.Tuesday), nineToFive(time.Wednesday), nineToFive(time.Thursday),
+			}},
+		},
+		{name: "every day off", update: "hours SuMTuWThFSa off", want: Settings{WorkingHours: []WorkingDay{}}},
+		{name: "end before start", update: "hours M 5pm-9am", wantErr: "the end must be after the start"},
+		{name: "end at start", update: "hours M 9am-9am", wantErr: "the end must be after the start"},
+		{name: "hours without days", update: "hours 9am-5pm", wantErr: "invalid working hours"},
+		{name: "invalid days", update: "hours Xyz 9am-5pm", wantErr: "invalid days"},
+		{name: "dnd on", update: "dnd on", want: Settings{DefaultDnD: &on}},
+		{name: "dnd off", update: "dnd OFF", want: Settings{DefaultDnD: &off}},
+		{name: "invalid dnd", update: "dnd maybe", wantErr: "use on or off"},
+		{name: "duration", update: "duration 1h30m", want: Settings{DefaultDuration: "1h30m"}},
+		{name: "no duration", update: "duration none", want: Settings{}},
+		{name: "invalid duration", update: "duration -1h", wantErr: "invalid default duration"},
+		{name: "missing value", update: "duration", wantErr: "missing a value"},
+		{name: "unknown setting", update: "color blue", wantErr: "unknown setting"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			fields := strings.Fields(tc.update)
+			update, err := parseSettingsUpdate(fields[0], fields[1:])
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got Settings
+			update(&got)
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected %#v, got %#v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSettings_SetHours(t *testing.T) {
+	var s Settings
+	s.SetHours([]time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}, nil)
+	if s.WorkingHours == nil || len(s.WorkingHours) != 0 {
+		t.Fatalf("expected every day to be off, got %#v", s.WorkingHours)
+	}
+
+	// Every day off is remembered, instead of going back to the default work week
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Settings
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Hours()) != 0 {
+		t.Fatalf("expected every day to be off after saving, got %v", saved.Hours())
+	}
+	if _, ok := saved.WorkingDay(time.Monday); ok {
+		t.Fatal("expected Monday to be a day off")
+	}
+
+	saved.SetHours([]time.Weekday{time.Saturday}, &WorkingDay{StartHour: 10, EndHour: 14})
+	want := []WorkingDay{{Day: time.Saturday, StartHour: 10, EndHour: 14}}
+	if !reflect.DeepEqual(want, saved.Hours()) {
+		t.Fatalf("expected %v, got %v", want, saved.Hours())
+	}
+
+	// Without any working hours, the default work week is used
+	if hours := (Settings{}).Hours(); len(hours) != 5 || hours[0].Day != time.Monday || hours[4].Day != time.Friday {
+		t.Fatalf("expected the default work week, got %v", hours)
+	}
+}
+
+func TestParseWorkingHours(t *testing.T) {
+	testcases := []struct {
+		value   string
+		want    WorkingDay
+		wantErr bool
+	}{
+		{value: "9am-5pm", want: WorkingDay{StartHour: 9, EndHour: 17}},
+		{value: "8:30am-4:15pm", want: WorkingDay{StartHour: 8, StartMinute: 30, EndHour: 16, EndMinute: 15}},
+		{value: "noon-17:00", want: WorkingDay{StartHour: 12, EndHour: 17}},
+		{value: "midnight-1am", want: WorkingDay{EndHour: 1}},
+		{value: "5pm-9am", wantErr: true},
+		{value: "9am-9am", wantErr: true},
+		{value: "9am", wantErr: true},
+		{value: "9am-5pm-6pm", wantErr: true},
+		{value: "9am-later", wantErr: true},
+	}
+
+	for _, tc := range testcases {
+		got, err := parseWorkingHours(tc.value)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %#v", tc.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.value, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected %#v, got %#v", tc.value, tc.want, got)
+		}
+	}
+}
@@ -6,8 +6,6 @@ import (
 	"net/http"
 	"net/url"
 	"path"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
@@ -21,6 +19,9 @@ const (
 	PresenceAway   = "away"
 	PresenceActive = "auto"
 	SlackOAuthURL  = "https://slack.com/api/oauth.v2.access"
+
+	// CmdURL is where Slack Overload's HTTP endpoints are served.
+	CmdURL = "https://cmd.slackoverload.com"
 )
 
 type Presence string
@@ -31,67 +32,158 @@ type Action struct {
 	StatusEmoji string   `json:"status-emoji,omitempty"`
 	DnD         bool     `json:"dnd,omitempty"`
 	Duration    string   `json:"duration,omitempty"`
-}
-
-func (a Action) ParseDuration() (time.Duration, error) {
-	if a.Duration == "" {
-		return time.Duration(0), nil
-	}
 
-	r := regexp.MustCompile(`^(\d+)([wd])$`)
-	match := r.FindStringSubmatch(a.Duration)
-	if len(match) == 0 {
-		return time.ParseDuration(a.Duration)
-	}
+	// Until is when the action ends, such as "5pm" or "tomorrow". It is
+	// converted to a duration in the user's time zone when triggered.
+	Until string `json:"until,omitempty"`
 
-	num, err := strconv.Atoi(match[1])
-	if err != nil {
-		return time.Duration(0), err
-	}
+	// Workspaces changes the action on individual workspaces, by team id.
+	Workspaces map[string]WorkspaceOverride `json:"workspaces,omitempty"`
+}
 
-	var unit time.Duration
-	switch match[2] {
-	case "d":
-		unit = day
-	case "w":
-		unit = week
-	}
-	return time.Duration(num) * unit, nil
+func (a Action) ParseDuration() (time.Duration, error) {
+	return parseCompoundDuration(a.Duration)
 }
 
 func (a Action) DurationInMinutes() int64 {
 	d, _ := a.ParseDuration()
-	return int64(d.Seconds())
+	// Round up so that a short duration doesn't become "forever"
+	return int64((d + time.Minute - 1) / time.Minute)
+}
+
+// ExpirationTime returns when the action ends as a Unix timestamp,
+// or 0 when it doesn't expire.
+func (a Action) ExpirationTime(start time.Time) int64 {
+	d, _ := a.ParseDuration()
+	if d <= 0 {
+		return 0
+	}
+	return start.Add(d).Unix()
 }
 
 type ActionTemplate struct {
 	Name   string `json:"name"`
 	TeamId string `json:"team"`
+
+	// Global triggers apply to every linked Slack workspace, otherwise a
+	// trigger only applies to the workspace where it was created.
+	Global bool `json:"global,omitempty"`
+
 	Action `json:"action"`
+
+	// Steps run one after another once the action ends.
+	Steps []TriggerStep `json:"steps,omitempty"`
+}
+
+// TriggerStep is a step of a trigger that runs after the previous step ends.
+type TriggerStep struct {
+	// Trigger is the name of another trigger to run for this step. Only the
+	// duration and end time of the action are used, to override the trigger's.
+	Trigger string `json:"trigger,omitempty"`
+
+	Action `json:"action"`
+}
+
+func (s TriggerStep) ToString() string {
+	if s.Trigger == "" {
+		def := strings.TrimSpace(actionDefinition(s.Action, true))
+		if def == "" {
+			// Clear the status text, instead of leaving nothing after "then"
+			return `""`
+		}
+		return def
+	}
+
+	return s.Trigger + durationDefinition(s.Action)
+}
+
+// ScopeTeamId returns the workspace that the trigger applies to,
+// or an empty string when it applies to all workspaces.
+func (t ActionTemplate) ScopeTeamId() string {
+	if t.Global {
+		return ""
+	}
+	return t.TeamId
+}
+
+// AppliesTo returns if the trigger can be used from a workspace.
+func (t ActionTemplate) AppliesTo(teamId string) bool {
+	return t.Global || t.TeamId == teamId
+}
+
+// checkScope refuses to replace a trigger that was defined for a different
+// scope. Triggers are saved by name, so a workspace trigger and a global
+// trigger, or triggers on two workspaces, can't share a name.
+func (t ActionTemplate) checkScope(existing ActionTemplate) error {
+	if existing.TeamId == "" && !existing.Global {
+		// The trigger doesn't exist yet
+		return nil
+	}
+
+	switch {
+	case existing.Global && !t.Global:
+		return errors.Errorf("You already have a global trigger named %s. Use /create-global-trigger to change it, or delete it first with /delete-trigger %s", t.Name, t.Name)
+	case !existing.Global && existing.TeamId != t.TeamId:
+		return errors.Errorf("You already have a trigger named %s on another workspace, please pick a different name", t.Name)
+	case !existing.Global && t.Global:
+		return errors.Errorf("You already have a trigger named %s for this workspace. Delete it first with /delete-trigger %s to make it global", t.Name, t.Name)
+	}
+	return nil
+}
+
+func (t ActionTemplate) ScopeText() string {
+	if t.Global {
+		return "All workspaces"
+	}
+	return "This workspace"
 }
 
 func (t ActionTemplate) ToString() string {
+	def := fmt.Sprintf("%s =%s", t.Name, actionDefinition(t.Action, false))
+	for _, step := range t.Steps {
+		def += fmt.Sprintf(" %s %s", keywordThen, step.ToString())
+	}
+	return def
+}
+
+// actionDefinition formats an action the way that it is written in a trigger
+// definition, with a space before each part. Single word status text in a
+// step is quoted so that it isn't read as the name of a trigger.
+func actionDefinition(a Action, step bool) string {
 	statusText := ""
-	if t.StatusText != "" {
-		statusText = fmt.Sprintf(" %s", t.StatusText)
+	if a.StatusText != "" {
+		text := formatStatusText(a.StatusText)
+		if step && text == a.StatusText && triggerNamePattern.MatchString(text) {
+			text = fmt.Sprintf("%q", text)
+		}
+		statusText = fmt.Sprintf(" %s", text)
 	}
 
 	emojiText := ""
-	if t.StatusEmoji != "" {
-		emojiText = fmt.Sprintf(" (%s)", t.StatusEmoji)
+	if a.StatusEmoji != "" {
+		emojiText = fmt.Sprintf(" (%s)", a.StatusEmoji)
+	}
+
+	presenceText := ""
+	if a.Presence == PresenceActive {
+		presenceText = " " + keywordActive
 	}
 
 	dndText := ""
-	if t.DnD {
+	if a.DnD {
 		dndText = fmt.Sprintf(" DND")
 	}
 
-	durationText := ""
-	if t.Duration != "" {
-		durationText = fmt.Sprintf(" for %s", t.Duration)
-	}
+	return statusText + emojiText + presenceText + dndText + durationDefinition(a)
+}
 
-	return fmt.Sprintf("%s = %s%s%s%s", t.Name, statusText, emojiText, dndText, durationText)
+func durationDefinition(a Action) string {
+	if a.Until != "" {
+		return fmt.Sprintf(" until %s", a.Until)
+	} else if a.Duration != "" {
+		return fmt.Sprintf(" for %s", a.Duration)
+	}
+	return ""
 }
 
 type ClearStatusRequest struct {
@@ -109,11 +201,118 @@ type TriggerRequest struct {
 }
 
 func (r TriggerRequest) GetName() string {
-	return r.Text
+	fields := strings.Fields(r.Text)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// Parse the trigger name and any overrides for this invocation. Anything
+// else is an argument for the status text, quote it to use more than one word.
+// Example:
+// meeting "with design" for 2h NODND
+// name = meeting
+// args = with design
+// duration = 2h
+// DND = No
+func (r TriggerRequest) Parse() (string, TriggerOverrides, error) {
+	tokens, err := tokenizeTrigger(r.Text)
+	if err != nil {
+		if perr, ok := err.(TriggerParseError); ok {
+			return "", TriggerOverrides{}, errors.Errorf("invalid /trigger %s at %s (character %d): %s", r.Text, perr.Token, perr.Position, perr.Reason)
+		}
+		return "", TriggerOverrides{}, err
+	}
+	if len(tokens) == 0 {
+		return "", TriggerOverrides{}, errors.New("Which trigger? Try /trigger lunch for 2h")
+	}
+
+	var overrides TriggerOverrides
+	for i := 1; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind == tokenQuoted {
+			overrides.Args = append(overrides.Args, t.value)
+			continue
+		}
+
+		switch strings.ToUpper(t.raw) {
+		case "FOR":
+			if i+1 >= len(tokens) {
+				return "", TriggerOverrides{}, errors.Errorf("missing duration after %q, here are some examples: 15m, 1h30m, 2d, 1w", t.raw)
+			}
+			i++
+			overrides.Duration = tokens[i].raw
+			overrides.Until = ""
+			_, err := Action{Duration: overrides.Duration}.ParseDuration()
+			if err != nil {
+				return "", TriggerOverrides{}, errors.Errorf("invalid duration %q, here are some examples: 15m, 1h30m, 2d, 1w", overrides.Duration)
+			}
+		case "UNTIL":
+			until, n := matchEndTimeTokens(tokens[i+1:])
+			if n == 0 {
+				var rest []string
+				for _, t := range tokens[i+1:] {
+					rest = append(rest, t.raw)
+				}
+				return "", TriggerOverrides{}, errors.Errorf("invalid end time %q, %s", strings.Join(rest, " "), endTimeExamples)
+			}
+			i += n
+			overrides.Until = until
+			overrides.Duration = ""
+		case "DND":
+			dnd := true
+			overrides.DnD = &dnd
+		case "NODND":
+			dnd := false
+			overrides.DnD = &dnd
+		default:
+			overrides.Args = append(overrides.Args, t.raw)
+		}
+	}
+
+	return tokens[0].raw, overrides, nil
+}
+
+// TriggerOverrides are changes to a trigger that only apply to a single invocation.
+type TriggerOverrides struct {
+	Duration string
+	Until    string
+	DnD      *bool
+
+	// Args fill in {{.Arg N}} in the status text.
+	Args []string
+}
+
+// Apply the overrides to a copy of the action, returning the new action and
+// a description of each value that was overridden.
+func (o TriggerOverrides) Apply(action Action) (Action, []string) {
+	var changes []string
+	if o.Duration != "" {
+		action.Duration = o.Duration
+		action.Until = ""
+		changes = append(changes, fmt.Sprintf("for %s", o.Duration))
+	}
+	if o.Until != "" {
+		action.Until = o.Until
+		action.Duration = ""
+		changes = append(changes, fmt.Sprintf("until %s", o.Until))
+	}
+	if o.DnD != nil {
+		action.DnD = *o.DnD
+		action.Workspaces = withoutDnD(action.Workspaces)
+		if action.DnD {
+			changes = append(changes, "Do Not Disturb on")
+		} else {
+			changes = append(changes, "Do Not Disturb off")
+		}
+	}
+	return action, changes
 }
 
 type CreateTriggerRequest struct {
 	SlackPayload
+	Global bool
 }
 
 func (r CreateTriggerRequest) GetDefinition() string {
@@ -134,6 +333,12 @@ type SlackPayload struct {
 	TeamId   string
 	TeamName string
 	Text     string
+
+	// TriggerId allows opening a modal in response to the command.
+	TriggerId string
+
+	// ResponseURL accepts messages in response to the command, for up to 30 minutes.
+	ResponseURL string
 }
 
 type OAuthRequest struct {
@@ -142,8 +347,10 @@ type OAuthRequest struct {
 }
 
 type OAuthResponse struct {
-	Team OAuthTeam `json:"team"`
-	User OAuthUser `json:"authed_user"`
+	// AccessToken is the bot token for the workspace.
+	AccessToken string    `json:"access_token"`
+	Team        OAuthTeam `json:"team"`
+	User        OAuthUser `json:"authed_user"`
 }
 
 type OAuthTeam struct {
@@ -159,39 +366,98 @@ type OAuthUser struct {
 
 type App struct {
 	Debug bool
+
+	// StorageBackend is the name of the storage backend to use: azure, filesystem or memory.
+	StorageBackend string
+
+	// StorageDir is the directory used by the filesystem storage backend.
+	StorageDir string
+
+	// SecretsBackend is the name of the secrets backend to use: keyvault, vault or local.
+	SecretsBackend string
+
+	// SecretsDir is the directory used by the local secrets backend.
+	SecretsDir string
+
+	// CacheTTL is how long secrets and blobs are cached in memory, zero disables the cache.
+	CacheTTL time.Duration
+
+	// CacheSize is the maximum number of entries held by each cache.
+	CacheSize int
+
 	Storage
 	Secrets
+
+	// timeZones remembers the time zone from each user's Slack profile.
+	timeZones *lruCache
 }
 
 func (a *App) Init(secrets Secrets) error {
-	a.Secrets = secrets
-
-	store, err := NewStorageClient()
+	store, err := NewStorage(a.StorageBackend, a.StorageDir)
 	if err != nil {
 		return err
 	}
 
+	if a.CacheTTL > 0 && a.CacheSize > 0 {
+		secrets = NewCachedSecrets(secrets, a.CacheTTL, a.CacheSize)
+		store = NewCachedStorage(store, a.CacheTTL, a.CacheSize)
+	}
+
+	a.Secrets = secrets
 	a.Storage = store
+	a.timeZones = newLRUCache(timeZoneCacheTTL, timeZoneCacheSize)
 	return nil
 }
 
+// CacheStats returns the statistics for each cache that is enabled.
+func (a *App) CacheStats() map[string]CacheStats {
+	stats := make(map[string]CacheStats)
+	if c, ok := a.Secrets.(*CachedSecrets); ok {
+		stats["secrets"] = c.Stats()
+	}
+	if c, ok := a.Storage.(*CachedStorage); ok {
+		stats["storage"] = c.Stats()
+	}
+	if a.timeZones != nil {
+		stats["time-zones"] = a.timeZones.getStats()
+	}
+	return stats
+}
+
 func (a *App) ClearStatus(r ClearStatusRequest) (slack.Msg, error) {
-	fmt.Printf("%s /clear-status for %s(%s) on %s(%s)\n",
-		now(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+	fmt.Printf("%s /clear-status global=%t for %s(%s) on %s(%s)\n",
+		now(), r.Global, r.UserName, r.SlackId, r.TeamName, r.TeamId)
 
 	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
 	if err != nil {
-		return a.handleUserNotRegistered(), nil
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
 	}
 
 	action := Action{
 		Presence: PresenceActive,
 	}
-	err = a.applyActionToAllSlacks(userId, action)
+	teamId := r.TeamId
+	if r.Global {
+		teamId = ""
+	}
+	err = a.applyActionToSlacks(userId, teamId, action, triggerRun{})
 	if err != nil {
 		return slack.Msg{}, err
 	}
 
+	err = a.cancelSequences(userId, teamId)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	clearedText := "Your status has been cleared :boom:"
+	if r.Global {
+		clearedText = "Your status has been cleared on all workspaces :boom:"
+	}
+
 	msg := slack.Msg{
 		Type: slack.ResponseTypeEphemeral,
 		Blocks: slack.Blocks{BlockSet: []slack.Block{
@@ -199,7 +465,7 @@ func (a *App) ClearStatus(r ClearStatusRequest) (slack.Msg, error) {
 				Type: slack.MBTSection,
 				Text: &slack.TextBlockObject{
 					Type: slack.MarkdownType,
-					Text: "Your status has been cleared :boom:",
+					Text: clearedText,
 				},
 			},
 		}},
@@ -209,20 +475,27 @@ func (a *App) ClearStatus(r ClearStatusRequest) (slack.Msg, error) {
 }
 
 func (a *App) ListTriggers(r ListTriggersRequest) (slack.Msg, error) {
-	fmt.Printf("%s /list-trigger for %s(%s) on %s(%s)\n",
-		now(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+	fmt.Printf("%s /list-trigger global=%t for %s(%s) on %s(%s)\n",
+		now(), r.Global, r.UserName, r.SlackId, r.TeamName, r.TeamId)
 
 	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
 	if err != nil {
-		return a.handleUserNotRegistered(), nil
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
 	}
 
-	userDir := userId + "/"
-	blobNames, err := a.Storage.ListContainer("triggers", userDir)
+	triggers, err := a.listTriggers(userId, r.TeamId, r.Global)
 	if err != nil {
 		return slack.Msg{}, err
 	}
 
+	headerText := "Here are the triggers that you have defined for this workspace:"
+	if r.Global {
+		headerText = "Here are the global triggers that you have defined:"
+	}
+
 	msg := slack.Msg{
 		ResponseType: slack.ResponseTypeEphemeral,
 		Blocks: slack.Blocks{BlockSet: []slack.Block{
@@ -230,59 +503,189 @@ func (a *App) ListTriggers(r ListTriggersRequest) (slack.Msg, error) {
 				Type: slack.MBTSection,
 				Text: &slack.TextBlockObject{
 					Type: slack.MarkdownType,
-					Text: "Here are the triggers that you have defined:",
+					Text: headerText,
 				},
 			},
 			slack.NewDividerBlock(),
 		}},
 	}
 
+	for _, trigger := range triggers {
+		msg.Blocks.BlockSet = append(msg.Blocks.BlockSet, triggerSection(trigger), triggerButtons(trigger.Name))
+	}
+
+	sequences, err := a.listSequences(userId, r.TeamId, r.Global)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+	if len(sequences) > 0 {
+		user, err := a.getCurrentUser(userId)
+		if err != nil {
+			return slack.Msg{}, err
+		}
+		loc := a.userLocation(user, r.SlackId)
+
+		var progress []string
+		for _, sequence := range sequences {
+			progress = append(progress, sequence.ToString(loc))
+		}
+		msg.Blocks.BlockSet = append(msg.Blocks.BlockSet,
+			slack.NewDividerBlock(),
+			markdownSection(fmt.Sprintf("*In Progress*\n%s\nRun `/clear-status` to stop.", strings.Join(progress, "\n"))))
+	}
+
+	return msg, nil
+}
+
+// listTriggers returns the user's global triggers, and when global is false,
+// the triggers defined for the workspace too.
+func (a *App) listTriggers(userId string, teamId string, global bool) ([]ActionTemplate, error) {
+	allTriggers, err := a.getAllTriggers(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var triggers []ActionTemplate
+	for _, trigger := range allTriggers {
+		// Global triggers are listed everywhere, workspace triggers only where they were created
+		if global && !trigger.Global || !global && !trigger.AppliesTo(teamId) {
+			continue
+		}
+
+		triggers = append(triggers, trigger)
+	}
+
+	return triggers, nil
+}
+
+// getAllTriggers returns every trigger that the user has defined, on any workspace.
+func (a *App) getAllTriggers(userId string) ([]ActionTemplate, error) {
+	userDir := userId + "/"
+	blobNames, err := a.Storage.ListContainer("triggers", userDir)
+	if err != nil {
+		return nil, err
+	}
+
+	triggers := make([]ActionTemplate, 0, len(blobNames))
 	for _, blobName := range blobNames {
 		triggerName := strings.TrimPrefix(blobName, userDir)
 		trigger, err := a.getTrigger(userId, triggerName)
 		if err != nil {
-			return slack.Msg{}, err
+			return nil, err
 		}
+		triggers = append(triggers, trigger)
+	}
 
-		triggerBlock := slack.SectionBlock{
-			Type: slack.MBTSection,
-			Fields: []*slack.TextBlockObject{
-				{
-					Type: slack.MarkdownType,
-					Text: fmt.Sprintf("*Name*: %s\n*Status*: %s\n*Do Not Disturb*: %t\n*Default Duration*: %s",
-						trigger.Name, trigger.StatusText, trigger.DnD, trigger.Duration),
-				},
-				{
-					Type: slack.MarkdownType,
-					Text: trigger.StatusEmoji,
-				},
+	return triggers, nil
+}
+
+func triggerSection(trigger ActionTemplate) slack.SectionBlock {
+	return slack.SectionBlock{
+		Type: slack.MBTSection,
+		Fields: []*slack.TextBlockObject{
+			{
+				Type: slack.MarkdownType,
+				Text: fmt.Sprintf("*Name*: %s\n*Status*: %s\n*Do Not Disturb*: %t\n*Default Duration*: %s\n*Scope*: %s%s%s",
+					trigger.Name, trigger.StatusText, trigger.DnD, trigger.Duration, trigger.ScopeText(),
+					workspaceOverridesText(trigger.Workspaces), stepsText(trigger.Steps)),
 			},
-		}
-		msg.Blocks.BlockSet = append(msg.Blocks.BlockSet, triggerBlock)
+			{
+				Type: slack.MarkdownType,
+				Text: trigger.StatusEmoji,
+			},
+		},
 	}
+}
 
-	return msg, nil
+// stepsText lists the steps that run after a trigger's action.
+func stepsText(steps []TriggerStep) string {
+	text := ""
+	for _, step := range steps {
+		text += fmt.Sprintf("\n*Then*: %s", step.ToString())
+	}
+	return text
 }
 
 func (a *App) Trigger(r TriggerRequest) (slack.Msg, error) {
 	fmt.Printf("%s /trigger %s from %s(%s) on %s(%s)\n",
-		now(), r.GetName(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+		now(), r.Text, r.UserName, r.SlackId, r.TeamName, r.TeamId)
 
 	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
 	if err != nil {
-		return a.handleUserNotRegistered(), nil
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
+	}
+
+	name, overrides, err := r.Parse()
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	action, err := a.getTrigger(userId, name)
+	if err == nil && !action.AppliesTo(r.TeamId) {
+		// Workspace triggers can only be run from the workspace where they were created
+		err = TriggerNotFoundError{Name: name}
+	}
+	if err != nil {
+		if IsNotFound(err) {
+			return a.suggestTriggers(userId, r.TeamId, r.Text, triggerActionRun, err)
+		}
+		return slack.Msg{}, err
+	}
+
+	user, err := a.getCurrentUser(userId)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	steps, err := expandTriggerSteps(action, a.triggerLookup(userId))
+	if err != nil {
+		return slack.Msg{}, err
+	}
+	if len(overrides.Args) > 0 && !takesArgs(steps) {
+		return slack.Msg{}, errors.Errorf("unexpected %q in /trigger %s, the status text of %s doesn't use {{.Arg N}}. Try /trigger NAME [for DURATION | until END] [DND|NODND]",
+			overrides.Args[0], r.Text, action.Name)
+	}
+
+	triggered, changes := overrides.Apply(steps[0])
+
+	// Only look up the time zone when the trigger depends on it
+	run := triggerRun{Args: overrides.Args, Start: time.Now()}
+	if needsLocation(append([]Action{triggered}, steps[1:]...)) {
+		run.Location = a.userLocation(user, r.SlackId)
 	}
 
-	action, err := a.getTrigger(userId, r.GetName())
+	triggered, err = resolveEndTime(triggered, run.Start.In(run.location()), user.Settings)
 	if err != nil {
 		return slack.Msg{}, err
 	}
 
-	err = a.applyActionToAllSlacks(userId, action.Action)
+	err = a.applyActionToSlacks(userId, action.ScopeTeamId(), triggered, run)
 	if err != nil {
 		return slack.Msg{}, err
 	}
 
+	// Replace the steps of the last trigger that was run with the steps of this one
+	if len(steps) > 1 {
+		d, _ := triggered.ParseDuration()
+		err = a.startSequence(userId, run, action, steps, run.Start.Add(d))
+	} else {
+		err = a.cancelReplacedSequences(userId, action.ScopeTeamId())
+	}
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	overrideText := ""
+	if len(changes) > 0 {
+		overrideText = fmt.Sprintf(" (%s)", strings.Join(changes, ", "))
+	}
+	if len(steps) > 1 {
+		overrideText += fmt.Sprintf(", then %d more steps", len(steps)-1)
+	}
+
 	msg := slack.Msg{
 		Type: slack.ResponseTypeEphemeral,
 		Blocks: slack.Blocks{BlockSet: []slack.Block{
@@ -290,7 +693,7 @@ func (a *App) Trigger(r TriggerRequest) (slack.Msg, error) {
 				Type: slack.MBTSection,
 				Text: &slack.TextBlockObject{
 					Type: slack.MarkdownType,
-					Text: fmt.Sprintf("Triggered *%s* %s", action.Name, action.StatusEmoji),
+					Text: fmt.Sprintf("Triggered *%s* %s%s", action.Name, action.StatusEmoji, overrideText),
 				},
 			},
 		}},
@@ -303,11 +706,11 @@ func (a *App) RefreshOAuthToken(r OAuthRequest) (string, error) {
 	fmt.Printf("%s /oauth from %s\n",
 		now(), r.UserId)
 
-	clientId, err := a.GetSlackClientId()
+	clientId, err := GetSlackClientId(a.Secrets)
 	if err != nil {
 		return "", err
 	}
-	clientSecret, err := a.GetSlackClientSecret()
+	clientSecret, err := GetSlackClientSecret(a.Secrets)
 	if err != nil {
 		return "", err
 	}
@@ -329,9 +732,12 @@ func (a *App) RefreshOAuthToken(r OAuthRequest) (string, error) {
 	}
 
 	var userId string
-	existingUser, err := a.getSlackToken(tr.User.Id)
-	if err == nil && existingUser.UserId != "" {
-		userId = existingUser.UserId
+	existingId, err := a.getIdentity(tr.User.Id)
+	if err != nil && !IsNotFound(err) {
+		return "", err
+	}
+	if err == nil && existingId.UserId != "" {
+		userId = existingId.UserId
 	} else if r.UserId != "" {
 		userId = r.UserId
 	} else {
@@ -343,23 +749,36 @@ func (a *App) RefreshOAuthToken(r OAuthRequest) (string, error) {
 	}
 
 	t := SlackToken{
-		UserId:      userId,
 		SlackId:     tr.User.Id,
 		AccessToken: tr.User.AccessToken,
-		TeamId:      tr.Team.Id,
-		Scopes:      tr.User.Scopes,
 	}
 	err = a.setSlackToken(t)
 	if err != nil {
 		return "", errors.Wrapf(err, "error saving oauth token for %s on %s(%s)", tr.User.Id, tr.Team.Name, tr.Team.Id)
 	}
 
-	user, err := a.getCurrentUser(userId)
+	if tr.AccessToken != "" {
+		err = a.setBotToken(tr.Team.Id, tr.AccessToken)
+		if err != nil {
+			return "", errors.Wrapf(err, "error saving bot token for %s(%s)", tr.Team.Name, tr.Team.Id)
+		}
+	}
+
+	id := Identity{
+		SlackId:  tr.User.Id,
+		UserId:   userId,
+		TeamId:   tr.Team.Id,
+		TeamName: tr.Team.Name,
+		Scopes:   tr.User.Scopes,
+	}
+	err = a.setIdentity(id)
 	if err != nil {
-		return "", err
+		return "", errors.Wrapf(err, "error saving identity for %s on %s(%s)", tr.User.Id, tr.Team.Name, tr.Team.Id)
 	}
-	user.AddSlackUser(tr.User.Id, tr.Team.Id)
-	err = a.setCurrentUser(user)
+
+	_, err = a.updateCurrentUser(userId, func(user *User) {
+		user.AddSlackUser(tr.User.Id, tr.Team.Id)
+	})
 	if err != nil {
 		return "", errors.Wrapf(err, "error saving user mapping for %s -> %s", userId, tr.User.Id)
 	}
@@ -373,11 +792,14 @@ func (a *App) LinkSlack(r SlackPayload) (slack.Msg, error) {
 
 	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
 	if err != nil {
-		return a.handleUserNotRegistered(), nil
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
 	}
 
 	oauthUrl := "https://slack.com/oauth/v2/authorize"
-	scopes := "commands&user_scope=dnd:read,dnd:write,users:write,users.profile:write"
+	scopes := "commands&user_scope=dnd:read,dnd:write,users:read,users:write,users.profile:read,users.profile:write"
 	clientId := "2413351231.504877832356"
 	magiclink := fmt.Sprintf("%s?scope=%s&client_id=%s&state=%s",
 		oauthUrl, scopes, clientId, userId)
@@ -398,49 +820,84 @@ func (a *App) LinkSlack(r SlackPayload) (slack.Msg, error) {
 	return msg, nil
 }
 
-func (a *App) applyActionToAllSlacks(userId string, action Action) error {
+// applyActionToSlacks updates the user's status on the linked Slack account
+// for a workspace, or on every linked account when teamId is empty. The
+// status text is filled in separately for each workspace.
+func (a *App) applyActionToSlacks(userId string, teamId string, action Action, run triggerRun) error {
 	user, err := a.getCurrentUser(userId)
 	if err != nil {
 		return err
 	}
 
+	var slackUsers []SlackUser
+	for _, slackUser := range user.SlackUsers {
+		if teamId != "" && slackUser.TeamID != teamId {
+			continue
+		}
+		if _, ok := action.ForWorkspace(slackUser.TeamID); !ok {
+			continue
+		}
+		slackUsers = append(slackUsers, slackUser)
+	}
+
+	// Remember the current status so that it can be restored with /undo-status
+	err = a.snapshotSlackStatuses(userId, slackUsers)
+	if err != nil {
+		fmt.Printf("Could not save status history for %s: %v\n", userId, err)
+	}
+
 	var g errgroup.Group
 	// TODO: collect the failed team names, right now we don't have the team name, just id
-	for _, slackUser := range user.SlackUsers {
-		slackId := slackUser.ID
+	for _, slackUser := range slackUsers {
+		slackUser := slackUser
 		g.Go(func() error {
-			return a.updateSlackStatus(slackId, action)
+			workspaceAction, _ := action.ForWorkspace(slackUser.TeamID)
+			if isStatusTemplate(workspaceAction.StatusText) {
+				workspace := slackUser.TeamID
+				if id, err := a.getIdentity(slackUser.ID); err == nil && id.TeamName != "" {
+					workspace = id.TeamName
+				}
+
+				text, err := run.renderStatusText(workspaceAction, workspace)
+				if err != nil {
+					return err
+				}
+				workspaceAction.StatusText = text
+			}
+			return a.updateSlackStatus(userId, slackUser, workspaceAction)
 		})
 	}
 
 	return g.Wait()
 }
 
-func (a *App) updateSlackStatus(slackId string, action Action) error {
+func (a *App) updateSlackStatus(userId string, slackUser SlackUser, action Action) error {
+	slackId := slackUser.ID
 	token, err := a.getSlackToken(slackId)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Updating slack status for %s (%s) on team %s to %#v\n", token.UserId, token.SlackId, token.TeamId, action)
+	fmt.Printf("Updating slack status for %s (%s) on team %s to %#v\n", userId, slackId, slackUser.TeamID, action)
 
 	api := slack.New(token.AccessToken, slack.OptionDebug(a.Debug))
+	start := time.Now()
 
 	var g errgroup.Group
 
 	g.Go(func() error {
-		err = api.SetUserPresence(string(action.Presence))
+		err := api.SetUserPresence(string(action.Presence))
 		return errors.Wrap(err, "could not set presence")
 	})
 
 	g.Go(func() error {
-		err = api.SetUserCustomStatus(action.StatusText, action.StatusEmoji, action.DurationInMinutes())
+		err := api.SetUserCustomStatus(action.StatusText, action.StatusEmoji, action.ExpirationTime(start))
 		return errors.Wrap(err, "could not set status")
 	})
 
 	g.Go(func() error {
 		if action.DnD {
-			_, err = api.SetSnooze(int(action.DurationInMinutes()))
+			_, err := api.SetSnooze(int(action.DurationInMinutes()))
 			return errors.Wrap(err, "could not set do not disturb")
 		}
 
@@ -456,40 +913,95 @@ func (a *App) updateSlackStatus(slackId string, action Action) error {
 		return nil
 	})
 
-	return g.Wait()
+	err = g.Wait()
+	if err != nil {
+		return err
+	}
+
+	// Presence doesn't expire on its own, so remember to put it back later
+	err = a.scheduleRevert(userId, slackUser, action, start)
+	return errors.Wrapf(err, "could not schedule status revert for %s on team %s", userId, slackUser.TeamID)
 }
 
 // CreateTrigger accepts a trigger definition and saves it
 func (a *App) CreateTrigger(r CreateTriggerRequest) (slack.Msg, error) {
-	fmt.Printf("%s /create-trigger %q from %s(%s) on %s(%s)\n",
-		now(), r.GetDefinition(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+	fmt.Printf("%s /create-trigger %q global=%t from %s(%s) on %s(%s)\n",
+		now(), r.GetDefinition(), r.Global, r.UserName, r.SlackId, r.TeamName, r.TeamId)
 
 	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
 	if err != nil {
-		return a.handleUserNotRegistered(), nil
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
 	}
 
-	tmpl, err := parseTemplate(r.GetDefinition())
+	user, err := a.getCurrentUser(userId)
 	if err != nil {
 		return slack.Msg{}, err
 	}
 
-	tmpl.TeamId = r.TeamId
-	tmplB, err := json.Marshal(tmpl)
+	if strings.TrimSpace(r.GetDefinition()) == "" {
+		// Let them fill in the trigger with a form instead
+		tmpl := ActionTemplate{
+			TeamId: r.TeamId,
+			Global: r.Global,
+			Action: Action{
+				Presence: PresenceAway,
+				Duration: user.Settings.DefaultDuration,
+			},
+		}
+		if user.Settings.DefaultDnD != nil {
+			tmpl.DnD = *user.Settings.DefaultDnD
+		}
+		err = a.openTriggerEditor(r.SlackId, r.TriggerId, tmpl, false)
+		return slack.Msg{}, err
+	}
+
+	tmpl, err := parseTemplate(r.GetDefinition(), user.Settings)
 	if err != nil {
-		return slack.Msg{}, errors.Wrapf(err, "error marshaling trigger %s for %s(%s) on %s(%s): %#v",
-			tmpl.Name, r.UserName, r.SlackId, r.TeamName, r.TeamId, tmpl)
+		return slack.Msg{}, err
 	}
 
-	key := path.Join(userId, tmpl.Name)
-	err = a.Storage.SetBlob("triggers", key, tmplB)
+	tmpl.TeamId = r.TeamId
+	tmpl.Global = r.Global
+
+	// Catch loops and missing triggers now instead of when it runs
+	_, err = expandTriggerSteps(tmpl, a.triggerLookup(userId, tmpl))
 	if err != nil {
 		return slack.Msg{}, err
 	}
 
+	var scopeErr error
+	err = a.updateTrigger(userId, tmpl.Name, func(existing *ActionTemplate) error {
+		scopeErr = tmpl.checkScope(*existing)
+		if scopeErr != nil {
+			return scopeErr
+		}
+
+		// Keep the differences for each workspace, they are changed with /override-trigger
+		if tmpl.Global {
+			tmpl.Workspaces = existing.Workspaces
+		}
+		*existing = tmpl
+		return nil
+	})
+	if scopeErr != nil {
+		return slack.Msg{}, scopeErr
+	}
+	if err != nil {
+		return slack.Msg{}, errors.Wrapf(err, "error saving trigger %s for %s(%s) on %s(%s)",
+			tmpl.Name, r.UserName, r.SlackId, r.TeamName, r.TeamId)
+	}
+
+	createdText := fmt.Sprintf("Created trigger %s for this workspace", tmpl.Name)
+	if tmpl.Global {
+		createdText = fmt.Sprintf("Created trigger %s for all workspaces", tmpl.Name)
+	}
+
 	msg := slack.Msg{
 		Type: slack.ResponseTypeEphemeral,
-		Text: fmt.Sprintf("Created trigger %s", tmpl.Name),
+		Text: createdText,
 	}
 	return msg, nil
 }
@@ -500,14 +1012,22 @@ func (a *App) DeleteTrigger(r DeleteTriggerRequest) (slack.Msg, error) {
 
 	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
 	if err != nil {
-		return a.handleUserNotRegistered(), nil
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
+	}
+
+	key, err := triggerKey(userId, r.GetName())
+	if err != nil {
+		return slack.Msg{}, err
 	}
 
-	key := path.Join(userId, r.GetName())
 	err = a.Storage.DeleteBlob("triggers", key)
 	if err != nil {
-		if strings.Contains(err.Error(), "BlobNotFound") {
-			return slack.Msg{}, errors.Errorf("Could not delete trigger %q because it is not defined", r.GetName())
+		if IsNotFound(err) {
+			notFound := errors.Errorf("Could not delete trigger %q because it is not defined", r.GetName())
+			return a.suggestTriggers(userId, r.TeamId, r.GetName(), triggerActionDelete, notFound)
 		}
 		return slack.Msg{}, err
 	}
@@ -528,12 +1048,29 @@ func (a *App) DeleteTrigger(r DeleteTriggerRequest) (slack.Msg, error) {
 	return msg, nil
 }
 
+// TriggerNotFoundError is returned when the user hasn't defined a trigger.
+type TriggerNotFoundError struct {
+	Name string
+}
+
+func (e TriggerNotFoundError) Error() string {
+	return fmt.Sprintf("trigger %s not registered", e.Name)
+}
+
+func (e TriggerNotFoundError) NotFound() bool {
+	return true
+}
+
 func (a *App) getTrigger(userId string, name string) (ActionTemplate, error) {
-	key := path.Join(userId, name)
+	key, err := triggerKey(userId, name)
+	if err != nil {
+		return ActionTemplate{}, err
+	}
+
 	b, err := a.Storage.GetBlob("triggers", key)
 	if err != nil {
-		if strings.Contains(err.Error(), "BlobNotFound") {
-			return ActionTemplate{}, errors.Errorf("trigger %s not registered", name)
+		if IsNotFound(err) {
+			return ActionTemplate{}, TriggerNotFoundError{Name: name}
 		}
 		return ActionTemplate{}, err
 	}
@@ -547,12 +1084,67 @@ func (a *App) getTrigger(userId string, name string) (ActionTemplate, error) {
 	return action, nil
 }
 
-func (a *App) lookupUserIdFromSlackId(slackId string) (string, error) {
-	slackToken, err := a.getSlackToken(slackId)
+// updateTrigger applies a change to a trigger, retrying when the trigger is
+// modified by another request at the same time. The trigger is created
+// when it doesn't exist yet.
+func (a *App) updateTrigger(userId string, name string, update func(tmpl *ActionTemplate) error) error {
+	key, err := triggerKey(userId, name)
 	if err != nil {
+		return err
+	}
+
+	return updateBlob(a.Storage, "triggers", key, func(data []byte) ([]byte, error) {
+		tmpl := ActionTemplate{Name: name}
+		if data != nil {
+			err := json.Unmarshal(data, &tmpl)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error unmarshaling trigger %s: %s", name, string(data))
+			}
+		}
+
+		err := update(&tmpl)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := json.Marshal(tmpl)
+		return b, errors.Wrapf(err, "error marshaling trigger %s: %#v", name, tmpl)
+	})
+}
+
+// createTrigger saves a new trigger, returning a ConflictError instead of
+// overwriting a trigger that the user already has with the same name.
+func (a *App) createTrigger(userId string, tmpl ActionTemplate) error {
+	key, err := triggerKey(userId, tmpl.Name)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(tmpl)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling trigger %s: %#v", tmpl.Name, tmpl)
+	}
+
+	return a.Storage.SetBlobIfMatch("triggers", key, b, ETagNone)
+}
+
+// validateTriggerName checks a trigger name before it is used in a storage
+// key, so that it can't point at another user's triggers or another
+// workspace's library.
+func validateTriggerName(name string) error {
+	if !triggerNamePattern.MatchString(name) {
+		return errors.Errorf("Invalid name %q, use letters, numbers, dashes and underscores", name)
+	}
+	return nil
+}
+
+// triggerKey builds the storage key for a trigger that belongs to a user,
+// or to the library of a workspace.
+func triggerKey(ownerId string, name string) (string, error) {
+	if err := validateTriggerName(name); err != nil {
 		return "", err
 	}
-	return slackToken.UserId, nil
+	return path.Join(ownerId, name), nil
 }
 
 func (a *App) handleUserNotRegistered() slack.Msg {
@@ -576,6 +1168,7 @@ func (a *App) handleUserNotRegistered() slack.Msg {
 type User struct {
 	ID         string      `json:"id"`
 	SlackUsers []SlackUser `json:"slack-users"`
+	Settings   Settings    `json:"settings"`
 }
 
 type SlackUser struct {
@@ -593,72 +1186,62 @@ func (u *User) AddSlackUser(slackId, teamId string) {
 	u.SlackUsers = append(u.SlackUsers, SlackUser{ID: slackId, TeamID: teamId})
 }
 
+func (u *User) RemoveSlackUser(slackId string) {
+	for i, su := range u.SlackUsers {
+		if su.ID == slackId {
+			u.SlackUsers = append(u.SlackUsers[:i], u.SlackUsers[i+1:]...)
+			return
+		}
+	}
+}
+
 func (a *App) getCurrentUser(userId string) (User, error) {
 	b, err := a.Storage.GetBlob("users", userId)
 	if err != nil {
-		if strings.Contains(err.Error(), "BlobNotFound") {
+		if IsNotFound(err) {
 			return User{ID: userId}, nil
 		}
 		return User{}, err
 	}
 
-	var user User
-	err = json.Unmarshal(b, &user)
-	if err != nil {
-		return User{}, errors.Wrapf(err, "error parsing user configuration for %q", userId)
-	}
-
-	return user, nil
+	return parseUser(userId, b)
 }
 
-func (a *App) setCurrentUser(user User) error {
-	userId := user.ID
+// updateCurrentUser applies a change to a user, retrying when the user is
+// modified by another request at the same time.
+func (a *App) updateCurrentUser(userId string, update func(user *User)) (User, error) {
 	if userId == "" {
-		return errors.New("cannot save user, no ID was given")
+		return User{}, errors.New("cannot save user, no ID was given")
 	}
 
-	b, err := json.Marshal(user)
-	if err != nil {
-		return errors.Wrapf(err, "error marshaling user\n%#v", user)
-	}
+	var user User
+	err := updateBlob(a.Storage, "users", userId, func(data []byte) ([]byte, error) {
+		user = User{ID: userId}
+		if data != nil {
+			var err error
+			user, err = parseUser(userId, data)
+			if err != nil {
+				return nil, err
+			}
+		}
 
-	return a.Storage.SetBlob("users", userId, b)
-}
+		update(&user)
 
-// parseAction definition into an Action
-// Example:
-// vacation = vacay (🌴) DND for 1w
-// name = vacation
-// status = vacay
-// emoji = 🌴
-// DND = Yes
-// duration = 1w
-func parseTemplate(def string) (ActionTemplate, error) {
-	// Test out at https://regex101.com/r/8v180Z/5
-	const pattern = `^([\w-_]+)[ ]?=(?:[ ]?(.+))?[ ]+\((.*)\)( DND)?(?: for (\d[wdhms]+))?$`
-	r := regexp.MustCompile(pattern)
-	match := r.FindStringSubmatch(def)
-	if len(match) == 0 {
-		return ActionTemplate{}, errors.Errorf("Invalid trigger definition %q. Try /create-trigger vacation = I'm on a boat! (⛵️) DND for 1w", def)
-	}
-
-	template := ActionTemplate{
-		Name: match[1],
-		Action: Action{
-			Presence:    PresenceAway,
-			StatusText:  match[2],
-			StatusEmoji: match[3],
-			DnD:         match[4] != "",
-			Duration:    match[5],
-		},
-	}
+		b, err := json.Marshal(user)
+		return b, errors.Wrapf(err, "error marshaling user\n%#v", user)
+	})
+
+	return user, err
+}
 
-	_, err := template.ParseDuration()
+func parseUser(userId string, data []byte) (User, error) {
+	var user User
+	err := json.Unmarshal(data, &user)
 	if err != nil {
-		return ActionTemplate{}, errors.Errorf("invalid duration in trigger definition %q, here are some examples: 15m, 1h, 2d, 1w", template.Duration)
+		return User{}, errors.Wrapf(err, "error parsing user configuration for %q", userId)
 	}
 
-	return template, nil
+	return user, nil
 }
 
 const (
@@ -667,49 +1250,57 @@ const (
 )
 
 type SlackToken struct {
-	UserId      string
 	SlackId     string
 	AccessToken string
-	TeamId      string
-	Scopes      string
 }
 
 func (a *App) getSlackToken(slackId string) (SlackToken, error) {
-	accessToken, tags, err := a.GetSecret("oauth-" + slackId)
+	accessToken, _, err := a.GetSecret("oauth-" + slackId)
 	if err != nil {
 		return SlackToken{}, err
 	}
-
-	getTag := func(key string) string {
-		value, ok := tags[key]
-		if !ok {
-			return ""
-		}
-		return *value
+	if accessToken == "" {
+		// The token was revoked
+		return SlackToken{}, SecretNotFoundError{Key: "oauth-" + slackId}
 	}
 
 	t := SlackToken{
-		UserId:      getTag("user"),
 		SlackId:     slackId,
 		AccessToken: accessToken,
-		TeamId:      getTag("team"),
-		Scopes:      getTag("scopes"),
-	}
-
-	if t.UserId == "" {
-		return t, errors.Errorf("Slack user %s has not authorized the Slack Overload app", slackId)
 	}
-
 	return t, nil
 }
 
 func (a *App) setSlackToken(t SlackToken) error {
-	tags := map[string]*string{
-		"user":   &t.UserId,
-		"team":   &t.TeamId,
-		"scopes": &t.Scopes,
+	return a.SetSecret("oauth-"+t.SlackId, t.AccessToken, nil)
+}
+
+// revokeSlackToken forgets the token for a Slack account. Not every secrets
+// backend can delete a secret, so the token is cleared instead.
+func (a *App) revokeSlackToken(slackId string) error {
+	return a.SetSecret("oauth-"+slackId, "", nil)
+}
+
+// getBotToken returns the token for acting as the app on a workspace,
+// instead of as a user, such as when publishing the App Home.
+func (a *App) getBotToken(teamId string) (string, error) {
+	token, _, err := a.GetSecret("bot-" + teamId)
+	if err != nil {
+		return "", err
 	}
-	return a.SetSecret("oauth-"+t.SlackId, t.AccessToken, tags)
+	if token == "" {
+		// The token was revoked
+		return "", SecretNotFoundError{Key: "bot-" + teamId}
+	}
+	return token, nil
+}
+
+func (a *App) setBotToken(teamId string, token string) error {
+	return a.SetSecret("bot-"+teamId, token, nil)
+}
+
+func (a *App) revokeBotToken(teamId string) error {
+	return a.SetSecret("bot-"+teamId, "", nil)
 }
 
 func now() string {
@@ -0,0 +1,322 @@
+package slackoverload
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// contendedStorage makes the first reads wait for each other, so that every
+// request starts from the same version of a blob and conflicts on write.
+type contendedStorage struct {
+	Storage
+	reads     int32
+	readers   int32
+	ready     sync.WaitGroup
+	conflicts int32
+}
+
+func newContendedStorage(s Storage, readers int) *contendedStorage {
+	c := &contendedStorage{Storage: s, readers: int32(readers)}
+	c.ready.Add(readers)
+	return c
+}
+
+func (s *contendedStorage) GetBlobVersion(containerName string, blobName string) ([]byte, ETag, error) {
+	data, etag, err := s.Storage.GetBlobVersion(containerName, blobName)
+	if atomic.AddInt32(&s.reads, 1) <= s.readers {
+		s.ready.Done()
+		s.ready.Wait()
+	}
+	return data, etag, err
+}
+
+func (s *contendedStorage) SetBlobIfMatch(containerName string, blobName string, data []byte, etag ETag) error {
+	err := s.Storage.SetBlobIfMatch(containerName, blobName, data, etag)
+	if IsConflict(err) {
+		atomic.AddInt32(&s.conflicts, 1)
+	}
+	return err
+}
+
+func TestUpdateCurrentUser_Concurrent(t *testing.T) {
+	testcases := map[string]func(t *testing.T) Storage{
+		StorageMemory: func(t *testing.T) Storage {
+			return NewMemoryStorage()
+		},
+		StorageFilesystem: func(t *testing.T) Storage {
+			s, err := NewFilesystemStorage(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+	}
+
+	for backend, newStorage := range testcases {
+		t.Run(backend, func(t *testing.T) {
+			// Each conflict means that another request saved, so every request
+			// succeeds within the retry limit when there are that many of them.
+			n := maxConflictRetries
+			s := newContendedStorage(newStorage(t), n)
+			a := &App{Storage: s}
+
+			var wg sync.WaitGroup
+			errs := make([]error, n)
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_, errs[i] = a.updateCurrentUser("u1", func(user *User) {
+						user.AddSlackUser(fmt.Sprintf("U%d", i), fmt.Sprintf("T%d", i))
+					})
+				}(i)
+			}
+			wg.Wait()
+
+			for i, err := range errs {
+				if err != nil {
+					t.Fatalf("linking slack user U%d failed instead of retrying: %v", i, err)
+				}
+			}
+			if s.conflicts < int32(n-1) {
+				t.Fatalf("expected at least %d conflicts, got %d", n-1, s.conflicts)
+			}
+
+			user, err := a.getCurrentUser("u1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(user.SlackUsers) != n {
+				t.Fatalf("expected %d slack users, got %v", n, user.SlackUsers)
+			}
+			for i := 0; i < n; i++ {
+				if !hasSlackUser(user, fmt.Sprintf("U%d", i)) {
+					t.Fatalf("slack user U%d was lost, got %v", i, user.SlackUsers)
+				}
+			}
+		})
+	}
+}
+
+func hasSlackUser(user User, slackId string) bool {
+	for _, su := range user.SlackUsers {
+		if su.ID == slackId {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTriggerRequest_Parse(t *testing.T) {
+	on, off := true, false
+	testcases := []struct {
+		text      string
+		name      string
+		overrides TriggerOverrides
+		wantErr   string
+	}{
+		{text: "lunch", name: "lunch"},
+		{text: "lunch for 2h", name: "lunch", overrides: TriggerOverrides{Duration: "2h"}},
+		{text: "lunch FOR 1d12h", name: "lunch", overrides: TriggerOverrides{Duration: "1d12h"}},
+		{text: "lunch until Monday 9am", name: "lunch", overrides: TriggerOverrides{Until: "Monday 9am"}},
+		{text: "lunch for 1h until end of day", name: "lunch", overrides: TriggerOverrides{Until: "end of day"}},
+		{text: "lunch until 5pm for 1h", name: "lunch", overrides: TriggerOverrides{Duration: "1h"}},
+		{text: "lunch DND", name: "lunch", overrides: TriggerOverrides{DnD: &on}},
+		{text: "lunch nodnd", name: "lunch", overrides: TriggerOverrides{DnD: &off}},
+		{
+			text:      `meeting "with design" for 2h NODND`,
+			name:      "meeting",
+			overrides: TriggerOverrides{Duration: "2h", DnD: &off, Args: []string{"with design"}},
+		},
+		{
+			text:      `meeting design "for real" review`,
+			name:      "meeting",
+			overrides: TriggerOverrides{Args: []string{"design", "for real", "review"}},
+		},
+		{text: "", wantErr: "Which trigger?"},
+		{text: "lunch for", wantErr: "missing duration"},
+		{text: "lunch until", wantErr: "invalid end time"},
+		{text: "lunch until whenever", wantErr: "invalid end time"},
+		{text: "lunch for soon", wantErr: "invalid duration"},
+		{text: "lunch for -5m", wantErr: "invalid duration"},
+		{text: "lunch for 0s", wantErr: "invalid duration"},
+		{text: `lunch "brb`, wantErr: "missing closing quote"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.text, func(t *testing.T) {
+			name, overrides, err := TriggerRequest{SlackPayload{Text: tc.text}}.Parse()
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != tc.name {
+				t.Fatalf("expected the trigger %q, got %q", tc.name, name)
+			}
+			if !reflect.DeepEqual(tc.overrides, overrides) {
+				t.Fatalf("expected %#v, got %#v", tc.overrides, overrides)
+			}
+		})
+	}
+}
+
+// newTwoWorkspaceApp returns an app where the user u1 has linked U1 on T1 and U2 on T2.
+func newTwoWorkspaceApp(t *testing.T) *App {
+	a := &App{Storage: NewMemoryStorage()}
+	for _, id := range []Identity{
+		{SlackId: "U1", UserId: "u1", TeamId: "T1"},
+		{SlackId: "U2", UserId: "u1", TeamId: "T2"},
+	} {
+		if err := a.setIdentity(id); err != nil {
+			t.Fatal(err)
+		}
+		id := id
+		_, err := a.updateCurrentUser(id.UserId, func(user *User) {
+			user.AddSlackUser(id.SlackId, id.TeamId)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return a
+}
+
+func TestCreateTrigger_Scope(t *testing.T) {
+	onT1 := SlackPayload{SlackId: "U1", TeamId: "T1"}
+	onT2 := SlackPayload{SlackId: "U2", TeamId: "T2"}
+
+	testcases := []struct {
+		name    string
+		first   CreateTriggerRequest
+		second  CreateTriggerRequest
+		wantErr string
+	}{
+		{
+			name:   "update a workspace trigger",
+			first:  CreateTriggerRequest{SlackPayload: onT1},
+			second: CreateTriggerRequest{SlackPayload: onT1},
+		},
+		{
+			name:   "update a global trigger",
+			first:  CreateTriggerRequest{SlackPayload: onT1, Global: true},
+			second: CreateTriggerRequest{SlackPayload: onT2, Global: true},
+		},
+		{
+			name:    "workspace trigger on another workspace",
+			first:   CreateTriggerRequest{SlackPayload: onT1},
+			second:  CreateTriggerRequest{SlackPayload: onT2},
+			wantErr: "on another workspace",
+		},
+		{
+			name:    "workspace trigger replaces a global trigger",
+			first:   CreateTriggerRequest{SlackPayload: onT1, Global: true},
+			second:  CreateTriggerRequest{SlackPayload: onT1},
+			wantErr: "already have a global trigger",
+		},
+		{
+			name:    "global trigger replaces a workspace trigger",
+			first:   CreateTriggerRequest{SlackPayload: onT1},
+			second:  CreateTriggerRequest{SlackPayload: onT1, Global: true},
+			wantErr: "for this workspace",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newTwoWorkspaceApp(t)
+
+			tc.first.Text = "lunch = first"
+			if _, err := a.CreateTrigger(tc.first); err != nil {
+				t.Fatal(err)
+			}
+			tc.second.Text = "lunch = second"
+			_, err := a.CreateTrigger(tc.second)
+
+			tmpl, getErr := a.getTrigger("u1", "lunch")
+			if getErr != nil {
+				t.Fatal(getErr)
+			}
+
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tmpl.StatusText != "second" || tmpl.TeamId != tc.second.TeamId || tmpl.Global != tc.second.Global {
+					t.Fatalf("expected the trigger to be updated, got %#v", tmpl)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+			}
+			if tmpl.StatusText != "first" || tmpl.TeamId != tc.first.TeamId || tmpl.Global != tc.first.Global {
+				t.Fatalf("expected the existing trigger to be kept, got %#v", tmpl)
+			}
+		})
+	}
+}
+
+func TestTrigger_OtherWorkspace(t *testing.T) {
+	a := newTwoWorkspaceApp(t)
+	_, err := a.CreateTrigger(CreateTriggerRequest{SlackPayload: SlackPayload{SlackId: "U1", TeamId: "T1", Text: "lunch = brb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = a.Trigger(TriggerRequest{SlackPayload{SlackId: "U2", TeamId: "T2", Text: "lunch"}})
+	if _, ok := errors.Cause(err).(TriggerNotFoundError); !ok {
+		t.Fatalf("expected a workspace trigger to not be found on another workspace, got %v", err)
+	}
+
+	// There aren't any tokens saved, so it can only get as far as changing the status
+	a.Secrets = ChainedSecrets{}
+	_, err = a.Trigger(TriggerRequest{SlackPayload{SlackId: "U1", TeamId: "T1", Text: "lunch"}})
+	if _, ok := errors.Cause(err).(SecretNotFoundError); !ok {
+		t.Fatalf("expected the trigger to run on its workspace, got %v", err)
+	}
+}
+
+func TestTriggerKey_InvalidNames(t *testing.T) {
+	a := newTwoWorkspaceApp(t)
+
+	// A trigger belonging to someone else, that a relative name could otherwise reach
+	err := a.Storage.SetBlob("triggers", "u2/lunch", []byte(`{"name":"lunch"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const name = "../u2/lunch"
+
+	_, err = a.DeleteTrigger(DeleteTriggerRequest{SlackPayload{SlackId: "U1", TeamId: "T1", Text: name}})
+	if err == nil || !strings.Contains(err.Error(), "Invalid name") {
+		t.Fatalf("expected delete to reject the name, got %v", err)
+	}
+	if _, err := a.getTrigger("u1", name); err == nil || IsNotFound(err) {
+		t.Fatalf("expected get to reject the name, got %v", err)
+	}
+	err = a.updateTrigger("u1", name, func(tmpl *ActionTemplate) error {
+		tmpl.StatusText = "mine now"
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "Invalid name") {
+		t.Fatalf("expected update to reject the name, got %v", err)
+	}
+	if b, err := a.Storage.GetBlob("triggers", "u2/lunch"); err != nil || string(b) != `{"name":"lunch"}` {
+		t.Fatalf("expected the other user's trigger to be untouched, got %s %v", b, err)
+	}
+
+	if _, err := parseSchedule(name + " weekdays 9am"); err == nil || !strings.Contains(err.Error(), "Invalid name") {
+		t.Fatalf("expected the schedule to reject the name, got %v", err)
+	}
+}
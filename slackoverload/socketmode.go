@@ -0,0 +1,254 @@
+package slackoverload
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+// Socket Mode receives slash commands, interactions and events over a
+// websocket, instead of Slack calling our public HTTP endpoints.
+// https://api.slack.com/apis/connections/socket
+
+const (
+	SocketModeTypeHello         = "hello"
+	SocketModeTypeDisconnect    = "disconnect"
+	SocketModeTypeSlashCommands = "slash_commands"
+	SocketModeTypeInteractive   = "interactive"
+	SocketModeTypeEventsAPI     = "events_api"
+)
+
+const (
+	// socketModeMinReconnectDelay is how long to wait before reconnecting after
+	// a failed connection, doubling up to socketModeMaxReconnectDelay.
+	socketModeMinReconnectDelay = time.Second
+	socketModeMaxReconnectDelay = time.Minute
+)
+
+// SocketModeEnvelope wraps every message sent to us over the websocket.
+type SocketModeEnvelope struct {
+	Type         string          `json:"type"`
+	EnvelopeId   string          `json:"envelope_id"`
+	Payload      json.RawMessage `json:"payload"`
+	RetryAttempt int             `json:"retry_attempt"`
+
+	// Reason explains why a disconnect was sent.
+	Reason string `json:"reason"`
+}
+
+// SocketModeAck acknowledges an envelope, optionally with a response such as
+// the message to reply to a slash command with.
+type SocketModeAck struct {
+	EnvelopeId string      `json:"envelope_id"`
+	Payload    interface{} `json:"payload,omitempty"`
+}
+
+// SocketModeClient connects to Slack with Socket Mode and runs what it
+// receives with the same handlers as the HTTP endpoints.
+type SocketModeClient struct {
+	Handler *SlackHandler
+
+	// AppToken is the app-level token with the connections:write scope.
+	AppToken string
+
+	// APIURL is the base URL for calling Slack Web API methods.
+	APIURL string
+
+	Dialer *websocket.Dialer
+}
+
+func NewSocketModeClient(h *SlackHandler, appToken string) *SocketModeClient {
+	return &SocketModeClient{
+		Handler:  h,
+		AppToken: appToken,
+		APIURL:   SlackAPIURL,
+		Dialer:   websocket.DefaultDialer,
+	}
+}
+
+// Run stays connected to Slack, reconnecting when Slack asks us to or when the
+// connection is lost.
+func (c *SocketModeClient) Run() {
+	delay := socketModeMinReconnectDelay
+	for {
+		connected, err := c.Connect()
+		if err != nil {
+			log.Printf("%v\n", err)
+		}
+
+		if connected {
+			// Slack asked us to reconnect, or a working connection dropped
+			delay = socketModeMinReconnectDelay
+			continue
+		}
+
+		fmt.Printf("%s reconnecting to Slack in %s\n", now(), delay)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > socketModeMaxReconnectDelay {
+			delay = socketModeMaxReconnectDelay
+		}
+	}
+}
+
+// Connect opens a connection and handles messages until Slack disconnects.
+// Returns true when Slack said hello, meaning the connection was working.
+func (c *SocketModeClient) Connect() (bool, error) {
+	url, err := c.openConnection()
+	if err != nil {
+		return false, err
+	}
+
+	ws, _, err := c.Dialer.Dial(url, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "could not connect to Slack with Socket Mode")
+	}
+	conn := &socketModeConnection{ws: ws}
+	defer ws.Close()
+
+	var connected bool
+	for {
+		var envelope SocketModeEnvelope
+		err := ws.ReadJSON(&envelope)
+		if err != nil {
+			return connected, errors.Wrap(err, "lost the Socket Mode connection")
+		}
+
+		switch envelope.Type {
+		case SocketModeTypeHello:
+			fmt.Printf("%s connected to Slack with Socket Mode\n", now())
+			connected = true
+		case SocketModeTypeDisconnect:
+			fmt.Printf("%s Slack closed the Socket Mode connection: %s\n", now(), envelope.Reason)
+			return connected, nil
+		default:
+			go c.handle(conn, envelope)
+		}
+	}
+}
+
+// openConnection asks Slack for the URL of a new websocket.
+func (c *SocketModeClient) openConnection() (string, error) {
+	var result struct {
+		URL string `json:"url"`
+	}
+	err := callSlackAPIAt(c.APIURL, c.AppToken, "apps.connections.open", struct{}{}, &result)
+	if err != nil {
+		return "", errors.Wrap(err, "could not open a Socket Mode connection")
+	}
+	return result.URL, nil
+}
+
+func (c *SocketModeClient) handle(conn *socketModeConnection, envelope SocketModeEnvelope) {
+	var response interface{}
+	var err error
+	switch envelope.Type {
+	case SocketModeTypeSlashCommands:
+		response, err = c.handleSlashCommand(envelope)
+	case SocketModeTypeInteractive:
+		response, err = c.handleInteraction(envelope)
+	case SocketModeTypeEventsAPI:
+		var queued bool
+		queued, err = c.handleEvent(envelope)
+		if !queued {
+			// Don't acknowledge the event, so that Slack sends it again later
+			log.Printf("%v\n", err)
+			return
+		}
+	default:
+		fmt.Printf("%s ignoring Socket Mode message %s\n", now(), envelope.Type)
+	}
+	if err != nil {
+		log.Printf("%v\n", err)
+	}
+
+	err = conn.ack(SocketModeAck{EnvelopeId: envelope.EnvelopeId, Payload: response})
+	if err != nil {
+		log.Printf("%v\n", err)
+	}
+}
+
+// handleSlashCommand returns the message to reply with, or nil when there
+// isn't one.
+func (c *SocketModeClient) handleSlashCommand(envelope SocketModeEnvelope) (interface{}, error) {
+	var cmd slack.SlashCommand
+	err := json.Unmarshal(envelope.Payload, &cmd)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal slash command")
+	}
+
+	msg, err := c.Handler.RunSlashCommand(cmd.Command, newSlackPayload(cmd))
+	if err != nil {
+		log.Printf("%v\n", err)
+		msg = errorMessage(err)
+	}
+
+	if isEmptyMessage(msg) {
+		return nil, nil
+	}
+	return msg, nil
+}
+
+// handleInteraction returns the response to a submitted modal, or nil when
+// there isn't one.
+func (c *SocketModeClient) handleInteraction(envelope SocketModeEnvelope) (interface{}, error) {
+	var payload InteractionPayload
+	err := json.Unmarshal(envelope.Payload, &payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal interaction")
+	}
+
+	switch payload.Type {
+	case InteractionTypeViewSubmission:
+		response, err := c.Handler.SubmitView(payload)
+		if err != nil || response == nil {
+			return nil, err
+		}
+		return response, nil
+	case slack.InteractionTypeBlockActions:
+		go c.Handler.HandleBlockAction(payload)
+	}
+	return nil, nil
+}
+
+// handleEvent queues an event to be handled, returning false when it couldn't
+// be queued and should be sent again later.
+func (c *SocketModeClient) handleEvent(envelope SocketModeEnvelope) (bool, error) {
+	var eventEnvelope EventEnvelope
+	err := json.Unmarshal(envelope.Payload, &eventEnvelope)
+	if err != nil {
+		return true, errors.Wrap(err, "could not unmarshal event")
+	}
+
+	if eventEnvelope.Type != EventTypeEventCallback {
+		return true, nil
+	}
+
+	event, err := NewEvent(eventEnvelope)
+	if err != nil {
+		return true, err
+	}
+
+	err = c.Handler.events.Dispatch(event, envelope.RetryAttempt)
+	return err == nil, err
+}
+
+// socketModeConnection serializes writes to the websocket, since messages
+// are handled at the same time.
+type socketModeConnection struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *socketModeConnection) ack(ack SocketModeAck) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.ws.WriteJSON(ack)
+	return errors.Wrapf(err, "could not acknowledge Socket Mode envelope %s", ack.EnvelopeId)
+}
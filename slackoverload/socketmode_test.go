@@ -0,0 +1,132 @@
+package slackoverload
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newFakeSocketMode starts a fake Slack that hands each websocket that the
+// client opens to the test, so that it can play the part of Slack.
+func newFakeSocketMode(t *testing.T, appToken string) (*httptest.Server, <-chan *websocket.Conn) {
+	conns := make(chan *websocket.Conn)
+	done := make(chan struct{})
+
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/apps.connections.open", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+appToken {
+			t.Errorf("expected the app token, got %q", r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"ok":true,"url":"ws` + strings.TrimPrefix(srv.URL, "http") + `/ws"}`))
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		select {
+		case conns <- ws:
+		case <-done:
+			ws.Close()
+		}
+	})
+
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(done) })
+	return srv, conns
+}
+
+func nextSocketModeConnection(t *testing.T, conns <-chan *websocket.Conn) *websocket.Conn {
+	select {
+	case ws := <-conns:
+		return ws
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client did not connect")
+		return nil
+	}
+}
+
+func sendEnvelope(t *testing.T, ws *websocket.Conn, envelope SocketModeEnvelope) {
+	if err := ws.WriteJSON(envelope); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receiveAck(t *testing.T, ws *websocket.Conn) map[string]interface{} {
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var ack map[string]interface{}
+	if err := ws.ReadJSON(&ack); err != nil {
+		t.Fatalf("expected an ack: %v", err)
+	}
+	return ack
+}
+
+func TestSocketModeClient_Run(t *testing.T) {
+	srv, conns := newFakeSocketMode(t, "xapp-test")
+
+	h := &SlackHandler{}
+	h.App.Storage = NewMemoryStorage()
+	h.events = NewEventDispatcher(&h.App, eventHandlers, 1)
+	c := NewSocketModeClient(h, "xapp-test")
+	c.APIURL = srv.URL + "/api/"
+	go c.Run()
+
+	// The first connection drops without Slack saying goodbye
+	ws := nextSocketModeConnection(t, conns)
+	sendEnvelope(t, ws, SocketModeEnvelope{Type: SocketModeTypeHello})
+	sendEnvelope(t, ws, SocketModeEnvelope{
+		Type:       SocketModeTypeSlashCommands,
+		EnvelopeId: "e1",
+		Payload:    []byte(`{"command":"/overload","text":"help","user_id":"U1","team_id":"T1"}`),
+	})
+	ack := receiveAck(t, ws)
+	if ack["envelope_id"] != "e1" {
+		t.Fatalf("expected the slash command to be acked, got %v", ack)
+	}
+	if ack["payload"] == nil {
+		t.Fatal("expected the slash command to be acked with the reply")
+	}
+	ws.Close()
+
+	// The connection was working, so the client reconnects right away
+	ws = nextSocketModeConnection(t, conns)
+	sendEnvelope(t, ws, SocketModeEnvelope{Type: SocketModeTypeHello})
+	sendEnvelope(t, ws, SocketModeEnvelope{
+		Type:       SocketModeTypeEventsAPI,
+		EnvelopeId: "e2",
+		Payload:    []byte(`{"type":"event_callback","event_id":"Ev1","team_id":"T1","event":{"type":"nothing"}}`),
+	})
+	ack = receiveAck(t, ws)
+	if ack["envelope_id"] != "e2" {
+		t.Fatalf("expected the event to be acked, got %v", ack)
+	}
+	sendEnvelope(t, ws, SocketModeEnvelope{Type: "something_new", EnvelopeId: "e3"})
+	ack = receiveAck(t, ws)
+	if ack["envelope_id"] != "e3" {
+		t.Fatalf("expected an unknown envelope to be acked, got %v", ack)
+	}
+
+	// Slack asks the client to reconnect, and the disconnect isn't acked
+	sendEnvelope(t, ws, SocketModeEnvelope{Type: SocketModeTypeDisconnect, Reason: "refresh_requested"})
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, msg, err := ws.ReadMessage()
+	if err == nil {
+		t.Fatalf("expected the client to close the connection, got %s", msg)
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("the client did not close the connection after the disconnect")
+	}
+	ws.Close()
+
+	ws = nextSocketModeConnection(t, conns)
+	ws.Close()
+}
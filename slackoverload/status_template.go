@@ -0,0 +1,167 @@
+package slackoverload
+
+import (
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// StatusTemplateData is what the status text of a trigger can use, since it
+// is a Go text/template, for example "in a meeting {{.Arg 1}} {{.Until}}".
+type StatusTemplateData struct {
+	// Args are the arguments after the trigger name in /trigger.
+	Args []string
+
+	// Workspace is the name of the workspace where the status is set.
+	Workspace string
+
+	// Duration is how long the status lasts, such as 1h30m.
+	Duration string
+
+	// Until is when the status ends in the user's time zone, such as "back at 2:30pm".
+	Until string
+}
+
+// Arg returns an argument from /trigger, starting at 1, or an empty string
+// when it wasn't specified.
+func (d StatusTemplateData) Arg(i int) string {
+	if i < 1 || i > len(d.Args) {
+		return ""
+	}
+	return d.Args[i-1]
+}
+
+// triggerRun describes a single run of a trigger, used to fill in the
+// status text of each of its steps.
+type triggerRun struct {
+	Args     []string
+	Start    time.Time
+	Location *time.Location
+}
+
+// isStatusTemplate determines if the status text uses any template actions.
+func isStatusTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+// takesArgs determines if the status text of any of the steps uses the
+// arguments from /trigger.
+func takesArgs(steps []Action) bool {
+	for _, step := range steps {
+		if isStatusTemplate(step.StatusText) && strings.Contains(step.StatusText, ".Arg") {
+			return true
+		}
+		for _, override := range step.Workspaces {
+			if override.StatusText != nil && isStatusTemplate(*override.StatusText) && strings.Contains(*override.StatusText, ".Arg") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// needsLocation determines if any of the steps depend on the user's time
+// zone, either to resolve an end time or to fill in a status text template.
+func needsLocation(steps []Action) bool {
+	for _, step := range steps {
+		if step.Until != "" || isStatusTemplate(step.StatusText) {
+			return true
+		}
+		for _, override := range step.Workspaces {
+			if override.StatusText != nil && isStatusTemplate(*override.StatusText) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// templateErrorPrefix is the start of template errors that only matters to developers.
+var templateErrorPrefix = regexp.MustCompile(`^template: status:[\d:]* (executing "status" at )?`)
+
+// parseStatusTemplate checks that the status text is a valid template, by
+// parsing it and filling it in with example values.
+func parseStatusTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("status").Parse(text)
+	if err != nil {
+		return nil, errors.New(templateErrorPrefix.ReplaceAllString(err.Error(), ""))
+	}
+
+	example := StatusTemplateData{
+		Args:      []string{"example"},
+		Workspace: "example",
+		Duration:  "1h",
+		Until:     "back at 2:30pm",
+	}
+	err = tmpl.Execute(&strings.Builder{}, example)
+	if err != nil {
+		return nil, errors.New(templateErrorPrefix.ReplaceAllString(err.Error(), ""))
+	}
+	return tmpl, nil
+}
+
+// renderStatusText fills in the status text template for a workspace. Text
+// that isn't a template is returned as is.
+func (r triggerRun) renderStatusText(action Action, workspace string) (string, error) {
+	if !isStatusTemplate(action.StatusText) {
+		return action.StatusText, nil
+	}
+
+	tmpl, err := parseStatusTemplate(action.StatusText)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid status text template %q", action.StatusText)
+	}
+
+	data := StatusTemplateData{
+		Args:      r.Args,
+		Workspace: workspace,
+		Duration:  action.Duration,
+	}
+	if d, _ := action.ParseDuration(); d > 0 {
+		data.Until = formatBackAt(r.Start.Add(d), r.Start, r.location())
+	}
+
+	var b strings.Builder
+	err = tmpl.Execute(&b, data)
+	if err != nil {
+		return "", errors.Wrapf(err, "error rendering status text %q", action.StatusText)
+	}
+
+	// Collapse the spaces left behind by arguments that weren't specified
+	text := strings.Join(strings.Fields(b.String()), " ")
+	if utf8.RuneCountInString(text) > maxStatusTextLength {
+		text = string([]rune(text)[:maxStatusTextLength])
+	}
+	return text, nil
+}
+
+func (r triggerRun) location() *time.Location {
+	if r.Location == nil {
+		return time.Local
+	}
+	return r.Location
+}
+
+// formatBackAt describes when a status ends, relative to when it started,
+// such as "back at 2:30pm", "back tomorrow at 9am" or "back Mon Jan 2 at 9am".
+func formatBackAt(end time.Time, start time.Time, loc *time.Location) string {
+	end, start = end.In(loc), start.In(loc)
+	clock := end.Format("3:04pm")
+
+	startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+	endDay := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, loc)
+	switch days := int(endDay.Sub(startDay).Hours()/24 + 0.5); {
+	case days == 0:
+		return "back at " + clock
+	case days == 1:
+		return "back tomorrow at " + clock
+	case days < 7:
+		return "back " + end.Format("Monday") + " at " + clock
+	default:
+		return "back " + end.Format("Mon Jan 2") + " at " + clock
+	}
+}
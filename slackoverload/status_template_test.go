@@ -0,0 +1,47 @@
+package slackoverload
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNeedsLocation(t *testing.T) {
+	template := "in a meeting {{.Until}}"
+	plain := "in a meeting"
+	testcases := []struct {
+		name  string
+		steps []Action
+		want  bool
+	}{
+		{"plain", []Action{{StatusText: plain, Duration: "1h"}}, false},
+		{"until", []Action{{StatusText: plain, Until: "5pm"}}, true},
+		{"template", []Action{{StatusText: template, Duration: "1h"}}, true},
+		{"later step", []Action{{StatusText: plain, Duration: "1h"}, {StatusText: plain, Until: "tomorrow"}}, true},
+		{"workspace template", []Action{{StatusText: plain, Workspaces: map[string]WorkspaceOverride{"T2": {StatusText: &template}}}}, true},
+		{"workspace text", []Action{{StatusText: plain, Workspaces: map[string]WorkspaceOverride{"T2": {StatusText: &plain}}}}, false},
+	}
+
+	for _, tc := range testcases {
+		if got := needsLocation(tc.steps); got != tc.want {
+			t.Errorf("%s: expected %t, got %t", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestApp_LookupTimeZone_Cached(t *testing.T) {
+	loc, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// There isn't a Slack token, so only the cache can return the time zone
+	a := &App{Storage: NewMemoryStorage(), Secrets: ChainedSecrets{}, timeZones: newLRUCache(timeZoneCacheTTL, timeZoneCacheSize)}
+	a.timeZones.set("U1", loc)
+
+	if got := a.lookupTimeZone("U1"); got != loc {
+		t.Fatalf("expected the cached time zone, got %s", got)
+	}
+	if got := a.lookupTimeZone("U2"); got != time.Local {
+		t.Fatalf("expected the server time zone without a cached one, got %s", got)
+	}
+}
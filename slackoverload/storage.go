@@ -1,133 +1,152 @@
 package slackoverload
 
 import (
-	"bytes"
-	"context"
 	"fmt"
-	"net/url"
+	"math/rand"
 	"time"
 
-	"github.com/Azure/azure-pipeline-go/pipeline"
-	"github.com/Azure/azure-storage-blob-go/azblob"
-	"github.com/Azure/go-autorest/autorest/adal"
 	"github.com/pkg/errors"
 )
 
-type Storage struct {
-	Account    string
-	credential azblob.Credential
-	pipeline   pipeline.Pipeline
-}
+const (
+	StorageAzure      = "azure"
+	StorageFilesystem = "filesystem"
+	StorageMemory     = "memory"
+)
 
-func NewStorageClient() (Storage, error) {
-	s := Storage{Account: "slackoverload"}
+// Storage persists user configuration as named blobs grouped into containers.
+type Storage interface {
+	// ListContainer returns the names of all blobs in the container that start with prefix.
+	ListContainer(containerName string, prefix string) ([]string, error)
 
-	msiEndpoint, _ := adal.GetMSIEndpoint()
-	spToken, err := adal.NewServicePrincipalTokenFromMSI(msiEndpoint, s.URL())
-	if err != nil {
-		return s, errors.Wrap(err, "failed to create oauth token from MSI")
-	}
+	// GetBlob returns the contents of a blob, or a BlobNotFoundError when it doesn't exist.
+	GetBlob(containerName string, blobName string) ([]byte, error)
 
-	refreshToken := func(credential azblob.TokenCredential) time.Duration {
-		err := spToken.EnsureFresh()
-		if err != nil {
-			fmt.Println("Failed to refresh token")
-			// Token shouldn't be used
-			return time.Duration(0)
-		}
+	// SetBlob creates or overwrites a blob.
+	SetBlob(containerName string, blobName string, data []byte) error
 
-		fmt.Println("Token: ", spToken.OAuthToken()[0:5], "...")
-		tz, _ := time.LoadLocation("America/Chicago")
-		fmt.Println("Expires: ", spToken.Token().Expires().In(tz))
+	// DeleteBlob removes a blob, or returns a BlobNotFoundError when it doesn't exist.
+	DeleteBlob(containerName string, blobName string) error
 
-		credential.SetToken(spToken.OAuthToken())
-		tokenDuration := spToken.Token().Expires().Sub(time.Now().UTC())
-		return tokenDuration
-	}
-	s.credential = azblob.NewTokenCredential(spToken.OAuthToken(), refreshToken)
-	s.pipeline = azblob.NewPipeline(s.credential, azblob.PipelineOptions{})
+	// GetBlobVersion returns the contents of a blob along with its current ETag,
+	// or a BlobNotFoundError when it doesn't exist.
+	GetBlobVersion(containerName string, blobName string) ([]byte, ETag, error)
 
-	return s, nil
-}
+	// SetBlobIfMatch saves a blob only when its current ETag matches etag.
+	// Use ETagNone to only create the blob when it doesn't exist yet.
+	// Returns a ConflictError when the blob was changed by someone else.
+	SetBlobIfMatch(containerName string, blobName string, data []byte, etag ETag) error
 
-func (s *Storage) URL() string {
-	return fmt.Sprintf("https://%s.blob.core.windows.net", s.Account)
+	// DeleteBlobIfMatch removes a blob only when its current ETag matches etag.
+	// Returns a ConflictError when the blob was changed by someone else, or a
+	// BlobNotFoundError when it doesn't exist.
+	DeleteBlobIfMatch(containerName string, blobName string, etag ETag) error
 }
 
-func (s *Storage) ListContainer(containerName string, prefix string) ([]string, error) {
-	container, err := s.buildContainerURL(containerName)
-	if err != nil {
-		return nil, err
+// ETag identifies a specific version of a blob.
+type ETag string
+
+// ETagNone is the ETag of a blob that doesn't exist.
+const ETagNone ETag = ""
+
+// NewStorage creates the storage backend with the specified name.
+// The directory is only used by the filesystem backend.
+func NewStorage(backend string, dir string) (Storage, error) {
+	switch backend {
+	case StorageAzure, "":
+		return NewStorageClient()
+	case StorageFilesystem:
+		return NewFilesystemStorage(dir)
+	case StorageMemory:
+		return NewMemoryStorage(), nil
+	default:
+		return nil, errors.Errorf("unsupported storage backend %q, must be one of: %s, %s, %s",
+			backend, StorageAzure, StorageFilesystem, StorageMemory)
 	}
+}
 
-	var names []string
-	for marker := (azblob.Marker{}); marker.NotDone(); {
-		response, err := container.ListBlobsFlatSegment(context.Background(), marker, azblob.ListBlobsSegmentOptions{
-			Prefix: prefix,
-		})
+// maxConflictRetries is the number of times that a read-modify-write is
+// attempted before giving up because other requests keep changing the blob.
+const maxConflictRetries = 5
+
+// updateBlob performs a read-modify-write of a blob, using a conditional write
+// and retrying when the blob is changed by another request in the meantime.
+// The update function is passed nil when the blob does not exist yet, and may
+// be called multiple times so it should not have side effects.
+func updateBlob(store Storage, containerName string, blobName string, update func(data []byte) ([]byte, error)) error {
+	for attempt := 1; ; attempt++ {
+		data, etag, err := store.GetBlobVersion(containerName, blobName)
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+
+		updated, err := update(data)
 		if err != nil {
-			return nil, errors.Wrapf(err, "error listing container %s with prefix %s", containerName, prefix)
+			return err
 		}
 
-		marker = response.NextMarker
-		for _, blobInfo := range response.Segment.BlobItems {
-			names = append(names, blobInfo.Name)
+		err = store.SetBlobIfMatch(containerName, blobName, updated, etag)
+		if !IsConflict(err) {
+			return err
 		}
-	}
 
-	return names, nil
-}
+		if attempt >= maxConflictRetries {
+			return errors.Wrapf(err, "gave up saving %s/%s after %d attempts", containerName, blobName, attempt)
+		}
 
-func (s *Storage) GetBlob(containerName string, blobName string) ([]byte, error) {
-	containerURL, err := s.buildContainerURL(containerName)
-	if err != nil {
-		return nil, err
+		// Back off with jitter so that competing requests don't collide again
+		backoff := time.Duration(attempt*10+rand.Intn(20)) * time.Millisecond
+		time.Sleep(backoff)
 	}
+}
 
-	blobURL := containerURL.NewBlobURL(blobName)
-
-	resp, err := blobURL.Download(context.Background(), 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error initiating download of blob at %s", blobURL.String())
-	}
+// BlobNotFoundError is returned when the requested blob does not exist.
+type BlobNotFoundError struct {
+	Container string
+	Blob      string
+}
 
-	bodyStream := resp.Body(azblob.RetryReaderOptions{MaxRetryRequests: 20})
-	buff := bytes.Buffer{}
-	_, err = buff.ReadFrom(bodyStream)
+func (e BlobNotFoundError) Error() string {
+	return fmt.Sprintf("blob %s/%s not found", e.Container, e.Blob)
+}
 
-	return buff.Bytes(), errors.Wrapf(err, "error reading blob body at %s", blobURL.String())
+func (e BlobNotFoundError) NotFound() bool {
+	return true
 }
 
-func (s *Storage) SetBlob(containerName string, blobName string, data []byte) error {
-	container, err := s.buildContainerURL(containerName)
-	if err != nil {
-		return err
+// IsNotFound determines if an error, or the error that it wraps, indicates
+// that the requested item does not exist.
+func IsNotFound(err error) bool {
+	if err == nil {
+		return false
 	}
 
-	blob := container.NewBlockBlobURL(blobName)
-	opts := azblob.UploadToBlockBlobOptions{BlockSize: 64 * 1024}
+	nf, ok := errors.Cause(err).(interface{ NotFound() bool })
+	return ok && nf.NotFound()
+}
 
-	_, err = azblob.UploadBufferToBlockBlob(context.Background(), data, blob, opts)
-	return errors.Wrapf(err, "error saving %s/%s", containerName, blobName)
+// ConflictError is returned when a conditional write fails because the blob
+// was changed since it was read.
+type ConflictError struct {
+	Container string
+	Blob      string
 }
 
-func (s *Storage) DeleteBlob(containerName string, blobName string) error {
-	container, err := s.buildContainerURL(containerName)
-	if err != nil {
-		return err
-	}
+func (e ConflictError) Error() string {
+	return fmt.Sprintf("blob %s/%s was modified by another request", e.Container, e.Blob)
+}
 
-	blob := container.NewBlockBlobURL(blobName)
-	_, err = blob.Delete(context.Background(), azblob.DeleteSnapshotsOptionNone, azblob.BlobAccessConditions{})
-	return errors.Wrapf(err, "error deleting blob %s/%s", containerName, blobName)
+func (e ConflictError) Conflict() bool {
+	return true
 }
 
-func (s *Storage) buildContainerURL(containerName string) (azblob.ContainerURL, error) {
-	rawURL := fmt.Sprintf("%s/%s", s.URL(), containerName)
-	URL, err := url.Parse(rawURL)
-	if err != nil {
-		return azblob.ContainerURL{}, errors.Wrapf(err, "could not parse container URL %s", rawURL)
+// IsConflict determines if an error, or the error that it wraps, was caused
+// by a conditional write that lost a race with another write.
+func IsConflict(err error) bool {
+	if err == nil {
+		return false
 	}
 
-	return azblob.NewContainerURL(*URL, s.pipeline), nil
+	c, ok := errors.Cause(err).(interface{ Conflict() bool })
+	return ok && c.Conflict()
 }
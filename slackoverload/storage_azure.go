@@ -0,0 +1,189 @@
+package slackoverload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/pkg/errors"
+)
+
+// AzureStorage stores blobs in an Azure Storage account.
+type AzureStorage struct {
+	Account    string
+	credential azblob.Credential
+	pipeline   pipeline.Pipeline
+}
+
+func NewStorageClient() (*AzureStorage, error) {
+	s := &AzureStorage{Account: "slackoverload"}
+
+	msiEndpoint, _ := adal.GetMSIEndpoint()
+	spToken, err := adal.NewServicePrincipalTokenFromMSI(msiEndpoint, s.URL())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create oauth token from MSI")
+	}
+
+	refreshToken := func(credential azblob.TokenCredential) time.Duration {
+		err := spToken.EnsureFresh()
+		if err != nil {
+			fmt.Println("Failed to refresh token")
+			// Token shouldn't be used
+			return time.Duration(0)
+		}
+
+		fmt.Println("Token: ", spToken.OAuthToken()[0:5], "...")
+		fmt.Println("Expires: ", spToken.Token().Expires().UTC())
+
+		credential.SetToken(spToken.OAuthToken())
+		tokenDuration := spToken.Token().Expires().Sub(time.Now().UTC())
+		return tokenDuration
+	}
+	s.credential = azblob.NewTokenCredential(spToken.OAuthToken(), refreshToken)
+	s.pipeline = azblob.NewPipeline(s.credential, azblob.PipelineOptions{})
+
+	return s, nil
+}
+
+func (s *AzureStorage) URL() string {
+	return fmt.Sprintf("https://%s.blob.core.windows.net", s.Account)
+}
+
+func (s *AzureStorage) ListContainer(containerName string, prefix string) ([]string, error) {
+	container, err := s.buildContainerURL(containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		response, err := container.ListBlobsFlatSegment(context.Background(), marker, azblob.ListBlobsSegmentOptions{
+			Prefix: prefix,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "error listing container %s with prefix %s", containerName, prefix)
+		}
+
+		marker = response.NextMarker
+		for _, blobInfo := range response.Segment.BlobItems {
+			names = append(names, blobInfo.Name)
+		}
+	}
+
+	return names, nil
+}
+
+func (s *AzureStorage) GetBlob(containerName string, blobName string) ([]byte, error) {
+	data, _, err := s.GetBlobVersion(containerName, blobName)
+	return data, err
+}
+
+func (s *AzureStorage) GetBlobVersion(containerName string, blobName string) ([]byte, ETag, error) {
+	containerURL, err := s.buildContainerURL(containerName)
+	if err != nil {
+		return nil, ETagNone, err
+	}
+
+	blobURL := containerURL.NewBlobURL(blobName)
+
+	resp, err := blobURL.Download(context.Background(), 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
+	if err != nil {
+		if isBlobNotFound(err) {
+			return nil, ETagNone, BlobNotFoundError{Container: containerName, Blob: blobName}
+		}
+		return nil, ETagNone, errors.Wrapf(err, "error initiating download of blob at %s", blobURL.String())
+	}
+
+	bodyStream := resp.Body(azblob.RetryReaderOptions{MaxRetryRequests: 20})
+	buff := bytes.Buffer{}
+	_, err = buff.ReadFrom(bodyStream)
+
+	return buff.Bytes(), ETag(resp.ETag()), errors.Wrapf(err, "error reading blob body at %s", blobURL.String())
+}
+
+func (s *AzureStorage) SetBlob(containerName string, blobName string, data []byte) error {
+	return s.uploadBlob(containerName, blobName, data, azblob.BlobAccessConditions{})
+}
+
+func (s *AzureStorage) SetBlobIfMatch(containerName string, blobName string, data []byte, etag ETag) error {
+	var conditions azblob.BlobAccessConditions
+	if etag == ETagNone {
+		conditions.IfNoneMatch = azblob.ETagAny
+	} else {
+		conditions.IfMatch = azblob.ETag(etag)
+	}
+
+	err := s.uploadBlob(containerName, blobName, data, conditions)
+	if serr, ok := errors.Cause(err).(azblob.StorageError); ok {
+		switch serr.ServiceCode() {
+		case azblob.ServiceCodeConditionNotMet, azblob.ServiceCodeBlobAlreadyExists:
+			return ConflictError{Container: containerName, Blob: blobName}
+		}
+	}
+	return err
+}
+
+func (s *AzureStorage) uploadBlob(containerName string, blobName string, data []byte, conditions azblob.BlobAccessConditions) error {
+	container, err := s.buildContainerURL(containerName)
+	if err != nil {
+		return err
+	}
+
+	blob := container.NewBlockBlobURL(blobName)
+	opts := azblob.UploadToBlockBlobOptions{
+		BlockSize:        64 * 1024,
+		AccessConditions: conditions,
+	}
+
+	_, err = azblob.UploadBufferToBlockBlob(context.Background(), data, blob, opts)
+	return errors.Wrapf(err, "error saving %s/%s", containerName, blobName)
+}
+
+func (s *AzureStorage) DeleteBlob(containerName string, blobName string) error {
+	return s.deleteBlob(containerName, blobName, azblob.BlobAccessConditions{})
+}
+
+func (s *AzureStorage) DeleteBlobIfMatch(containerName string, blobName string, etag ETag) error {
+	var conditions azblob.BlobAccessConditions
+	conditions.IfMatch = azblob.ETag(etag)
+
+	err := s.deleteBlob(containerName, blobName, conditions)
+	if serr, ok := errors.Cause(err).(azblob.StorageError); ok && serr.ServiceCode() == azblob.ServiceCodeConditionNotMet {
+		return ConflictError{Container: containerName, Blob: blobName}
+	}
+	return err
+}
+
+func (s *AzureStorage) deleteBlob(containerName string, blobName string, conditions azblob.BlobAccessConditions) error {
+	container, err := s.buildContainerURL(containerName)
+	if err != nil {
+		return err
+	}
+
+	blob := container.NewBlockBlobURL(blobName)
+	_, err = blob.Delete(context.Background(), azblob.DeleteSnapshotsOptionNone, conditions)
+	if isBlobNotFound(err) {
+		return BlobNotFoundError{Container: containerName, Blob: blobName}
+	}
+	return errors.Wrapf(err, "error deleting blob %s/%s", containerName, blobName)
+}
+
+func (s *AzureStorage) buildContainerURL(containerName string) (azblob.ContainerURL, error) {
+	rawURL := fmt.Sprintf("%s/%s", s.URL(), containerName)
+	URL, err := url.Parse(rawURL)
+	if err != nil {
+		return azblob.ContainerURL{}, errors.Wrapf(err, "could not parse container URL %s", rawURL)
+	}
+
+	return azblob.NewContainerURL(*URL, s.pipeline), nil
+}
+
+func isBlobNotFound(err error) bool {
+	serr, ok := err.(azblob.StorageError)
+	return ok && serr.ServiceCode() == azblob.ServiceCodeBlobNotFound
+}
@@ -0,0 +1,212 @@
+package slackoverload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const tmpFilePrefix = ".tmp-"
+
+// FilesystemStorage stores each blob as a file at DIR/CONTAINER/BLOB.
+// The ETag of a blob is the hash of its contents, and conditional writes are
+// only safe when a single process is using the directory.
+type FilesystemStorage struct {
+	Dir string
+
+	// mu serializes writes so that conditional writes can check the current ETag
+	mu sync.Mutex
+}
+
+func NewFilesystemStorage(dir string) (*FilesystemStorage, error) {
+	if dir == "" {
+		return nil, errors.New("a directory is required for the filesystem storage backend")
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating storage directory %s", dir)
+	}
+
+	return &FilesystemStorage{Dir: dir}, nil
+}
+
+func (s *FilesystemStorage) ListContainer(containerName string, prefix string) ([]string, error) {
+	containerDir, err := s.buildPath(containerName, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	err = filepath.Walk(containerDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), tmpFilePrefix) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(containerDir, filePath)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(relPath)
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing container %s with prefix %s", containerName, prefix)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (s *FilesystemStorage) GetBlob(containerName string, blobName string) ([]byte, error) {
+	data, _, err := s.GetBlobVersion(containerName, blobName)
+	return data, err
+}
+
+func (s *FilesystemStorage) GetBlobVersion(containerName string, blobName string) ([]byte, ETag, error) {
+	blobPath, err := s.buildPath(containerName, blobName)
+	if err != nil {
+		return nil, ETagNone, err
+	}
+
+	data, err := ioutil.ReadFile(blobPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ETagNone, BlobNotFoundError{Container: containerName, Blob: blobName}
+		}
+		return nil, ETagNone, errors.Wrapf(err, "error reading blob %s", blobPath)
+	}
+
+	return data, hashETag(data), nil
+}
+
+func (s *FilesystemStorage) SetBlob(containerName string, blobName string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.writeBlob(containerName, blobName, data)
+}
+
+func (s *FilesystemStorage) SetBlobIfMatch(containerName string, blobName string, data []byte, etag ETag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, current, err := s.GetBlobVersion(containerName, blobName)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	if current != etag {
+		return ConflictError{Container: containerName, Blob: blobName}
+	}
+
+	return s.writeBlob(containerName, blobName, data)
+}
+
+func (s *FilesystemStorage) writeBlob(containerName string, blobName string, data []byte) error {
+	blobPath, err := s.buildPath(containerName, blobName)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(blobPath), 0700)
+	if err != nil {
+		return errors.Wrapf(err, "error creating directory for blob %s", blobPath)
+	}
+
+	// Write to a temporary file first so that readers never see a partial blob
+	tmpFile, err := ioutil.TempFile(filepath.Dir(blobPath), tmpFilePrefix)
+	if err != nil {
+		return errors.Wrapf(err, "error saving %s/%s", containerName, blobName)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Close()
+	} else {
+		tmpFile.Close()
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error saving %s/%s", containerName, blobName)
+	}
+
+	err = os.Rename(tmpFile.Name(), blobPath)
+	return errors.Wrapf(err, "error saving %s/%s", containerName, blobName)
+}
+
+func (s *FilesystemStorage) DeleteBlob(containerName string, blobName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteBlob(containerName, blobName)
+}
+
+func (s *FilesystemStorage) DeleteBlobIfMatch(containerName string, blobName string, etag ETag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, current, err := s.GetBlobVersion(containerName, blobName)
+	if err != nil {
+		return err
+	}
+	if current != etag {
+		return ConflictError{Container: containerName, Blob: blobName}
+	}
+
+	return s.deleteBlob(containerName, blobName)
+}
+
+func (s *FilesystemStorage) deleteBlob(containerName string, blobName string) error {
+	blobPath, err := s.buildPath(containerName, blobName)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(blobPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return BlobNotFoundError{Container: containerName, Blob: blobName}
+		}
+		return errors.Wrapf(err, "error deleting blob %s/%s", containerName, blobName)
+	}
+
+	return nil
+}
+
+func hashETag(data []byte) ETag {
+	sum := sha256.Sum256(data)
+	return ETag(hex.EncodeToString(sum[:]))
+}
+
+// buildPath converts a container and blob name into a file path, rejecting
+// names that would escape the storage directory.
+func (s *FilesystemStorage) buildPath(containerName string, blobName string) (string, error) {
+	if containerName == "" || containerName == "." || containerName == ".." || strings.Contains(containerName, "/") {
+		return "", errors.Errorf("invalid container name %q", containerName)
+	}
+
+	name := path.Join(containerName, blobName)
+	if blobName != "" && !strings.HasPrefix(name, containerName+"/") {
+		return "", errors.Errorf("invalid blob name %s/%s", containerName, blobName)
+	}
+
+	return filepath.Join(s.Dir, filepath.FromSlash(name)), nil
+}
@@ -0,0 +1,126 @@
+package slackoverload
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MemoryStorage keeps blobs in memory, it is intended for local development
+// and tests since nothing is persisted between runs.
+type MemoryStorage struct {
+	mu         sync.RWMutex
+	containers map[string]map[string]memoryBlob
+	version    int64
+}
+
+type memoryBlob struct {
+	data []byte
+	etag ETag
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{containers: make(map[string]map[string]memoryBlob)}
+}
+
+func (s *MemoryStorage) ListContainer(containerName string, prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var names []string
+	for name := range s.containers[containerName] {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (s *MemoryStorage) GetBlob(containerName string, blobName string) ([]byte, error) {
+	data, _, err := s.GetBlobVersion(containerName, blobName)
+	return data, err
+}
+
+func (s *MemoryStorage) GetBlobVersion(containerName string, blobName string) ([]byte, ETag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	blob, ok := s.containers[containerName][blobName]
+	if !ok {
+		return nil, ETagNone, BlobNotFoundError{Container: containerName, Blob: blobName}
+	}
+
+	return copyBytes(blob.data), blob.etag, nil
+}
+
+func (s *MemoryStorage) SetBlob(containerName string, blobName string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setBlob(containerName, blobName, data)
+	return nil
+}
+
+func (s *MemoryStorage) SetBlobIfMatch(containerName string, blobName string, data []byte, etag ETag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.containers[containerName][blobName]
+	if (etag == ETagNone && ok) || (etag != ETagNone && (!ok || current.etag != etag)) {
+		return ConflictError{Container: containerName, Blob: blobName}
+	}
+
+	s.setBlob(containerName, blobName, data)
+	return nil
+}
+
+func (s *MemoryStorage) setBlob(containerName string, blobName string, data []byte) {
+	container, ok := s.containers[containerName]
+	if !ok {
+		container = make(map[string]memoryBlob)
+		s.containers[containerName] = container
+	}
+
+	s.version++
+	container[blobName] = memoryBlob{
+		data: copyBytes(data),
+		etag: ETag(strconv.FormatInt(s.version, 10)),
+	}
+}
+
+func (s *MemoryStorage) DeleteBlob(containerName string, blobName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.containers[containerName][blobName]; !ok {
+		return BlobNotFoundError{Container: containerName, Blob: blobName}
+	}
+	delete(s.containers[containerName], blobName)
+
+	return nil
+}
+
+func (s *MemoryStorage) DeleteBlobIfMatch(containerName string, blobName string, etag ETag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.containers[containerName][blobName]
+	if !ok {
+		return BlobNotFoundError{Container: containerName, Blob: blobName}
+	}
+	if current.etag != etag {
+		return ConflictError{Container: containerName, Blob: blobName}
+	}
+	delete(s.containers[containerName], blobName)
+
+	return nil
+}
+
+func copyBytes(data []byte) []byte {
+	result := make([]byte, len(data))
+	copy(result, data)
+	return result
+}
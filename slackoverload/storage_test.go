@@ -0,0 +1,236 @@
+package slackoverload
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// azureTestEnvVar enables the storage tests against the slackoverload storage
+// account, which requires a managed identity with access to it.
+const azureTestEnvVar = "SLACKOVERLOAD_TEST_AZURE"
+
+func TestStorage(t *testing.T) {
+	testcases := map[string]func(t *testing.T) Storage{
+		StorageMemory: func(t *testing.T) Storage {
+			return NewMemoryStorage()
+		},
+		StorageFilesystem: func(t *testing.T) Storage {
+			s, err := NewFilesystemStorage(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+		"cached": func(t *testing.T) Storage {
+			return NewCachedStorage(NewMemoryStorage(), time.Minute, 100)
+		},
+		StorageAzure: func(t *testing.T) Storage {
+			if os.Getenv(azureTestEnvVar) == "" {
+				t.Skipf("set %s to test against azure storage", azureTestEnvVar)
+			}
+			s, err := NewStorageClient()
+			if err != nil {
+				t.Skipf("no azure credentials: %s", err)
+			}
+			return s
+		},
+	}
+
+	for backend, newStorage := range testcases {
+		t.Run(backend, func(t *testing.T) {
+			s := newStorage(t)
+
+			// Use a unique prefix so that the tests can run against shared storage
+			prefix := fmt.Sprintf("test-%d/", time.Now().UnixNano())
+			t.Cleanup(func() {
+				names, _ := s.ListContainer("triggers", prefix)
+				for _, name := range names {
+					s.DeleteBlob("triggers", name)
+				}
+			})
+
+			t.Run("crud", func(t *testing.T) { testStorageCRUD(t, s, prefix) })
+			t.Run("not found", func(t *testing.T) { testStorageNotFound(t, s, prefix) })
+			t.Run("conditional write", func(t *testing.T) { testStorageIfMatch(t, s, prefix) })
+		})
+	}
+}
+
+func testStorageCRUD(t *testing.T, s Storage, prefix string) {
+	names, err := s.ListContainer("triggers", prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Fatalf("expected an empty container, got %v", names)
+	}
+
+	for _, name := range []string{"u1/lunch", "u1/afk", "u2/lunch"} {
+		if err := s.SetBlob("triggers", prefix+name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err = s.ListContainer("triggers", prefix+"u1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{prefix + "u1/afk", prefix + "u1/lunch"}
+	if !reflect.DeepEqual(want, names) {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+
+	if err := s.SetBlob("triggers", prefix+"u1/lunch", []byte("updated")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := s.GetBlob("triggers", prefix+"u1/lunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "updated" {
+		t.Fatalf("expected the updated blob, got %q", data)
+	}
+
+	if err := s.DeleteBlob("triggers", prefix+"u2/lunch"); err != nil {
+		t.Fatal(err)
+	}
+	names, err = s.ListContainer("triggers", prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected the deleted blob to be gone, got %v", names)
+	}
+}
+
+func testStorageNotFound(t *testing.T, s Storage, prefix string) {
+	blob := prefix + "missing"
+
+	_, err := s.GetBlob("triggers", blob)
+	if !IsNotFound(err) {
+		t.Fatalf("GetBlob: expected a not found error, got %v", err)
+	}
+
+	_, etag, err := s.GetBlobVersion("triggers", blob)
+	if !IsNotFound(err) {
+		t.Fatalf("GetBlobVersion: expected a not found error, got %v", err)
+	}
+	if etag != ETagNone {
+		t.Fatalf("GetBlobVersion: expected no etag, got %q", etag)
+	}
+
+	err = s.DeleteBlob("triggers", blob)
+	if !IsNotFound(err) {
+		t.Fatalf("DeleteBlob: expected a not found error, got %v", err)
+	}
+}
+
+func testStorageIfMatch(t *testing.T, s Storage, prefix string) {
+	blob := prefix + "versioned"
+
+	err := s.SetBlobIfMatch("triggers", blob, []byte("v1"), ETagNone)
+	if err != nil {
+		t.Fatalf("expected to create the blob, got %v", err)
+	}
+
+	err = s.SetBlobIfMatch("triggers", blob, []byte("v1 again"), ETagNone)
+	if !IsConflict(err) {
+		t.Fatalf("expected a conflict creating a blob that exists, got %v", err)
+	}
+
+	data, stale, err := s.GetBlobVersion("triggers", blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "v1" {
+		t.Fatalf("expected v1, got %q", data)
+	}
+
+	err = s.SetBlobIfMatch("triggers", blob, []byte("v2"), stale)
+	if err != nil {
+		t.Fatalf("expected to update the blob with its current etag, got %v", err)
+	}
+
+	err = s.SetBlobIfMatch("triggers", blob, []byte("v3"), stale)
+	if !IsConflict(err) {
+		t.Fatalf("expected a conflict with a stale etag, got %v", err)
+	}
+	if _, ok := err.(ConflictError); !ok {
+		t.Fatalf("expected a ConflictError, got %T", err)
+	}
+
+	data, err = s.GetBlob("triggers", blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "v2" {
+		t.Fatalf("expected the conflicting write to be rejected, got %q", data)
+	}
+
+	err = s.SetBlobIfMatch("triggers", prefix+"missing", []byte("v1"), stale)
+	if !IsConflict(err) {
+		t.Fatalf("expected a conflict updating a blob that doesn't exist, got %v", err)
+	}
+
+	err = s.DeleteBlobIfMatch("triggers", blob, stale)
+	if !IsConflict(err) {
+		t.Fatalf("expected a conflict deleting with a stale etag, got %v", err)
+	}
+
+	_, current, err := s.GetBlobVersion("triggers", blob)
+	if err != nil {
+		t.Fatalf("expected the conflicting delete to be rejected, got %v", err)
+	}
+	err = s.DeleteBlobIfMatch("triggers", blob, current)
+	if err != nil {
+		t.Fatalf("expected to delete the blob with its current etag, got %v", err)
+	}
+	_, err = s.GetBlob("triggers", blob)
+	if !IsNotFound(err) {
+		t.Fatalf("expected the blob to be deleted, got %v", err)
+	}
+
+	err = s.DeleteBlobIfMatch("triggers", blob, current)
+	if !IsNotFound(err) {
+		t.Fatalf("expected a not found error deleting a blob that doesn't exist, got %v", err)
+	}
+}
+
+func TestFilesystemStorage_BuildPath(t *testing.T) {
+	s, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		container string
+		blob      string
+		valid     bool
+	}{
+		{"triggers", "u1/lunch", true},
+		{"triggers", "u1/../u2/lunch", true},
+		{"triggers", "../users/u1", false},
+		{"triggers", "u1/../../users/u1", false},
+		{"triggers", "../../../etc/passwd", false},
+		{"..", "etc/passwd", false},
+		{"triggers/..", "users", false},
+		{"", "u1", false},
+	}
+	for _, tc := range testcases {
+		_, err := s.buildPath(tc.container, tc.blob)
+		if tc.valid && err != nil {
+			t.Errorf("buildPath(%q, %q): unexpected error %v", tc.container, tc.blob, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("buildPath(%q, %q): expected the path to be rejected", tc.container, tc.blob)
+		}
+	}
+
+	_, err = s.GetBlob("triggers", "../users/u1")
+	if err == nil || IsNotFound(err) {
+		t.Fatalf("expected GetBlob to reject the path, got %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package slackoverload
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The default work day is used to resolve "tomorrow" and "end of day" when
+// the user hasn't set their working hours.
+const (
+	defaultWorkdayStartHour = 9
+	defaultWorkdayEndHour   = 17
+)
+
+// maxEndTimeWords is the most words in an end time, such as "end of day".
+const maxEndTimeWords = 3
+
+const endTimeExamples = "here are some examples: 5pm, tomorrow, Monday 9am, end of day"
+
+var durationPartPattern = regexp.MustCompile(`(\d+)([wdhms])`)
+
+// maxDuration is the longest duration that can be represented.
+const maxDuration = time.Duration(1<<63 - 1)
+
+var weekdayNames = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// parseCompoundDuration converts a duration made of one or more units, such as
+// 1d12h or 1h30m, where w=week, d=day, h=hour, m=minute and s=second.
+// Anything else that time.ParseDuration understands is accepted too.
+// An empty value means there isn't a duration, otherwise it must be positive.
+func parseCompoundDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return time.Duration(0), nil
+	}
+
+	parts := durationPartPattern.FindAllStringSubmatch(value, -1)
+	var matched string
+	var d time.Duration
+	for _, part := range parts {
+		matched += part[0]
+
+		num, err := strconv.ParseInt(part[1], 10, 64)
+		if err != nil {
+			return time.Duration(0), errors.Errorf("invalid duration %q, it is too long", value)
+		}
+
+		var unit time.Duration
+		switch part[2] {
+		case "w":
+			unit = week
+		case "d":
+			unit = day
+		case "h":
+			unit = time.Hour
+		case "m":
+			unit = time.Minute
+		case "s":
+			unit = time.Second
+		}
+		// Check for overflow so that a huge duration doesn't wrap around
+		if num > int64(maxDuration-d)/int64(unit) {
+			return time.Duration(0), errors.Errorf("invalid duration %q, it is too long", value)
+		}
+		d += time.Duration(num) * unit
+	}
+
+	if matched != value {
+		var err error
+		d, err = time.ParseDuration(value)
+		if err != nil {
+			return time.Duration(0), err
+		}
+	}
+
+	if d <= 0 {
+		return time.Duration(0), errors.Errorf("invalid duration %q, it must be longer than 0", value)
+	}
+	return d, nil
+}
+
+// formatDuration converts a duration to the shortest compound duration, such as 1d2h30m.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Minute {
+		return "1m"
+	}
+
+	var b strings.Builder
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"d", day},
+		{"h", time.Hour},
+		{"m", time.Minute},
+	}
+	for _, u := range units {
+		if n := d / u.size; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, u.suffix)
+			d -= n * u.size
+		}
+	}
+	return b.String()
+}
+
+// EndTime is when a status should end, such as "5pm", "tomorrow",
+// "Monday 9am" or "end of day".
+type EndTime struct {
+	endOfDay bool
+	tomorrow bool
+	weekday  *time.Weekday
+	hasClock bool
+	hour     int
+	minute   int
+}
+
+// parseEndTime parses an end time expression.
+func parseEndTime(value string) (EndTime, error) {
+	fields := strings.Fields(strings.ToLower(value))
+	if len(fields) == 0 {
+		return EndTime{}, errors.Errorf("missing end time, %s", endTimeExamples)
+	}
+
+	switch strings.Join(fields, " ") {
+	case "end of day", "eod":
+		return EndTime{endOfDay: true}, nil
+	}
+
+	var e EndTime
+	if fields[0] == "tomorrow" {
+		e.tomorrow = true
+		fields = fields[1:]
+	} else if wd, ok := weekdayNames[fields[0]]; ok {
+		e.weekday = &wd
+		fields = fields[1:]
+	}
+
+	sawAt := false
+	if len(fields) > 0 && fields[0] == "at" && (e.tomorrow || e.weekday != nil) {
+		sawAt = true
+		fields = fields[1:]
+	}
+
+	switch len(fields) {
+	case 0:
+		if sawAt || (!e.tomorrow && e.weekday == nil) {
+			return EndTime{}, errors.Errorf("invalid end time %q, %s", value, endTimeExamples)
+		}
+	case 1:
+		hour, minute, err := parseTimeOfDay(fields[0])
+		if err != nil {
+			return EndTime{}, errors.Errorf("invalid end time %q, %s", value, endTimeExamples)
+		}
+		e.hasClock = true
+		e.hour = hour
+		e.minute = minute
+	default:
+		return EndTime{}, errors.Errorf("invalid end time %q, %s", value, endTimeExamples)
+	}
+
+	return e, nil
+}
+
+// Resolve finds the first time after start that matches the end time, in the
+// time zone of start. A day without a time, such as "tomorrow", means the start
+// of the user's working hours that day, and "end of day" means the end of their
+// next working day.
+func (e EndTime) Resolve(start time.Time, settings Settings) time.Time {
+	date := func(days int, hour int, minute int) time.Time {
+		return time.Date(start.Year(), start.Month(), start.Day()+days, hour, minute, 0, 0, start.Location())
+	}
+
+	at := func(days int) time.Time {
+		if e.hasClock {
+			return date(days, e.hour, e.minute)
+		}
+
+		day := date(days, 0, 0)
+		if hours, ok := settings.WorkingDay(day.Weekday()); ok {
+			return date(days, hours.StartHour, hours.StartMinute)
+		}
+		return date(days, defaultWorkdayStartHour, 0)
+	}
+
+	switch {
+	case e.endOfDay:
+		for days := 0; days <= 7; days++ {
+			day := date(days, 0, 0)
+			hours, ok := settings.WorkingDay(day.Weekday())
+			if !ok {
+				continue
+			}
+			if end := date(days, hours.EndHour, hours.EndMinute); end.After(start) {
+				return end
+			}
+		}
+
+		// There aren't any working days, so use the default end of the day
+		if end := date(0, defaultWorkdayEndHour, 0); end.After(start) {
+			return end
+		}
+		return date(1, defaultWorkdayEndHour, 0)
+	case e.tomorrow:
+		return at(1)
+	case e.weekday != nil:
+		days := (int(*e.weekday) - int(start.Weekday()) + 7) % 7
+		if end := at(days); end.After(start) {
+			return end
+		}
+		return at(days + 7)
+	default:
+		if end := at(0); end.After(start) {
+			return end
+		}
+		return at(1)
+	}
+}
+
+// parseTimeOfDay converts a time of day, such as 5pm, noon or 17:30, into hours and minutes.
+func parseTimeOfDay(value string) (int, int, error) {
+	switch strings.ToLower(value) {
+	case "noon":
+		return 12, 0, nil
+	case "midnight":
+		return 0, 0, nil
+	}
+	return parseClock(value)
+}
+
+// matchEndTime finds the longest end time at the start of the words,
+// returning the end time and how many words it used, or 0 when there isn't one.
+func matchEndTime(words []string) (string, int) {
+	for n := maxEndTimeWords; n > 0; n-- {
+		if n > len(words) {
+			continue
+		}
+
+		value := strings.Join(words[:n], " ")
+		if _, err := parseEndTime(value); err == nil {
+			return value, n
+		}
+	}
+	return "", 0
+}
+
+// resolveEndTime replaces the action's end time with the duration from start
+// until the end time, using the time zone of start.
+func resolveEndTime(action Action, start time.Time, settings Settings) (Action, error) {
+	if action.Until == "" {
+		return action, nil
+	}
+
+	e, err := parseEndTime(action.Until)
+	if err != nil {
+		return Action{}, err
+	}
+
+	action.Duration = formatDuration(e.Resolve(start, settings).Sub(start))
+	action.Until = ""
+	return action, nil
+}
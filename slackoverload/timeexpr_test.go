@@ -0,0 +1,184 @@
+package slackoverload
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCompoundDuration(t *testing.T) {
+	testcases := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "15m", want: 15 * time.Minute},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "1d12h", want: 36 * time.Hour},
+		{value: "2w", want: 14 * 24 * time.Hour},
+		{value: "1w2d3h4m5s", want: 9*24*time.Hour + 3*time.Hour + 4*time.Minute + 5*time.Second},
+		{value: "1.5h", want: 90 * time.Minute},
+		{value: "15000w", want: 15000 * week},
+		{value: "1x", wantErr: true},
+		{value: "h", wantErr: true},
+		{value: "0s", wantErr: true},
+		{value: "0h0m", wantErr: true},
+		{value: "-5m", wantErr: true},
+		{value: "16000w", wantErr: true},
+		{value: "99999999999w", wantErr: true},
+		{value: "15000w15000w", wantErr: true},
+		{value: "99999999999999999999s", wantErr: true},
+		{value: "9999999999h", wantErr: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := parseCompoundDuration(tc.value)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	testcases := map[time.Duration]string{
+		0:                             "1m",
+		20 * time.Second:              "1m",
+		90 * time.Second:              "2m",
+		time.Hour:                     "1h",
+		36*time.Hour + 30*time.Minute: "1d12h30m",
+		2 * week:                      "14d",
+	}
+
+	for d, want := range testcases {
+		if got := formatDuration(d); got != want {
+			t.Errorf("%s: expected %s, got %s", d, want, got)
+		}
+
+		// The formatted duration can be parsed again
+		if _, err := parseCompoundDuration(formatDuration(d)); err != nil {
+			t.Errorf("%s: could not parse %s: %v", d, formatDuration(d), err)
+		}
+	}
+}
+
+func TestEndTime_Resolve(t *testing.T) {
+	loc := time.FixedZone("CST", -6*60*60)
+	monday := func(hour int) time.Time {
+		return time.Date(2026, time.October, 19, hour, 0, 0, 0, loc)
+	}
+	friday := time.Date(2026, time.October, 23, 18, 0, 0, 0, loc)
+
+	var shortWeek Settings
+	shortWeek.SetHours([]time.Weekday{time.Friday}, nil)
+	shortWeek.SetHours([]time.Weekday{time.Tuesday}, &WorkingDay{StartHour: 8, EndHour: 16})
+
+	testcases := []struct {
+		name     string
+		value    string
+		start    time.Time
+		settings Settings
+		want     string
+	}{
+		{name: "later today", value: "7pm", start: monday(18), want: "Mon Oct 19 19:00"},
+		{name: "already past", value: "5pm", start: monday(18), want: "Tue Oct 20 17:00"},
+		{name: "exactly now", value: "6pm", start: monday(18), want: "Tue Oct 20 18:00"},
+		{name: "24 hour clock", value: "17:30", start: monday(8), want: "Mon Oct 19 17:30"},
+		{name: "noon", value: "noon", start: monday(18), want: "Tue Oct 20 12:00"},
+		{name: "midnight", value: "midnight", start: monday(18), want: "Tue Oct 20 00:00"},
+		{name: "tomorrow", value: "tomorrow", start: monday(18), want: "Tue Oct 20 09:00"},
+		{name: "tomorrow at a time", value: "tomorrow at 10am", start: monday(18), want: "Tue Oct 20 10:00"},
+		{name: "tomorrow with working hours", value: "tomorrow", start: monday(18), settings: shortWeek, want: "Tue Oct 20 08:00"},
+		{name: "tomorrow is a day off", value: "tomorrow", start: time.Date(2026, time.October, 22, 18, 0, 0, 0, loc), settings: shortWeek, want: "Fri Oct 23 09:00"},
+		{name: "monday before the time", value: "Monday 9am", start: monday(8), want: "Mon Oct 19 09:00"},
+		{name: "monday after the time", value: "Monday 9am", start: monday(18), want: "Mon Oct 26 09:00"},
+		{name: "weekday without a time", value: "fri", start: monday(18), want: "Fri Oct 23 09:00"},
+		{name: "end of day", value: "end of day", start: monday(8), want: "Mon Oct 19 17:00"},
+		{name: "end of day after work", value: "EOD", start: monday(18), want: "Tue Oct 20 17:00"},
+		{name: "end of day on a friday", value: "end of day", start: friday, want: "Mon Oct 26 17:00"},
+		{name: "end of day with working hours", value: "end of day", start: monday(18), settings: shortWeek, want: "Tue Oct 20 16:00"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := parseEndTime(tc.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := e.Resolve(tc.start, tc.settings)
+			if got.Location() != loc {
+				t.Fatalf("expected the end time in the time zone of start, got %s", got.Location())
+			}
+			if got.Format("Mon Jan 2 15:04") != tc.want {
+				t.Fatalf("expected %s, got %s", tc.want, got.Format("Mon Jan 2 15:04"))
+			}
+		})
+	}
+}
+
+func TestParseEndTime_Invalid(t *testing.T) {
+	for _, value := range []string{"", "whenever", "5x", "monday tuesday", "5pm 6pm", "tomorrow at", "at 5pm", "25:00", "end of"} {
+		if _, err := parseEndTime(value); err == nil {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestMatchEndTime(t *testing.T) {
+	testcases := []struct {
+		words []string
+		want  string
+		n     int
+	}{
+		{words: []string{"5pm", "DND"}, want: "5pm", n: 1},
+		{words: []string{"end", "of", "day", "DND"}, want: "end of day", n: 3},
+		{words: []string{"tomorrow", "at", "9am"}, want: "tomorrow at 9am", n: 3},
+		{words: []string{"Monday", "9am", "then"}, want: "Monday 9am", n: 2},
+		{words: []string{"Monday", "then"}, want: "Monday", n: 1},
+		{words: []string{"whenever"}, n: 0},
+		{words: nil, n: 0},
+	}
+
+	for _, tc := range testcases {
+		got, n := matchEndTime(tc.words)
+		if got != tc.want || n != tc.n {
+			t.Errorf("%v: expected %q (%d words), got %q (%d words)", tc.words, tc.want, tc.n, got, n)
+		}
+	}
+}
+
+func TestResolveEndTime(t *testing.T) {
+	start := time.Date(2026, time.October, 19, 18, 0, 0, 0, time.FixedZone("CST", -6*60*60))
+
+	action, err := resolveEndTime(Action{Until: "tomorrow", Duration: "1h"}, start, Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action.Duration != "15h" || action.Until != "" {
+		t.Fatalf("expected the end time to be converted to a duration, got %#v", action)
+	}
+
+	action, err = resolveEndTime(Action{Duration: "1h"}, start, Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action.Duration != "1h" {
+		t.Fatalf("expected the duration to be kept, got %#v", action)
+	}
+
+	_, err = resolveEndTime(Action{Until: "whenever"}, start, Settings{})
+	if err == nil {
+		t.Fatal("expected an invalid end time to be rejected")
+	}
+}
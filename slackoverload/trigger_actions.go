@@ -0,0 +1,96 @@
+package slackoverload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+// Action ids of the buttons shown next to each trigger, the value of the
+// button is the name of the trigger.
+const (
+	triggerActionRun    = "trigger-run"
+	triggerActionEdit   = "trigger-edit"
+	triggerActionDelete = "trigger-delete"
+)
+
+// maxBlockIdLength is the longest block id that Slack accepts.
+const maxBlockIdLength = 255
+
+// buildBlockId combines a prefix with the name of a trigger, using a hash of
+// the name instead when the block id would be too long for Slack.
+func buildBlockId(prefix string, name string) string {
+	if len(prefix)+len(name) <= maxBlockIdLength {
+		return prefix + name
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	return prefix + hex.EncodeToString(sum[:])
+}
+
+// triggerButtons builds the buttons to run, edit or delete a trigger.
+func triggerButtons(name string) *slack.ActionBlock {
+	return slack.NewActionBlock(buildBlockId("trigger-", name),
+		triggerButton(triggerActionRun, "Trigger", name, name),
+		triggerButton(triggerActionEdit, "Edit", name, name),
+		triggerButton(triggerActionDelete, "Delete", name, name))
+}
+
+// triggerButton builds a button that runs an action on a trigger. The value
+// is the text for the command, such as the name followed by overrides.
+func triggerButton(actionId string, label string, name string, value string) *slack.ButtonBlockElement {
+	button := slack.NewButtonBlockElement(actionId, value, plainText(label))
+	switch actionId {
+	case triggerActionRun:
+		button.WithStyle(slack.StylePrimary)
+	case triggerActionDelete:
+		button.WithStyle(slack.StyleDanger)
+		button.Confirm = slack.NewConfirmationBlockObject(
+			plainText("Delete Trigger"),
+			slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("Are you sure that you want to delete *%s*?", name), false, false),
+			plainText("Delete"),
+			plainText("Cancel"))
+	}
+	return button
+}
+
+// RunBlockAction handles a button clicked in one of our messages. The message
+// that is returned replaces the message with the button, an empty message leaves
+// it unchanged.
+func (a *App) RunBlockAction(p InteractionPayload) (slack.Msg, error) {
+	if len(p.ActionCallback.BlockActions) == 0 {
+		return slack.Msg{}, errors.New("no action was clicked")
+	}
+	action := p.ActionCallback.BlockActions[0]
+
+	fmt.Printf("%s clicked %s %s by %s(%s) on %s(%s)\n",
+		now(), action.ActionID, action.Value, p.User.Name, p.User.ID, p.Team.Domain, p.Team.ID)
+
+	payload := SlackPayload{
+		SlackId:     p.User.ID,
+		UserName:    p.User.Name,
+		TeamId:      p.Team.ID,
+		TeamName:    p.Team.Domain,
+		Text:        action.Value,
+		TriggerId:   p.TriggerID,
+		ResponseURL: p.ResponseURL,
+	}
+
+	switch action.ActionID {
+	case triggerActionRun:
+		return a.Trigger(TriggerRequest{SlackPayload: payload})
+	case triggerActionEdit:
+		return a.EditTrigger(EditTriggerRequest{SlackPayload: payload})
+	case triggerActionDelete:
+		return a.DeleteTrigger(DeleteTriggerRequest{SlackPayload: payload})
+	case libraryActionAdopt:
+		return a.AdoptTrigger(AdoptTriggerRequest{SlackPayload: payload})
+	case libraryActionUnpublish:
+		return a.UnpublishTrigger(UnpublishTriggerRequest{SlackPayload: payload})
+	default:
+		return slack.Msg{}, errors.Errorf("unexpected action %q", action.ActionID)
+	}
+}
@@ -0,0 +1,21 @@
+package slackoverload
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTriggerButtons_BlockId(t *testing.T) {
+	if got := triggerButtons("lunch").BlockID; got != "trigger-lunch" {
+		t.Fatalf("expected the block id to use the name, got %q", got)
+	}
+
+	long := strings.Repeat("a", maxBlockIdLength)
+	got := triggerButtons(long).BlockID
+	if len(got) > maxBlockIdLength {
+		t.Fatalf("expected the block id to be at most %d characters, got %d", maxBlockIdLength, len(got))
+	}
+	if other := triggerButtons(long + "b").BlockID; got == other {
+		t.Fatalf("expected different names to have different block ids, got %q for both", got)
+	}
+}
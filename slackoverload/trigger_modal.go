@@ -0,0 +1,342 @@
+package slackoverload
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+// triggerEditorCallbackId identifies submissions of the trigger editor modal.
+const triggerEditorCallbackId = "trigger-editor"
+
+// Block ids of the fields in the trigger editor, every field uses
+// triggerEditorActionId for its element.
+const (
+	triggerEditorName       = "name"
+	triggerEditorStatusText = "status-text"
+	triggerEditorEmoji      = "emoji"
+	triggerEditorPresence   = "presence"
+	triggerEditorDnD        = "dnd"
+	triggerEditorDuration   = "duration"
+	triggerEditorScope      = "scope"
+	triggerEditorActionId   = "value"
+)
+
+const (
+	scopeWorkspace = "workspace"
+	scopeGlobal    = "global"
+)
+
+// triggerEditorMetadata is kept in the modal between opening and submitting it.
+type triggerEditorMetadata struct {
+	// TeamId is the workspace for the trigger when it isn't global.
+	TeamId string `json:"team"`
+
+	// Original is the name of the trigger being edited, or empty for a new trigger.
+	Original string `json:"original,omitempty"`
+}
+
+type EditTriggerRequest struct {
+	SlackPayload
+}
+
+func (r EditTriggerRequest) GetName() string {
+	return strings.TrimSpace(r.Text)
+}
+
+// EditTrigger opens the trigger editor filled in with an existing trigger.
+func (a *App) EditTrigger(r EditTriggerRequest) (slack.Msg, error) {
+	fmt.Printf("%s /overload edit %s from %s(%s) on %s(%s)\n",
+		now(), r.GetName(), r.UserName, r.SlackId, r.TeamName, r.TeamId)
+
+	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
+	if err != nil {
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
+	}
+
+	if r.GetName() == "" {
+		return slack.Msg{}, errors.New("Which trigger? Try /overload edit lunch")
+	}
+
+	tmpl, err := a.getTrigger(userId, r.GetName())
+	if err != nil {
+		if IsNotFound(err) {
+			return a.suggestTriggers(userId, r.TeamId, r.GetName(), triggerActionEdit, err)
+		}
+		return slack.Msg{}, err
+	}
+
+	err = a.openTriggerEditor(r.SlackId, r.TriggerId, tmpl, true)
+	return slack.Msg{}, err
+}
+
+// openTriggerEditor shows a modal for creating a trigger, or editing an existing one.
+func (a *App) openTriggerEditor(slackId string, triggerId string, tmpl ActionTemplate, editing bool) error {
+	token, err := a.getSlackToken(slackId)
+	if err != nil {
+		return err
+	}
+
+	view, err := buildTriggerEditor(tmpl, editing)
+	if err != nil {
+		return err
+	}
+
+	err = openView(token.AccessToken, triggerId, view)
+	return errors.Wrap(err, "could not open the trigger editor")
+}
+
+func buildTriggerEditor(tmpl ActionTemplate, editing bool) (View, error) {
+	metadata := triggerEditorMetadata{TeamId: tmpl.TeamId}
+	title := "Create Trigger"
+	if editing {
+		metadata.Original = tmpl.Name
+		title = "Edit Trigger"
+	}
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return View{}, errors.Wrap(err, "error marshaling trigger editor metadata")
+	}
+
+	duration := tmpl.Duration
+	if tmpl.Until != "" {
+		duration = tmpl.Until
+	}
+
+	presence := selectOption("Away", string(PresenceAway))
+	if tmpl.Presence == PresenceActive {
+		presence = selectOption("Active", string(PresenceActive))
+	}
+
+	dnd := selectOption("Off", "off")
+	if tmpl.DnD {
+		dnd = selectOption("On", "on")
+	}
+
+	scope := selectOption("This workspace", scopeWorkspace)
+	if tmpl.Global {
+		scope = selectOption("All workspaces", scopeGlobal)
+	}
+
+	view := View{
+		Type:            ViewTypeModal,
+		CallbackID:      triggerEditorCallbackId,
+		PrivateMetadata: string(b),
+		Title:           plainText(title),
+		Submit:          plainText("Save"),
+		Close:           plainText("Cancel"),
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			textInput(triggerEditorName, "Name", tmpl.Name, "lunch", false, 0,
+				"Use letters, numbers, dashes and underscores"),
+			textInput(triggerEditorStatusText, "Status Text", tmpl.StatusText, "brb omnomnom", true, maxStatusTextLength, ""),
+			textInput(triggerEditorEmoji, "Emoji", tmpl.StatusEmoji, ":burrito:", true, 0, ""),
+			selectInput(triggerEditorPresence, "Presence", presence,
+				selectOption("Away", string(PresenceAway)),
+				selectOption("Active", string(PresenceActive))),
+			selectInput(triggerEditorDnD, "Do Not Disturb", dnd,
+				selectOption("Off", "off"),
+				selectOption("On", "on")),
+			textInput(triggerEditorDuration, "Duration", duration, "1h30m", true, 0,
+				"How long the trigger applies, such as 1h30m, or when it ends, such as 5pm or tomorrow"),
+			selectInput(triggerEditorScope, "Workspaces", scope,
+				selectOption("This workspace", scopeWorkspace),
+				selectOption("All workspaces", scopeGlobal)),
+		}},
+	}
+	return view, nil
+}
+
+// SubmitTriggerEditor validates and saves the trigger from the editor. The
+// response has errors to show next to the fields, or is nil when the trigger
+// was saved and the modal can close.
+func (a *App) SubmitTriggerEditor(p InteractionPayload) (*ViewSubmissionResponse, error) {
+	fmt.Printf("%s trigger editor submitted by %s(%s) on %s(%s)\n",
+		now(), p.User.Name, p.User.ID, p.Team.Domain, p.Team.ID)
+
+	userId, err := a.lookupUserIdFromSlackId(p.User.ID)
+	if err != nil {
+		if IsNotFound(err) {
+			return a.handleUserNotRegisteredView(), nil
+		}
+		return nil, err
+	}
+
+	var metadata triggerEditorMetadata
+	err = json.Unmarshal([]byte(p.View.PrivateMetadata), &metadata)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling trigger editor metadata %q", p.View.PrivateMetadata)
+	}
+
+	tmpl, errs := parseTriggerEditor(p.View.State)
+	if len(errs) > 0 {
+		return NewViewErrors(errs), nil
+	}
+
+	tmpl.TeamId = metadata.TeamId
+	if tmpl.TeamId == "" {
+		tmpl.TeamId = p.Team.ID
+	}
+
+	if metadata.Original != "" {
+		// The editor only changes the first step, keep the rest
+		original, err := a.getTrigger(userId, metadata.Original)
+		if err != nil && !IsNotFound(err) {
+			return nil, err
+		}
+		tmpl.Steps = original.Steps
+		if tmpl.Global {
+			tmpl.Workspaces = original.Workspaces
+		}
+
+		_, err = expandTriggerSteps(tmpl, a.triggerLookup(userId, tmpl))
+		if err != nil {
+			return NewViewErrors(map[string]string{triggerEditorDuration: err.Error()}), nil
+		}
+	}
+	if metadata.Original == tmpl.Name {
+		err = a.updateTrigger(userId, tmpl.Name, func(existing *ActionTemplate) error {
+			*existing = tmpl
+			return nil
+		})
+	} else {
+		// Creating or renaming a trigger must not overwrite another trigger
+		err = a.createTrigger(userId, tmpl)
+		if IsConflict(err) {
+			return NewViewErrors(map[string]string{
+				triggerEditorName: fmt.Sprintf("You already have a trigger named %s, pick a different name", tmpl.Name),
+			}), nil
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error saving trigger %s for %s(%s)", tmpl.Name, p.User.Name, p.User.ID)
+	}
+
+	if metadata.Original != "" && metadata.Original != tmpl.Name {
+		// The trigger was renamed
+		key, err := triggerKey(userId, metadata.Original)
+		if err != nil {
+			return nil, err
+		}
+		err = a.Storage.DeleteBlob("triggers", key)
+		if err != nil && !IsNotFound(err) {
+			return nil, errors.Wrapf(err, "error removing the old trigger %s for %s(%s)", metadata.Original, p.User.Name, p.User.ID)
+		}
+	}
+
+	return nil, nil
+}
+
+// handleUserNotRegisteredView replaces a submitted modal with instructions
+// for activating the app.
+func (a *App) handleUserNotRegisteredView() *ViewSubmissionResponse {
+	msg := a.handleUserNotRegistered()
+	return NewViewUpdate(View{
+		Type:   ViewTypeModal,
+		Title:  plainText("Slack Overload"),
+		Close:  plainText("Close"),
+		Blocks: msg.Blocks,
+	})
+}
+
+// parseTriggerEditor builds a trigger from the fields in the editor, returning
+// an error message for each invalid field by block id.
+func parseTriggerEditor(state ViewState) (ActionTemplate, map[string]string) {
+	errs := make(map[string]string)
+	get := func(blockId string) string {
+		return state.Get(blockId, triggerEditorActionId)
+	}
+
+	tmpl := ActionTemplate{
+		Name:   get(triggerEditorName),
+		Global: get(triggerEditorScope) == scopeGlobal,
+		Action: Action{
+			Presence:   PresenceAway,
+			StatusText: get(triggerEditorStatusText),
+			DnD:        get(triggerEditorDnD) == "on",
+		},
+	}
+
+	if !triggerNamePattern.MatchString(tmpl.Name) {
+		errs[triggerEditorName] = "The name can only have letters, numbers, dashes and underscores"
+	}
+
+	if n := utf8.RuneCountInString(tmpl.StatusText); n > maxStatusTextLength {
+		errs[triggerEditorStatusText] = fmt.Sprintf("The status text is %d characters but Slack only allows %d", n, maxStatusTextLength)
+	}
+	if isStatusTemplate(tmpl.StatusText) {
+		if _, err := parseStatusTemplate(tmpl.StatusText); err != nil {
+			errs[triggerEditorStatusText] = fmt.Sprintf("The status text isn't a valid template, %s", err)
+		}
+	}
+
+	emoji := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(get(triggerEditorEmoji), "("), ")"))
+	if emoji != "" && !isEmoji(emoji) {
+		errs[triggerEditorEmoji] = "Use a single emoji, such as :boat: or ⛵️"
+	}
+	tmpl.StatusEmoji = emoji
+
+	if get(triggerEditorPresence) == string(PresenceActive) {
+		tmpl.Presence = PresenceActive
+	}
+
+	if duration := get(triggerEditorDuration); duration != "" {
+		if _, err := (Action{Duration: duration}).ParseDuration(); err == nil {
+			tmpl.Duration = duration
+		} else if _, err := parseEndTime(duration); err == nil {
+			tmpl.Until = duration
+		} else {
+			errs[triggerEditorDuration] = fmt.Sprintf("Use a duration such as 15m, 1h30m, 2d or 1w, or an end time, %s", endTimeExamples)
+		}
+	}
+
+	return tmpl, errs
+}
+
+func plainText(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.PlainTextType, text, false, false)
+}
+
+func selectOption(text string, value string) SelectOption {
+	return SelectOption{Text: plainText(text), Value: value}
+}
+
+func textInput(blockId string, label string, value string, placeholder string, optional bool, maxLength int, hint string) InputBlock {
+	block := InputBlock{
+		Type:     MBTInput,
+		BlockID:  blockId,
+		Label:    plainText(label),
+		Optional: optional,
+		Element: PlainTextInputElement{
+			Type:         METPlainTextInput,
+			ActionID:     triggerEditorActionId,
+			Placeholder:  plainText(placeholder),
+			InitialValue: value,
+			MaxLength:    maxLength,
+		},
+	}
+	if hint != "" {
+		block.Hint = plainText(hint)
+	}
+	return block
+}
+
+func selectInput(blockId string, label string, initial SelectOption, options ...SelectOption) InputBlock {
+	return InputBlock{
+		Type:    MBTInput,
+		BlockID: blockId,
+		Label:   plainText(label),
+		Element: StaticSelectElement{
+			Type:          METStaticSelect,
+			ActionID:      triggerEditorActionId,
+			Options:       options,
+			InitialOption: &initial,
+		},
+	}
+}
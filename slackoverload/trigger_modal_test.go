@@ -0,0 +1,206 @@
+package slackoverload
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// editorState fills in the trigger editor fields by block id.
+func editorState(fields map[string]string) ViewState {
+	state := ViewState{Values: map[string]map[string]ViewStateValue{}}
+	for blockId, value := range fields {
+		state.Values[blockId] = map[string]ViewStateValue{triggerEditorActionId: {Value: value}}
+	}
+	return state
+}
+
+func TestParseTriggerEditor(t *testing.T) {
+	testcases := []struct {
+		name     string
+		fields   map[string]string
+		want     ActionTemplate
+		wantErrs []string
+	}{
+		{
+			name:   "only a name",
+			fields: map[string]string{triggerEditorName: "lunch"},
+			want:   ActionTemplate{Name: "lunch", Action: Action{Presence: PresenceAway}},
+		},
+		{
+			name: "every field",
+			fields: map[string]string{
+				triggerEditorName:       " lunch ",
+				triggerEditorStatusText: "brb (soon)",
+				triggerEditorEmoji:      "(:taco:)",
+				triggerEditorPresence:   string(PresenceActive),
+				triggerEditorDnD:        "on",
+				triggerEditorDuration:   "1h30m",
+				triggerEditorScope:      scopeGlobal,
+			},
+			want: ActionTemplate{Name: "lunch", Global: true, Action: Action{
+				Presence: PresenceActive, StatusText: "brb (soon)", StatusEmoji: ":taco:", DnD: true, Duration: "1h30m"}},
+		},
+		{
+			name:   "end time",
+			fields: map[string]string{triggerEditorName: "lunch", triggerEditorDuration: "tomorrow 10am", triggerEditorScope: scopeWorkspace},
+			want:   ActionTemplate{Name: "lunch", Action: Action{Presence: PresenceAway, Until: "tomorrow 10am"}},
+		},
+		{
+			name: "invalid fields",
+			fields: map[string]string{
+				triggerEditorName:     "out to lunch",
+				triggerEditorEmoji:    "taco",
+				triggerEditorDuration: "whenever",
+			},
+			wantErrs: []string{triggerEditorDuration, triggerEditorEmoji, triggerEditorName},
+		},
+		{
+			name:     "missing name",
+			fields:   map[string]string{},
+			wantErrs: []string{triggerEditorName},
+		},
+		{
+			name:     "status text too long",
+			fields:   map[string]string{triggerEditorName: "lunch", triggerEditorStatusText: strings.Repeat("a", maxStatusTextLength+1)},
+			wantErrs: []string{triggerEditorStatusText},
+		},
+		{
+			name:     "invalid template",
+			fields:   map[string]string{triggerEditorName: "lunch", triggerEditorStatusText: "lunch with {{.Arg"},
+			wantErrs: []string{triggerEditorStatusText},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, errs := parseTriggerEditor(editorState(tc.fields))
+
+			var gotErrs []string
+			for blockId := range errs {
+				gotErrs = append(gotErrs, blockId)
+			}
+			sort.Strings(gotErrs)
+			if !reflect.DeepEqual(tc.wantErrs, gotErrs) {
+				t.Fatalf("expected errors for %v, got %v", tc.wantErrs, errs)
+			}
+			if tc.wantErrs == nil && !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected %#v, got %#v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSubmitTriggerEditor(t *testing.T) {
+	submit := func(t *testing.T, a *App, original string, name string) *ViewSubmissionResponse {
+		metadata, _ := json.Marshal(triggerEditorMetadata{TeamId: "T1", Original: original})
+
+		var p InteractionPayload
+		p.User.ID = "U1"
+		p.Team.ID = "T1"
+		p.View.PrivateMetadata = string(metadata)
+		p.View.State = editorState(map[string]string{triggerEditorName: name, triggerEditorStatusText: "updated", triggerEditorDuration: "1h"})
+
+		response, err := a.SubmitTriggerEditor(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	newApp := func(t *testing.T) *App {
+		a := newTwoWorkspaceApp(t)
+		for _, tmpl := range []ActionTemplate{
+			{Name: "lunch", TeamId: "T1", Action: Action{StatusText: "lunch"}, Steps: []TriggerStep{{Action: Action{StatusText: "back"}}}},
+			{Name: "meeting", TeamId: "T1", Action: Action{StatusText: "meeting"}},
+		} {
+			if err := a.createTrigger("u1", tmpl); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return a
+	}
+
+	statusText := func(t *testing.T, a *App, name string) string {
+		tmpl, err := a.getTrigger("u1", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tmpl.StatusText
+	}
+
+	wantNameConflict := func(t *testing.T, response *ViewSubmissionResponse) {
+		if response == nil || response.ResponseAction != "errors" || !strings.Contains(response.Errors[triggerEditorName], "already have a trigger") {
+			t.Fatalf("expected an error on the name, got %#v", response)
+		}
+	}
+
+	t.Run("create", func(t *testing.T) {
+		a := newApp(t)
+		if response := submit(t, a, "", "coffee"); response != nil {
+			t.Fatalf("expected the modal to close, got %#v", response)
+		}
+		if got := statusText(t, a, "coffee"); got != "updated" {
+			t.Fatalf("expected the trigger to be created, got %q", got)
+		}
+	})
+
+	t.Run("create existing name", func(t *testing.T) {
+		a := newApp(t)
+		wantNameConflict(t, submit(t, a, "", "meeting"))
+		if got := statusText(t, a, "meeting"); got != "meeting" {
+			t.Fatalf("expected the existing trigger to be kept, got %q", got)
+		}
+	})
+
+	t.Run("edit", func(t *testing.T) {
+		a := newApp(t)
+		if response := submit(t, a, "lunch", "lunch"); response != nil {
+			t.Fatalf("expected the modal to close, got %#v", response)
+		}
+		tmpl, err := a.getTrigger("u1", "lunch")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tmpl.StatusText != "updated" || len(tmpl.Steps) != 1 {
+			t.Fatalf("expected the trigger to be updated and keep its steps, got %#v", tmpl)
+		}
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		a := newApp(t)
+		if response := submit(t, a, "lunch", "brunch"); response != nil {
+			t.Fatalf("expected the modal to close, got %#v", response)
+		}
+		if got := statusText(t, a, "brunch"); got != "updated" {
+			t.Fatalf("expected the trigger to be renamed, got %q", got)
+		}
+		if _, err := a.getTrigger("u1", "lunch"); !IsNotFound(err) {
+			t.Fatalf("expected the old trigger to be removed, got %v", err)
+		}
+	})
+
+	t.Run("rename to existing name", func(t *testing.T) {
+		a := newApp(t)
+		wantNameConflict(t, submit(t, a, "lunch", "meeting"))
+		if got := statusText(t, a, "meeting"); got != "meeting" {
+			t.Fatalf("expected the existing trigger to be kept, got %q", got)
+		}
+		if got := statusText(t, a, "lunch"); got != "lunch" {
+			t.Fatalf("expected the renamed trigger to be kept, got %q", got)
+		}
+	})
+
+	t.Run("not registered", func(t *testing.T) {
+		a := &App{Storage: NewMemoryStorage()}
+		response := submit(t, a, "", "lunch")
+		if response == nil || response.View == nil {
+			t.Fatalf("expected the modal to be replaced, got %#v", response)
+		}
+		if !reflect.DeepEqual(a.handleUserNotRegistered().Blocks, response.View.Blocks) {
+			t.Fatalf("expected the not registered message, got %#v", response.View.Blocks)
+		}
+	})
+}
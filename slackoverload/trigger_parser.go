@@ -0,0 +1,541 @@
+package slackoverload
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// maxStatusTextLength is the longest status text that Slack accepts.
+const maxStatusTextLength = 100
+
+const triggerExample = `/create-trigger vacation = "I'm on a boat!" (⛵️) DND for 1w`
+
+var (
+	triggerNamePattern = regexp.MustCompile(`^[\w-]+$`)
+	emojiCodePattern   = regexp.MustCompile(`^:[\w+'-]+:$`)
+)
+
+// Keywords in a trigger definition. They are case sensitive so that
+// unquoted status text like "away from my desk" isn't mistaken for them.
+const (
+	keywordAway     = "AWAY"
+	keywordActive   = "ACTIVE"
+	keywordDnD      = "DND"
+	keywordNoDnD    = "NODND"
+	keywordDuration = "for"
+	keywordUntil    = "until"
+	keywordThen     = "then"
+)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenEquals
+	tokenQuoted
+	tokenParens
+)
+
+// token is a piece of a trigger definition.
+type token struct {
+	kind tokenKind
+
+	// value is the token with any quotes or parentheses removed.
+	value string
+
+	// raw is the token as it was typed.
+	raw string
+
+	// pos is the 1-based character position where the token starts.
+	pos int
+}
+
+// TriggerParseError points at the part of a trigger definition that is invalid.
+type TriggerParseError struct {
+	Token    string
+	Position int
+	Reason   string
+}
+
+func (e TriggerParseError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("Invalid trigger definition: %s. Try %s", e.Reason, triggerExample)
+	}
+	return fmt.Sprintf("Invalid trigger definition at %s (character %d): %s. Try %s",
+		e.Token, e.Position, e.Reason, triggerExample)
+}
+
+func newTriggerParseError(t token, format string, args ...interface{}) TriggerParseError {
+	return TriggerParseError{
+		Token:    t.raw,
+		Position: t.pos,
+		Reason:   fmt.Sprintf(format, args...),
+	}
+}
+
+// tokenizeTrigger splits a trigger definition into words, quoted text,
+// parenthesized text and the equals sign.
+func tokenizeTrigger(def string) ([]token, error) {
+	var tokens []token
+	runes := []rune(def)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '=':
+			i++
+			tokens = append(tokens, token{kind: tokenEquals, value: "=", raw: "=", pos: start + 1})
+		case r == '"' || r == '“':
+			// Accept smart quotes too, since Slack on a Mac likes to insert them
+			closer := '"'
+			if r == '“' {
+				closer = '”'
+			}
+
+			var value strings.Builder
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == closer || runes[i+1] == '\\') {
+					i++
+					value.WriteRune(runes[i])
+					continue
+				}
+				if runes[i] == closer {
+					closed = true
+					i++
+					break
+				}
+				value.WriteRune(runes[i])
+			}
+			t := token{kind: tokenQuoted, value: value.String(), raw: string(runes[start:i]), pos: start + 1}
+			if !closed {
+				return nil, newTriggerParseError(t, "missing closing quote")
+			}
+			tokens = append(tokens, t)
+		case r == '(':
+			depth := 0
+			for ; i < len(runes); i++ {
+				if runes[i] == '(' {
+					depth++
+				} else if runes[i] == ')' {
+					depth--
+					if depth == 0 {
+						i++
+						break
+					}
+				}
+			}
+			t := token{kind: tokenParens, raw: string(runes[start:i]), pos: start + 1}
+			if depth != 0 {
+				return nil, newTriggerParseError(t, "missing closing parenthesis")
+			}
+			t.value = strings.TrimSpace(string(runes[start+1 : i-1]))
+			tokens = append(tokens, t)
+		default:
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '=' && runes[i] != '"' && runes[i] != '“' && runes[i] != '(' {
+				i++
+			}
+			raw := string(runes[start:i])
+			tokens = append(tokens, token{kind: tokenWord, value: raw, raw: raw, pos: start + 1})
+		}
+	}
+	return tokens, nil
+}
+
+// parseTemplate parses a trigger definition:
+//
+//	NAME = [STATUS TEXT | "STATUS TEXT"] [(EMOJI)] [AWAY|ACTIVE] [DND|NODND] [for DURATION | until END] [then STEP]...
+//
+// Everything after the equals sign may be in any order. Unquoted status text
+// is made from the words that aren't keywords, quote it to use a keyword in
+// the text. The user's default DND and duration are used when the definition
+// doesn't specify them.
+//
+// Each step after "then" runs when the previous one ends. A step is either
+// defined the same way, or is the name of another trigger to run, optionally
+// followed by for DURATION or until END. Quote single word status text so that
+// it isn't read as the name of a trigger.
+func parseTemplate(def string, settings Settings) (ActionTemplate, error) {
+	tokens, err := tokenizeTrigger(def)
+	if err != nil {
+		return ActionTemplate{}, err
+	}
+
+	if len(tokens) == 0 {
+		return ActionTemplate{}, TriggerParseError{Reason: "missing the trigger name"}
+	}
+
+	name := tokens[0]
+	if name.kind != tokenWord || !triggerNamePattern.MatchString(name.value) {
+		return ActionTemplate{}, newTriggerParseError(name, "the trigger name can only have letters, numbers, dashes and underscores")
+	}
+	if len(tokens) < 2 || tokens[1].kind != tokenEquals {
+		t := token{raw: name.raw, pos: name.pos}
+		if len(tokens) >= 2 {
+			t = tokens[1]
+		}
+		return ActionTemplate{}, newTriggerParseError(t, "expected = after the trigger name")
+	}
+
+	segments, thens := splitSteps(tokens[2:])
+	for i, segment := range segments {
+		if len(segment) == 0 && i > 0 {
+			return ActionTemplate{}, newTriggerParseError(thens[i-1], "missing the step after %s", keywordThen)
+		}
+	}
+
+	action, err := parseAction(segments[0], settings)
+	if err != nil {
+		return ActionTemplate{}, err
+	}
+	template := ActionTemplate{
+		Name:   name.value,
+		Action: action,
+	}
+
+	for i, segment := range segments[1:] {
+		step, err := parseStep(segment, settings)
+		if err != nil {
+			return ActionTemplate{}, err
+		}
+		template.Steps = append(template.Steps, step)
+
+		// Every step but the last needs to end, so that the next one can start
+		previous := template.Action
+		if i > 0 {
+			previous = template.Steps[i-1].Action
+		}
+		if i == 0 || template.Steps[i-1].Trigger == "" {
+			if previous.Duration == "" && previous.Until == "" {
+				return ActionTemplate{}, newTriggerParseError(thens[i], "the step before %s never ends, give it a duration with for DURATION or until END", keywordThen)
+			}
+		}
+	}
+
+	return template, nil
+}
+
+// splitSteps separates the steps of a definition, returning the tokens for
+// each step and the "then" tokens between them.
+func splitSteps(tokens []token) ([][]token, []token) {
+	segments := [][]token{{}}
+	var thens []token
+	for _, t := range tokens {
+		if t.kind == tokenWord && t.value == keywordThen {
+			thens = append(thens, t)
+			segments = append(segments, []token{})
+			continue
+		}
+		segments[len(segments)-1] = append(segments[len(segments)-1], t)
+	}
+	return segments, thens
+}
+
+// parseStep parses a step after "then", which is either the name of another
+// trigger with an optional duration, or a status to set.
+func parseStep(tokens []token, settings Settings) (TriggerStep, error) {
+	if isTriggerReference(tokens) {
+		action, err := parseAction(tokens[1:], Settings{})
+		if err != nil {
+			return TriggerStep{}, err
+		}
+		return TriggerStep{
+			Trigger: tokens[0].value,
+			Action:  Action{Duration: action.Duration, Until: action.Until},
+		}, nil
+	}
+
+	action, err := parseAction(tokens, settings)
+	if err != nil {
+		return TriggerStep{}, err
+	}
+	return TriggerStep{Action: action}, nil
+}
+
+// isTriggerReference determines if a step is the name of another trigger, a
+// single unquoted word that may be followed by for DURATION or until END.
+func isTriggerReference(tokens []token) bool {
+	name := tokens[0]
+	if name.kind != tokenWord || !triggerNamePattern.MatchString(name.value) || isKeyword(name.value) {
+		return false
+	}
+
+	rest := tokens[1:]
+	switch {
+	case len(rest) == 0:
+		return true
+	case rest[0].kind == tokenWord && rest[0].value == keywordDuration:
+		return len(rest) == 2 && looksLikeDuration(rest[1])
+	case rest[0].kind == tokenWord && rest[0].value == keywordUntil && len(rest) > 1:
+		_, n := matchEndTimeTokens(rest[1:])
+		return n == len(rest)-1
+	default:
+		return false
+	}
+}
+
+func isKeyword(value string) bool {
+	switch value {
+	case keywordAway, keywordActive, keywordDnD, keywordNoDnD, keywordDuration, keywordUntil, keywordThen:
+		return true
+	}
+	return false
+}
+
+// parseAction parses the status text, emoji, presence, DND and duration of a
+// single step of a trigger definition.
+func parseAction(rest []token, settings Settings) (Action, error) {
+	status, err := parseStatusTokens(rest, func(t token, format string, args ...interface{}) error {
+		return newTriggerParseError(t, format, args...)
+	})
+	if err != nil {
+		return Action{}, err
+	}
+
+	action := Action{
+		Presence:    PresenceAway,
+		StatusText:  status.text,
+		StatusEmoji: status.emoji,
+		DnD:         status.dnd,
+		Duration:    status.duration,
+		Until:       status.until,
+	}
+	if status.presence != nil && status.presence.value == keywordActive {
+		action.Presence = PresenceActive
+	}
+	if status.dndToken == nil && settings.DefaultDnD != nil {
+		action.DnD = *settings.DefaultDnD
+	}
+	if status.durationToken == nil {
+		action.Duration = settings.DefaultDuration
+	}
+
+	return action, nil
+}
+
+// statusTokens is a status read from a definition, with the tokens that set
+// each part of it so that errors can point at them. A token is nil when that
+// part of the status wasn't set.
+type statusTokens struct {
+	text string
+	// textToken is the quoted status text, or the first word of unquoted status text.
+	textToken *token
+	// words are the tokens of unquoted status text.
+	words []token
+
+	emoji      string
+	emojiToken *token
+
+	// presence is the AWAY or ACTIVE keyword.
+	presence *token
+
+	dnd      bool
+	dndToken *token
+
+	duration string
+	until    string
+	// timing is the for or until keyword, and durationToken is the value after it.
+	timing        *token
+	durationToken *token
+}
+
+// parseStatusTokens reads the status text, emoji, presence, DND and duration
+// from the tokens of a trigger definition or a workspace override. Errors are
+// built with fail, so that each kind of definition can describe its own syntax.
+func parseStatusTokens(rest []token, fail func(t token, format string, args ...interface{}) error) (statusTokens, error) {
+	var status statusTokens
+	var quotedToken *token
+	for i := 0; i < len(rest); i++ {
+		t := rest[i]
+
+		switch {
+		case t.kind == tokenEquals:
+			return statusTokens{}, fail(t, "only one = is allowed, quote the status text to use it there")
+
+		case t.kind == tokenQuoted:
+			if quotedToken != nil {
+				return statusTokens{}, fail(t, "the status text was already set to %s", quotedToken.raw)
+			}
+			if status.textToken != nil {
+				return statusTokens{}, fail(t, "the status text must either be all quoted or not quoted at all")
+			}
+			quotedToken = &rest[i]
+			status.text = t.value
+
+		case t.kind == tokenParens && isEmoji(t.value):
+			if status.emojiToken != nil {
+				return statusTokens{}, fail(t, "the emoji was already set to %s", status.emojiToken.raw)
+			}
+			status.emojiToken = &rest[i]
+			status.emoji = t.value
+
+		case t.kind == tokenWord && (t.value == keywordAway || t.value == keywordActive):
+			if status.presence != nil {
+				return statusTokens{}, fail(t, "the presence was already set to %s", status.presence.raw)
+			}
+			status.presence = &rest[i]
+
+		case t.kind == tokenWord && (t.value == keywordDnD || t.value == keywordNoDnD):
+			if status.dndToken != nil {
+				return statusTokens{}, fail(t, "Do Not Disturb was already set with %s", status.dndToken.raw)
+			}
+			status.dndToken = &rest[i]
+			status.dnd = t.value == keywordDnD
+
+		case t.kind == tokenWord && t.value == keywordDuration && i+1 < len(rest) && looksLikeDuration(rest[i+1]):
+			i++
+			d := rest[i]
+			if status.durationToken != nil {
+				return statusTokens{}, fail(d, "the duration was already set to %s", status.durationToken.raw)
+			}
+			_, err := Action{Duration: d.value}.ParseDuration()
+			if err != nil {
+				return statusTokens{}, fail(d, "invalid duration, here are some examples: 15m, 1h30m, 2d, 1w")
+			}
+			status.timing = &rest[i-1]
+			status.durationToken = &rest[i]
+			status.duration = d.value
+
+		case t.kind == tokenWord && t.value == keywordUntil && i+1 < len(rest) && looksLikeEndTime(rest[i+1:]):
+			until, n := matchEndTimeTokens(rest[i+1:])
+			if n == 0 {
+				return statusTokens{}, fail(rest[i+1], "invalid end time, %s", endTimeExamples)
+			}
+			if status.durationToken != nil {
+				return statusTokens{}, fail(rest[i+1], "the duration was already set to %s", status.durationToken.raw)
+			}
+			status.timing = &rest[i]
+			status.durationToken = &rest[i+1]
+			status.until = until
+			i += n
+
+		default:
+			// Anything else is unquoted status text, including parentheses that aren't an emoji
+			if quotedToken != nil {
+				return statusTokens{}, fail(t, "the status text must either be all quoted or not quoted at all")
+			}
+			if status.textToken == nil {
+				status.textToken = &rest[i]
+			}
+			status.words = append(status.words, t)
+		}
+	}
+
+	if status.textToken != nil {
+		var words []string
+		for _, t := range status.words {
+			words = append(words, t.raw)
+		}
+		status.text = strings.Join(words, " ")
+	} else {
+		status.textToken = quotedToken
+	}
+	if status.textToken != nil {
+		if err := validateStatusText(status.text); err != nil {
+			return statusTokens{}, fail(*status.textToken, "%s", err)
+		}
+	}
+
+	return status, nil
+}
+
+// validateStatusText checks that Slack will accept the status text, and that
+// a template can be filled in.
+func validateStatusText(text string) error {
+	if n := utf8.RuneCountInString(text); n > maxStatusTextLength {
+		return errors.Errorf("the status text is %d characters but Slack only allows %d", n, maxStatusTextLength)
+	}
+	if isStatusTemplate(text) {
+		if _, err := parseStatusTemplate(text); err != nil {
+			return errors.Errorf("the status text isn't a valid template, %s", err)
+		}
+	}
+	return nil
+}
+
+// isEmoji determines if the text in parentheses is an emoji, either a Slack
+// emoji code like :boat: or unicode emoji. Otherwise it is part of the status text.
+func isEmoji(value string) bool {
+	if value == "" {
+		return false
+	}
+	if emojiCodePattern.MatchString(value) {
+		return true
+	}
+	for _, r := range value {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || unicode.IsPunct(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// looksLikeDuration determines if the word after "for" is meant to be a
+// duration, so that "out for lunch" is still read as status text.
+func looksLikeDuration(t token) bool {
+	if t.kind != tokenWord {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(t.value)
+	return unicode.IsDigit(r)
+}
+
+// matchEndTimeTokens finds the longest end time at the start of the tokens.
+func matchEndTimeTokens(tokens []token) (string, int) {
+	var words []string
+	for _, t := range tokens {
+		if t.kind != tokenWord || len(words) == maxEndTimeWords {
+			break
+		}
+		words = append(words, t.value)
+	}
+	return matchEndTime(words)
+}
+
+// looksLikeEndTime determines if the words after "until" are meant to be an
+// end time, so that "until further notice" is still read as status text.
+func looksLikeEndTime(tokens []token) bool {
+	if _, n := matchEndTimeTokens(tokens); n > 0 {
+		return true
+	}
+	return looksLikeDuration(tokens[0])
+}
+
+// formatStatusText quotes the status text when it would otherwise be parsed
+// differently, so that a trigger can be copied and created again.
+func formatStatusText(text string) string {
+	if text == "" {
+		return ""
+	}
+
+	needsQuotes := strings.ContainsAny(text, `"“=()`)
+	fields := strings.Fields(text)
+	for i, field := range fields {
+		switch field {
+		case keywordAway, keywordActive, keywordDnD, keywordNoDnD, keywordUntil, keywordThen:
+			needsQuotes = true
+		case keywordDuration:
+			if i+1 < len(fields) && looksLikeDuration(token{kind: tokenWord, value: fields[i+1]}) {
+				needsQuotes = true
+			}
+		}
+	}
+	if strings.Join(fields, " ") != text {
+		// Unquoted text doesn't preserve whitespace
+		needsQuotes = true
+	}
+
+	if !needsQuotes {
+		return text
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+}
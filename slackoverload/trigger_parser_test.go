@@ -0,0 +1,254 @@
+package slackoverload
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenizeTrigger(t *testing.T) {
+	testcases := []struct {
+		name string
+		def  string
+		want []token
+	}{
+		{
+			name: "words",
+			def:  "lunch=brb  omnomnom",
+			want: []token{
+				{kind: tokenWord, value: "lunch", raw: "lunch", pos: 1},
+				{kind: tokenEquals, value: "=", raw: "=", pos: 6},
+				{kind: tokenWord, value: "brb", raw: "brb", pos: 7},
+				{kind: tokenWord, value: "omnomnom", raw: "omnomnom", pos: 12},
+			},
+		},
+		{
+			name: "quotes",
+			def:  `x = "heads \"down\" = (focus)" DND`,
+			want: []token{
+				{kind: tokenWord, value: "x", raw: "x", pos: 1},
+				{kind: tokenEquals, value: "=", raw: "=", pos: 3},
+				{kind: tokenQuoted, value: `heads "down" = (focus)`, raw: `"heads \"down\" = (focus)"`, pos: 5},
+				{kind: tokenWord, value: "DND", raw: "DND", pos: 32},
+			},
+		},
+		{
+			name: "smart quotes",
+			def:  `x = “I'm on a "boat"”`,
+			want: []token{
+				{kind: tokenWord, value: "x", raw: "x", pos: 1},
+				{kind: tokenEquals, value: "=", raw: "=", pos: 3},
+				{kind: tokenQuoted, value: `I'm on a "boat"`, raw: `“I'm on a "boat"”`, pos: 5},
+			},
+		},
+		{
+			name: "nested parentheses",
+			def:  "x = (out (of) office) ( 🌴 )",
+			want: []token{
+				{kind: tokenWord, value: "x", raw: "x", pos: 1},
+				{kind: tokenEquals, value: "=", raw: "=", pos: 3},
+				{kind: tokenParens, value: "out (of) office", raw: "(out (of) office)", pos: 5},
+				{kind: tokenParens, value: "🌴", raw: "( 🌴 )", pos: 23},
+			},
+		},
+		{
+			name: "words end at punctuation",
+			def:  `brb(:x:)"a"`,
+			want: []token{
+				{kind: tokenWord, value: "brb", raw: "brb", pos: 1},
+				{kind: tokenParens, value: ":x:", raw: "(:x:)", pos: 4},
+				{kind: tokenQuoted, value: "a", raw: `"a"`, pos: 9},
+			},
+		},
+		{
+			name: "empty",
+			def:  "   ",
+			want: nil,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tokenizeTrigger(tc.def)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected %#v, got %#v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTokenizeTrigger_Invalid(t *testing.T) {
+	testcases := []struct {
+		def    string
+		token  string
+		pos    int
+		reason string
+	}{
+		{`x = "brb`, `"brb`, 5, "missing closing quote"},
+		{`x = “brb"`, `“brb"`, 5, "missing closing quote"},
+		{`x = brb (:x:`, "(:x:", 9, "missing closing parenthesis"},
+		{`x = ((:x:)`, "((:x:)", 5, "missing closing parenthesis"},
+	}
+
+	for _, tc := range testcases {
+		_, err := tokenizeTrigger(tc.def)
+		perr, ok := err.(TriggerParseError)
+		if !ok {
+			t.Errorf("%s: expected a TriggerParseError, got %#v", tc.def, err)
+			continue
+		}
+		if perr.Token != tc.token || perr.Position != tc.pos || perr.Reason != tc.reason {
+			t.Errorf("%s: expected %q at %d (%s), got %q at %d (%s)",
+				tc.def, tc.token, tc.pos, tc.reason, perr.Token, perr.Position, perr.Reason)
+		}
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	dnd := true
+	testcases := []struct {
+		def      string
+		settings Settings
+		want     ActionTemplate
+	}{
+		{
+			def:  `vacation = I'm on a boat! (:boat:) DND for 1w`,
+			want: ActionTemplate{Name: "vacation", Action: Action{Presence: PresenceAway, StatusText: "I'm on a boat!", StatusEmoji: ":boat:", DnD: true, Duration: "1w"}},
+		},
+		{
+			def:  `brb = (🚽)`,
+			want: ActionTemplate{Name: "brb", Action: Action{Presence: PresenceAway, StatusEmoji: "🚽"}},
+		},
+		{
+			def:  `focus=DND "heads down (really)" ACTIVE`,
+			want: ActionTemplate{Name: "focus", Action: Action{Presence: PresenceActive, StatusText: "heads down (really)", DnD: true}},
+		},
+		{
+			def:  `out = out for lunch (back soon)`,
+			want: ActionTemplate{Name: "out", Action: Action{Presence: PresenceAway, StatusText: "out for lunch (back soon)"}},
+		},
+		{
+			def:  `wait = until further notice NODND`,
+			want: ActionTemplate{Name: "wait", Action: Action{Presence: PresenceAway, StatusText: "until further notice"}},
+		},
+		{
+			def:  `q = “DND for 1h” (:x:)`,
+			want: ActionTemplate{Name: "q", Action: Action{Presence: PresenceAway, StatusText: "DND for 1h", StatusEmoji: ":x:"}},
+		},
+		{
+			def:  `away = "away from my desk" AWAY until 5pm`,
+			want: ActionTemplate{Name: "away", Action: Action{Presence: PresenceAway, StatusText: "away from my desk", Until: "5pm"}},
+		},
+		{
+			def:      `default = heads down`,
+			settings: Settings{DefaultDnD: &dnd, DefaultDuration: "2h"},
+			want:     ActionTemplate{Name: "default", Action: Action{Presence: PresenceAway, StatusText: "heads down", DnD: true, Duration: "2h"}},
+		},
+		{
+			def:      `nodnd = heads down NODND for 1h`,
+			settings: Settings{DefaultDnD: &dnd, DefaultDuration: "2h"},
+			want:     ActionTemplate{Name: "nodnd", Action: Action{Presence: PresenceAway, StatusText: "heads down", Duration: "1h"}},
+		},
+		{
+			def: `meeting = in a meeting {{.Arg 1}} for 30m then lunch for 1h then "back" ACTIVE`,
+			want: ActionTemplate{
+				Name:   "meeting",
+				Action: Action{Presence: PresenceAway, StatusText: "in a meeting {{.Arg 1}}", Duration: "30m"},
+				Steps: []TriggerStep{
+					{Trigger: "lunch", Action: Action{Duration: "1h"}},
+					{Action: Action{Presence: PresenceActive, StatusText: "back"}},
+				},
+			},
+		},
+		{
+			def:  `long = ` + strings.Repeat("x", maxStatusTextLength),
+			want: ActionTemplate{Name: "long", Action: Action{Presence: PresenceAway, StatusText: strings.Repeat("x", maxStatusTextLength)}},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.want.Name, func(t *testing.T) {
+			got, err := parseTemplate(tc.def, tc.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Fatalf("expected %#v, got %#v", tc.want, got)
+			}
+
+			again, err := parseTemplate(got.ToString(), Settings{})
+			if err != nil {
+				t.Fatalf("could not parse %q again: %v", got.ToString(), err)
+			}
+			if !reflect.DeepEqual(got, again) {
+				t.Fatalf("%q was parsed differently, expected %#v, got %#v", got.ToString(), got, again)
+			}
+		})
+	}
+}
+
+func TestParseTemplate_Invalid(t *testing.T) {
+	testcases := []struct {
+		def    string
+		token  string
+		pos    int
+		reason string
+	}{
+		{``, "", 0, "missing the trigger name"},
+		{`a b = c`, "b", 3, "expected = after the trigger name"},
+		{`lunch`, "lunch", 1, "expected = after the trigger name"},
+		{`"lunch" = brb`, `"lunch"`, 1, "the trigger name can only"},
+		{`lunch = a = b`, "=", 11, "only one = is allowed"},
+		{`lunch = brb AWAY ACTIVE`, "ACTIVE", 18, "the presence was already set to AWAY"},
+		{`lunch = brb DND NODND`, "NODND", 17, "Do Not Disturb was already set with DND"},
+		{`lunch = brb for 5x`, "5x", 17, "invalid duration"},
+		{`lunch = brb for 1h until 5pm`, "5pm", 26, "the duration was already set to 1h"},
+		{`lunch = "a" b`, "b", 13, "all quoted or not quoted"},
+		{`lunch = a "b"`, `"b"`, 11, "all quoted or not quoted"},
+		{`lunch = "a" "b"`, `"b"`, 13, "already set to \"a\""},
+		{`lunch = (:a:) (:b:)`, "(:b:)", 15, "the emoji was already set to (:a:)"},
+		{`lunch = brb then`, "then", 13, "missing the step after then"},
+		{`lunch = brb then afk`, "then", 13, "never ends"},
+		{`lunch = ` + strings.Repeat("x", maxStatusTextLength+1), strings.Repeat("x", maxStatusTextLength+1), 9, "101 characters"},
+		{`lunch = "` + strings.Repeat("é", maxStatusTextLength+1) + `"`, `"` + strings.Repeat("é", maxStatusTextLength+1) + `"`, 9, "101 characters"},
+		{`lunch = brb {{.Nope}}`, "brb", 9, "isn't a valid template"},
+	}
+
+	for _, tc := range testcases {
+		_, err := parseTemplate(tc.def, Settings{})
+		perr, ok := err.(TriggerParseError)
+		if !ok {
+			t.Errorf("%s: expected a TriggerParseError, got %#v", tc.def, err)
+			continue
+		}
+		if perr.Token != tc.token || perr.Position != tc.pos || !strings.Contains(perr.Reason, tc.reason) {
+			t.Errorf("%s: expected %q at %d (%s), got %q at %d (%s)",
+				tc.def, tc.token, tc.pos, tc.reason, perr.Token, perr.Position, perr.Reason)
+		}
+	}
+}
+
+func FuzzParseTemplate(f *testing.F) {
+	f.Add(`vacation = I'm on a boat! (:boat:) DND for 1w`)
+	f.Add(`focus=DND "heads \"down\" (really)" ACTIVE until tomorrow 9am`)
+	f.Add(`q = “smart” (( nested )) for lunch`)
+	f.Add(`meeting = in a meeting {{.Arg 1}} for 30m then lunch for 1h then "back"`)
+	f.Add(`clear = brb for 1h then ""`)
+	f.Fuzz(func(t *testing.T, def string) {
+		tmpl, err := parseTemplate(def, Settings{})
+		if err != nil {
+			return
+		}
+
+		again, err := parseTemplate(tmpl.ToString(), Settings{})
+		if err != nil {
+			t.Fatalf("%q was formatted as %q, which is invalid: %v", def, tmpl.ToString(), err)
+		}
+		if !reflect.DeepEqual(tmpl, again) {
+			t.Fatalf("%q was formatted as %q, which parses differently: expected %#v, got %#v", def, tmpl.ToString(), tmpl, again)
+		}
+	})
+}
@@ -0,0 +1,168 @@
+package slackoverload
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nlopes/slack"
+)
+
+// maxTriggerSuggestions is how many similar triggers are suggested when a
+// trigger isn't found.
+const maxTriggerSuggestions = 3
+
+// suggestTriggers replies to a command for a trigger that doesn't exist with
+// the user's triggers that have a similar name, and a button to run the
+// command again with each suggestion. The text is the text of the command,
+// starting with the trigger name. When nothing is similar, notFound is returned.
+func (a *App) suggestTriggers(userId string, teamId string, text string, actionId string, notFound error) (slack.Msg, error) {
+	name, args := splitCommand(text)
+
+	triggers, err := a.listTriggers(userId, teamId, false)
+	if err != nil {
+		return slack.Msg{}, err
+	}
+	var names []string
+	for _, trigger := range triggers {
+		names = append(names, trigger.Name)
+	}
+
+	suggestions, prefixMatch := rankTriggerSuggestions(name, names)
+	if len(suggestions) == 0 {
+		return slack.Msg{}, notFound
+	}
+
+	labels := map[string]string{
+		triggerActionRun:    "Trigger",
+		triggerActionEdit:   "Edit",
+		triggerActionDelete: "Delete",
+	}
+	var buttons []slack.BlockElement
+	for _, suggestion := range suggestions {
+		value := strings.TrimSpace(suggestion + " " + args)
+		label := fmt.Sprintf("%s %s", labels[actionId], suggestion)
+		buttons = append(buttons, triggerButton(actionId, label, suggestion, value))
+	}
+
+	var question string
+	if prefixMatch {
+		question = fmt.Sprintf("You don't have a trigger named *%s*, but you do have *%s*. %s it instead?",
+			name, suggestions[0], labels[actionId])
+	} else {
+		var quoted []string
+		for _, suggestion := range suggestions {
+			quoted = append(quoted, fmt.Sprintf("*%s*", suggestion))
+		}
+		question = fmt.Sprintf("You don't have a trigger named *%s*. Did you mean %s?",
+			name, strings.Join(quoted, " or "))
+	}
+
+	msg := slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			markdownSection(question),
+			slack.NewActionBlock("suggestions", buttons...),
+		}},
+	}
+	return msg, nil
+}
+
+// rankTriggerSuggestions finds the names that are most like the name that was
+// typed, closest first. When exactly one name starts with what was typed, it
+// is the only suggestion and prefixMatch is true.
+func rankTriggerSuggestions(name string, names []string) (suggestions []string, prefixMatch bool) {
+	typed := strings.ToLower(name)
+	if typed == "" {
+		return nil, false
+	}
+
+	type candidate struct {
+		name     string
+		prefix   bool
+		distance int
+	}
+
+	var prefixes []string
+	var candidates []candidate
+	maxDistance := utf8.RuneCountInString(typed) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	for _, n := range names {
+		lower := strings.ToLower(n)
+		if strings.HasPrefix(lower, typed) {
+			prefixes = append(prefixes, n)
+			candidates = append(candidates, candidate{name: n, prefix: true})
+			continue
+		}
+
+		if d := editDistance(typed, lower); d <= maxDistance {
+			candidates = append(candidates, candidate{name: n, distance: d})
+		}
+	}
+
+	if len(prefixes) == 1 {
+		return prefixes, true
+	}
+
+	// Names that start with what was typed first, then the closest names
+	sort.Slice(candidates, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		if ci.prefix != cj.prefix {
+			return ci.prefix
+		}
+		if ci.distance != cj.distance {
+			return ci.distance < cj.distance
+		}
+		return ci.name < cj.name
+	})
+
+	for i, c := range candidates {
+		if i == maxTriggerSuggestions {
+			break
+		}
+		suggestions = append(suggestions, c.name)
+	}
+	return suggestions, false
+}
+
+// editDistance counts the characters that must be inserted, deleted, replaced
+// or swapped with their neighbor to turn a into b, so that lucnh is one
+// change away from lunch.
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	// d[i][j] is the distance between the first i runes of a and the first j runes of b
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
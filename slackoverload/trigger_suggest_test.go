@@ -0,0 +1,87 @@
+package slackoverload
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRankTriggerSuggestions(t *testing.T) {
+	names := []string{"lunch", "lunch-long", "launch", "leave", "sick", "vacation"}
+
+	testcases := []struct {
+		name        string
+		typed       string
+		want        []string
+		prefixMatch bool
+	}{
+		{name: "transposition", typed: "lucnh", want: []string{"lunch"}},
+		{name: "one prefix", typed: "vac", want: []string{"vacation"}, prefixMatch: true},
+		{name: "several prefixes", typed: "lunc", want: []string{"lunch", "lunch-long"}},
+		{name: "at most 3", typed: "l", want: []string{"launch", "leave", "lunch"}},
+		{name: "prefixes before close names", typed: "lunch", want: []string{"lunch", "lunch-long", "launch"}},
+		{name: "case insensitive", typed: "LUNCH!", want: []string{"lunch", "launch"}},
+		{name: "short name", typed: "sik", want: []string{"sick"}},
+		{name: "within a third of the length", typed: "vaxxtion", want: []string{"vacation"}},
+		{name: "more than a third of the length", typed: "vxxxtion"},
+		{name: "nothing close", typed: "zzzzzz"},
+		{name: "empty name"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, prefixMatch := rankTriggerSuggestions(tc.typed, names)
+			if !reflect.DeepEqual(tc.want, got) || tc.prefixMatch != prefixMatch {
+				t.Fatalf("expected %v (prefix match %t), got %v (prefix match %t)", tc.want, tc.prefixMatch, got, prefixMatch)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	testcases := []struct {
+		a, b string
+		want int
+	}{
+		{"lunch", "lunch", 0},
+		{"", "lunch", 5},
+		{"lunch", "", 5},
+		{"lucnh", "lunch", 1},
+		{"ab", "ba", 1},
+		{"lunch", "lunches", 2},
+		{"kitten", "sitting", 3},
+		{"café", "cafe", 1},
+	}
+
+	for _, tc := range testcases {
+		if got := editDistance(tc.a, tc.b); got != tc.want {
+			t.Errorf("expected the distance from %q to %q to be %d, got %d", tc.a, tc.b, tc.want, got)
+		}
+	}
+}
+
+func TestSuggestTriggers(t *testing.T) {
+	a := &App{Storage: NewMemoryStorage()}
+	if err := a.createTrigger("u1", ActionTemplate{Name: "lunch", Global: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := a.suggestTriggers("u1", "T1", "lucnh for 1h", triggerActionRun, TriggerNotFoundError{Name: "lucnh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"value":"lunch for 1h"`) || !strings.Contains(string(b), "Did you mean *lunch*") {
+		t.Fatalf("expected to suggest lunch and keep the overrides, got %s", b)
+	}
+
+	notFound := TriggerNotFoundError{Name: "zzzz"}
+	_, err = a.suggestTriggers("u1", "T1", "zzzz", triggerActionRun, notFound)
+	if err != notFound {
+		t.Fatalf("expected the original error when nothing is close, got %v", err)
+	}
+}
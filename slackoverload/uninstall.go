@@ -0,0 +1,115 @@
+package slackoverload
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// AppUninstalled forgets the tokens and linked Slack accounts for a workspace
+// after the app is removed from it. Slack has already revoked the tokens.
+// Triggers and schedules are kept, in case the app is installed again.
+func (a *App) AppUninstalled(teamId string) error {
+	fmt.Printf("%s app uninstalled from %s\n", now(), teamId)
+
+	err := a.revokeBotToken(teamId)
+	if err != nil {
+		return err
+	}
+
+	slackIds, err := a.listSlackIdsForTeam(teamId)
+	if err != nil {
+		return err
+	}
+
+	for _, slackId := range slackIds {
+		err = a.unlinkSlackUser(slackId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TokensRevoked forgets the tokens that were revoked on a workspace, and
+// unlinks the Slack accounts of the users who revoked their tokens.
+func (a *App) TokensRevoked(teamId string, e TokensRevokedEvent) error {
+	fmt.Printf("%s tokens revoked on %s for %d users and %d bots\n",
+		now(), teamId, len(e.Tokens.OAuth), len(e.Tokens.Bot))
+
+	for _, slackId := range e.Tokens.OAuth {
+		err := a.unlinkSlackUser(slackId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(e.Tokens.Bot) > 0 {
+		return a.revokeBotToken(teamId)
+	}
+
+	return nil
+}
+
+// unlinkSlackUser removes a Slack account from the user that it was linked to,
+// and forgets its token.
+func (a *App) unlinkSlackUser(slackId string) error {
+	id, err := a.getIdentity(slackId)
+	if err != nil {
+		if IsNotFound(err) {
+			// The account was never linked, or was already unlinked
+			return nil
+		}
+		return err
+	}
+
+	fmt.Printf("%s unlinking %s from %s on %s(%s)\n", now(), slackId, id.UserId, id.TeamName, id.TeamId)
+
+	err = a.revokeSlackToken(slackId)
+	if err != nil {
+		return errors.Wrapf(err, "error removing oauth token for %s", slackId)
+	}
+
+	err = a.cancelRevert(id.UserId, id.TeamId)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.updateCurrentUser(id.UserId, func(user *User) {
+		user.RemoveSlackUser(slackId)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error removing user mapping for %s -> %s", id.UserId, slackId)
+	}
+
+	err = a.Storage.DeleteBlob("identities", slackId)
+	if err != nil && !IsNotFound(err) {
+		return errors.Wrapf(err, "error removing identity for %s", slackId)
+	}
+	return nil
+}
+
+// listSlackIdsForTeam returns the Slack accounts linked on a workspace.
+func (a *App) listSlackIdsForTeam(teamId string) ([]string, error) {
+	slackIds, err := a.Storage.ListContainer("identities", "")
+	if err != nil {
+		return nil, err
+	}
+
+	var results []string
+	for _, slackId := range slackIds {
+		id, err := a.getIdentity(slackId)
+		if err != nil {
+			if IsNotFound(err) {
+				// Unlinked while we were listing
+				continue
+			}
+			return nil, err
+		}
+		if id.TeamId == teamId {
+			results = append(results, slackId)
+		}
+	}
+	return results, nil
+}
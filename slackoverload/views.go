@@ -0,0 +1,230 @@
+package slackoverload
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+// The version of the slack library that we use doesn't support views (modals
+// and the App Home), so these types fill in what is missing.
+
+// SlackAPIURL is the base URL for calling Slack Web API methods.
+const SlackAPIURL = "https://slack.com/api/"
+
+const (
+	ViewTypeModal = "modal"
+	ViewTypeHome  = "home"
+
+	MBTInput slack.MessageBlockType = "input"
+
+	METPlainTextInput slack.MessageElementType = "plain_text_input"
+	METStaticSelect   slack.MessageElementType = "static_select"
+
+	InteractionTypeViewSubmission = slack.InteractionType("view_submission")
+	InteractionTypeViewClosed     = slack.InteractionType("view_closed")
+)
+
+// View is a modal or App Home surface.
+// https://api.slack.com/reference/surfaces/views
+type View struct {
+	Type            string                 `json:"type"`
+	CallbackID      string                 `json:"callback_id,omitempty"`
+	PrivateMetadata string                 `json:"private_metadata,omitempty"`
+	Title           *slack.TextBlockObject `json:"title,omitempty"`
+	Submit          *slack.TextBlockObject `json:"submit,omitempty"`
+	Close           *slack.TextBlockObject `json:"close,omitempty"`
+	Blocks          slack.Blocks           `json:"blocks"`
+}
+
+// InputBlock collects information from a user in a modal.
+type InputBlock struct {
+	Type     slack.MessageBlockType `json:"type"`
+	BlockID  string                 `json:"block_id"`
+	Label    *slack.TextBlockObject `json:"label"`
+	Element  slack.BlockElement     `json:"element"`
+	Hint     *slack.TextBlockObject `json:"hint,omitempty"`
+	Optional bool                   `json:"optional,omitempty"`
+}
+
+func (b InputBlock) BlockType() slack.MessageBlockType {
+	return b.Type
+}
+
+// PlainTextInputElement is a text field.
+type PlainTextInputElement struct {
+	Type         slack.MessageElementType `json:"type"`
+	ActionID     string                   `json:"action_id"`
+	Placeholder  *slack.TextBlockObject   `json:"placeholder,omitempty"`
+	InitialValue string                   `json:"initial_value,omitempty"`
+	MaxLength    int                      `json:"max_length,omitempty"`
+	Multiline    bool                     `json:"multiline,omitempty"`
+}
+
+func (e PlainTextInputElement) ElementType() slack.MessageElementType {
+	return e.Type
+}
+
+// StaticSelectElement is a drop down with a fixed list of options.
+type StaticSelectElement struct {
+	Type          slack.MessageElementType `json:"type"`
+	ActionID      string                   `json:"action_id"`
+	Placeholder   *slack.TextBlockObject   `json:"placeholder,omitempty"`
+	Options       []SelectOption           `json:"options"`
+	InitialOption *SelectOption            `json:"initial_option,omitempty"`
+}
+
+func (e StaticSelectElement) ElementType() slack.MessageElementType {
+	return e.Type
+}
+
+// SelectOption is a choice in a StaticSelectElement.
+type SelectOption struct {
+	Text  *slack.TextBlockObject `json:"text"`
+	Value string                 `json:"value"`
+}
+
+// ViewState holds the values that the user entered into the modal,
+// indexed by block id and then action id.
+type ViewState struct {
+	Values map[string]map[string]ViewStateValue `json:"values"`
+}
+
+type ViewStateValue struct {
+	Type           string        `json:"type"`
+	Value          string        `json:"value"`
+	SelectedOption *SelectOption `json:"selected_option"`
+}
+
+// Get returns the value entered in a text field or the selected option,
+// trimmed of whitespace.
+func (s ViewState) Get(blockId string, actionId string) string {
+	v, ok := s.Values[blockId][actionId]
+	if !ok {
+		return ""
+	}
+	if v.SelectedOption != nil {
+		return v.SelectedOption.Value
+	}
+	return strings.TrimSpace(v.Value)
+}
+
+// SubmittedView is a view as it is sent to us in an interaction.
+type SubmittedView struct {
+	ID              string    `json:"id"`
+	Type            string    `json:"type"`
+	CallbackID      string    `json:"callback_id"`
+	PrivateMetadata string    `json:"private_metadata"`
+	State           ViewState `json:"state"`
+}
+
+// InteractionPayload is sent to the interactivity endpoint when a user
+// interacts with a message or view.
+type InteractionPayload struct {
+	slack.InteractionCallback
+	View SubmittedView `json:"view"`
+}
+
+// ViewSubmissionResponse tells Slack what to do with the modal after it
+// is submitted, for example showing validation errors next to the fields.
+type ViewSubmissionResponse struct {
+	ResponseAction string            `json:"response_action"`
+	Errors         map[string]string `json:"errors,omitempty"`
+
+	// View replaces the modal when the response action is update.
+	View *View `json:"view,omitempty"`
+}
+
+// NewViewErrors builds a response that shows errors next to the fields, by block id.
+func NewViewErrors(errs map[string]string) *ViewSubmissionResponse {
+	return &ViewSubmissionResponse{
+		ResponseAction: "errors",
+		Errors:         errs,
+	}
+}
+
+// NewViewUpdate builds a response that replaces the modal with another view.
+func NewViewUpdate(view View) *ViewSubmissionResponse {
+	return &ViewSubmissionResponse{
+		ResponseAction: "update",
+		View:           &view,
+	}
+}
+
+// openView shows a modal to the user that triggered an interaction.
+func openView(token string, triggerId string, view View) error {
+	request := struct {
+		TriggerID string `json:"trigger_id"`
+		View      View   `json:"view"`
+	}{triggerId, view}
+
+	return callSlackAPI(token, "views.open", request)
+}
+
+// publishView shows a view, such as the App Home, to a user.
+func publishView(token string, slackId string, view View) error {
+	request := struct {
+		UserID string `json:"user_id"`
+		View   View   `json:"view"`
+	}{slackId, view}
+
+	return callSlackAPI(token, "views.publish", request)
+}
+
+// callSlackAPI calls a Slack Web API method that accepts JSON.
+func callSlackAPI(token string, method string, body interface{}) error {
+	return callSlackAPIAt(SlackAPIURL, token, method, body, nil)
+}
+
+// callSlackAPIAt calls a Slack Web API method at a base URL, unmarshaling the
+// response into result when it isn't nil.
+func callSlackAPIAt(apiURL string, token string, method string, body interface{}, result interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling %s request", method)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, apiURL+method, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrapf(err, "error building %s request", method)
+	}
+	request.Header.Set("Content-Type", "application/json; charset=utf-8")
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "error calling %s", method)
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return errors.Wrapf(err, "error reading %s response", method)
+	}
+
+	var status struct {
+		Ok               bool   `json:"ok"`
+		Error            string `json:"error"`
+		ResponseMetadata struct {
+			Messages []string `json:"messages"`
+		} `json:"response_metadata"`
+	}
+	err = json.Unmarshal(data, &status)
+	if err != nil {
+		return errors.Wrapf(err, "error unmarshaling %s response", method)
+	}
+	if !status.Ok {
+		return errors.Errorf("%s failed: %s %s", method, status.Error, strings.Join(status.ResponseMetadata.Messages, ", "))
+	}
+
+	if result != nil {
+		err = json.Unmarshal(data, result)
+		return errors.Wrapf(err, "error unmarshaling %s response", method)
+	}
+	return nil
+}
@@ -1,12 +1,15 @@
 package slackoverload
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/nlopes/slack"
 	"github.com/pkg/errors"
@@ -16,27 +19,43 @@ type SlackHandler struct {
 	SessionStore
 	App
 
+	// EventWorkers is how many events from the Events API are handled at the same time.
+	EventWorkers int
+
+	// SocketMode receives commands, interactions and events from Slack over a
+	// websocket, so that Slack doesn't need to reach our HTTP endpoints.
+	SocketMode bool
+
 	signingSecret string
+	events        *EventDispatcher
+	socketMode    *SocketModeClient
 }
 
 func (h *SlackHandler) Init() error {
 	fmt.Println("Initializing...")
 
 	http.HandleFunc("/health", h.HandleHealth)
+	if h.Debug {
+		http.HandleFunc("/cache-stats", h.HandleCacheStats)
+	}
 	http.HandleFunc("/oauth", h.HandleOAuth)
-	http.HandleFunc("/link-slack", h.HandleLinkSlack)
-	http.HandleFunc("/list-triggers", h.HandleListTriggers)
-	http.HandleFunc("/trigger", h.HandleTrigger)
-	http.HandleFunc("/create-trigger", h.HandleCreateTrigger)
-	http.HandleFunc("/delete-trigger", h.HandleDeleteTrigger)
-	http.HandleFunc("/clear-status", h.HandleClearStatus)
+	http.HandleFunc("/overload", h.HandleOverload)
+	http.HandleFunc("/interactive", h.HandleInteractive)
+	http.HandleFunc("/events", h.HandleEvents)
+	http.HandleFunc("/export", h.HandleExport)
+	http.HandleFunc("/import", h.HandleImport)
+	for _, cmd := range overloadCommands.Commands() {
+		if cmd.Alias != "" {
+			http.HandleFunc(cmd.Alias, h.HandleCommand(cmd))
+		}
+	}
 
-	secrets, err := NewSecretsClient()
+	secrets, err := NewSecrets(h.SecretsBackend, h.SecretsDir)
 	if err != nil {
 		return err
 	}
 
-	h.signingSecret, err = secrets.GetSlackSigningSecret()
+	h.signingSecret, err = GetSlackSigningSecret(secrets)
 	if err != nil {
 		return err
 	}
@@ -46,10 +65,31 @@ func (h *SlackHandler) Init() error {
 		return err
 	}
 
-	return h.App.Init(secrets)
+	err = h.App.Init(secrets)
+	if err != nil {
+		return err
+	}
+
+	h.events = NewEventDispatcher(&h.App, eventHandlers, h.EventWorkers)
+
+	if h.SocketMode {
+		appToken, err := GetSlackAppToken(secrets)
+		if err != nil {
+			return errors.Wrap(err, "Socket Mode requires the slack-app-token secret")
+		}
+		h.socketMode = NewSocketModeClient(h, appToken)
+	}
+
+	return nil
 }
 
 func (h *SlackHandler) Run() error {
+	go h.RunScheduler()
+
+	if h.socketMode != nil {
+		go h.socketMode.Run()
+	}
+
 	fmt.Println("Ready!")
 	return http.ListenAndServe(":80", nil)
 }
@@ -58,20 +98,15 @@ func (h *SlackHandler) HandleHealth(writer http.ResponseWriter, request *http.Re
 	writer.WriteHeader(200)
 }
 
-func (h *SlackHandler) HandleLinkSlack(writer http.ResponseWriter, request *http.Request) {
-	payload, err := h.getSlackPayload(writer, request)
+func (h *SlackHandler) HandleCacheStats(writer http.ResponseWriter, request *http.Request) {
+	b, err := json.Marshal(h.CacheStats())
 	if err != nil {
-		h.ReturnError(writer, err)
-		return
-	}
-
-	msg, err := h.LinkSlack(payload)
-	if err != nil {
-		h.ReturnError(writer, err)
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	h.ReturnResponse(writer, msg)
+	writer.Header().Set("Content-type", "application/json")
+	writer.Write(b)
 }
 
 func (h *SlackHandler) HandleOAuth(writer http.ResponseWriter, request *http.Request) {
@@ -105,95 +140,322 @@ func (h *SlackHandler) HandleOAuth(writer http.ResponseWriter, request *http.Req
 	http.Redirect(writer, request, "https://slackoverload.com/quickstart", 302)
 }
 
-func (h *SlackHandler) HandleListTriggers(writer http.ResponseWriter, request *http.Request) {
+func (h *SlackHandler) HandleOverload(writer http.ResponseWriter, request *http.Request) {
 	payload, err := h.getSlackPayload(writer, request)
 	if err != nil {
 		h.ReturnError(writer, err)
 		return
 	}
 
-	r := ListTriggersRequest{SlackPayload: payload}
-	response, err := h.ListTriggers(r)
+	r := OverloadRequest{SlackPayload: payload}
+	msg, err := h.Overload(r)
 	if err != nil {
 		h.ReturnError(writer, err)
 		return
 	}
 
-	h.ReturnResponse(writer, response)
+	h.ReturnResponse(writer, msg)
 }
 
-func (h *SlackHandler) HandleTrigger(writer http.ResponseWriter, request *http.Request) {
-	payload, err := h.getSlackPayload(writer, request)
+// HandleCommand handles a standalone slash command, such as /trigger, that is
+// an alias for an /overload subcommand.
+func (h *SlackHandler) HandleCommand(cmd Command) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		payload, err := h.getSlackPayload(writer, request)
+		if err != nil {
+			h.ReturnError(writer, err)
+			return
+		}
+
+		msg, err := cmd.Run(&h.App, payload)
+		if err != nil {
+			h.ReturnError(writer, err)
+			return
+		}
+
+		h.ReturnResponse(writer, msg)
+	}
+}
+
+// HandleInteractive receives interactions with our modals and messages.
+func (h *SlackHandler) HandleInteractive(writer http.ResponseWriter, request *http.Request) {
+	payload, err := h.getInteractionPayload(writer, request)
 	if err != nil {
-		h.ReturnError(writer, err)
+		log.Printf("%v\n", err)
 		return
 	}
 
-	r := TriggerRequest{SlackPayload: payload}
-	msg, err := h.Trigger(r)
+	switch payload.Type {
+	case InteractionTypeViewSubmission:
+		response, err := h.SubmitView(payload)
+		if err != nil {
+			log.Printf("%v\n", err)
+			http.Error(writer, "an error occurred", http.StatusInternalServerError)
+			return
+		}
+		h.ReturnViewSubmissionResponse(writer, response)
+	case slack.InteractionTypeBlockActions:
+		// Acknowledge the click right away, and then reply to the message
+		// once the action is done, since it may take longer than Slack waits
+		writer.WriteHeader(200)
+		go h.HandleBlockAction(payload)
+	default:
+		// Acknowledge everything else so that Slack doesn't show an error
+		writer.WriteHeader(200)
+	}
+}
+
+// SubmitView saves a submitted modal, finding what to do based on its callback id.
+func (h *SlackHandler) SubmitView(payload InteractionPayload) (*ViewSubmissionResponse, error) {
+	switch payload.View.CallbackID {
+	case triggerEditorCallbackId:
+		return h.SubmitTriggerEditor(payload)
+	case importTriggersCallbackId:
+		return h.SubmitImportTriggers(payload)
+	default:
+		return nil, errors.Errorf("unexpected view submission %q", payload.View.CallbackID)
+	}
+}
+
+// HandleBlockAction runs a button clicked in a message, replacing the message
+// with the result.
+func (h *SlackHandler) HandleBlockAction(payload InteractionPayload) {
+	msg, err := h.RunBlockAction(payload)
 	if err != nil {
-		h.ReturnError(writer, err)
+		log.Printf("%v\n", err)
+		msg = slack.Msg{Text: err.Error()}
+	} else if isEmptyMessage(msg) {
+		// Nothing to say, for example when we opened a modal instead
 		return
 	}
 
-	h.ReturnResponse(writer, msg)
+	if payload.View.Type == ViewTypeHome {
+		// Buttons in the App Home don't have a message to reply to, show the
+		// change in the App Home instead
+		if err != nil {
+			return
+		}
+		err = h.PublishHome(payload.User.ID, payload.Team.ID)
+		if err != nil {
+			log.Printf("%v\n", err)
+		}
+		return
+	}
+
+	msg.ResponseType = slack.ResponseTypeEphemeral
+	msg.ReplaceOriginal = true
+	err = h.SendResponse(payload.ResponseURL, msg)
+	if err != nil {
+		log.Printf("%v\n", err)
+	}
 }
 
-func (h *SlackHandler) HandleCreateTrigger(writer http.ResponseWriter, request *http.Request) {
-	payload, err := h.getSlackPayload(writer, request)
+// SendResponse sends a message to the response_url of a command or interaction.
+func (h *SlackHandler) SendResponse(responseURL string, msg slack.Msg) error {
+	if h.Debug {
+		log.Printf("%s\n", msg.Text)
+	}
+
+	b, err := json.Marshal(msg)
 	if err != nil {
-		h.ReturnError(writer, err)
-		return
+		return errors.Wrapf(err, "error marshaling message to send to Slack, %#v", msg)
 	}
 
-	r := CreateTriggerRequest{SlackPayload: payload}
-	response, err := h.CreateTrigger(r)
+	response, err := http.Post(responseURL, "application/json", bytes.NewReader(b))
 	if err != nil {
-		h.ReturnError(writer, err)
+		return errors.Wrap(err, "error sending message to Slack")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return errors.Errorf("error sending message to Slack: %s", response.Status)
+	}
+	return nil
+}
+
+// HandleEvents receives events that we subscribed to from the Events API.
+// Events are acknowledged right away and then handled in the background,
+// since Slack only waits 3 seconds before trying again.
+func (h *SlackHandler) HandleEvents(writer http.ResponseWriter, request *http.Request) {
+	envelope, err := h.getEventEnvelope(writer, request)
+	if err != nil {
+		log.Printf("%v\n", err)
 		return
 	}
 
-	h.ReturnResponse(writer, response)
+	switch envelope.Type {
+	case EventTypeURLVerification:
+		writer.Header().Set("Content-type", "text/plain")
+		writer.WriteHeader(200)
+		writer.Write([]byte(envelope.Challenge))
+	case EventTypeEventCallback:
+		event, err := NewEvent(envelope)
+		if err != nil {
+			log.Printf("%v\n", err)
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		retryNum, _ := strconv.Atoi(request.Header.Get("X-Slack-Retry-Num"))
+		err = h.events.Dispatch(event, retryNum)
+		if err != nil {
+			log.Printf("%v\n", err)
+			http.Error(writer, "try again later", http.StatusServiceUnavailable)
+			return
+		}
+		writer.WriteHeader(200)
+	default:
+		writer.WriteHeader(200)
+	}
 }
 
-func (h *SlackHandler) HandleDeleteTrigger(writer http.ResponseWriter, request *http.Request) {
-	payload, err := h.getSlackPayload(writer, request)
+// HandleExport downloads the triggers and schedules for the user in the
+// link from /export-triggers.
+func (h *SlackHandler) HandleExport(writer http.ResponseWriter, request *http.Request) {
+	t, err := h.readTransferToken(transferExport, request.FormValue("token"))
 	if err != nil {
-		h.ReturnError(writer, err)
+		http.Error(writer, err.Error(), http.StatusForbidden)
 		return
 	}
 
-	r := DeleteTriggerRequest{SlackPayload: payload}
-	response, err := h.DeleteTrigger(r)
+	doc, err := h.exportTriggers(t.UserId)
 	if err != nil {
-		h.ReturnError(writer, err)
+		log.Printf("%v\n", err)
+		http.Error(writer, "an error occurred", http.StatusInternalServerError)
 		return
 	}
 
-	h.ReturnResponse(writer, response)
+	format := FormatJSON
+	contentType := "application/json"
+	if request.FormValue("format") == FormatYAML {
+		format = FormatYAML
+		contentType = "application/x-yaml"
+	}
+
+	b, err := marshalTriggerDocument(doc, format)
+	if err != nil {
+		log.Printf("%v\n", errors.Wrapf(err, "error marshaling triggers for %s", t.UserId))
+		http.Error(writer, "an error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-type", contentType)
+	writer.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="slackoverload-triggers.%s"`, format))
+	writer.WriteHeader(200)
+	writer.Write(b)
 }
 
-func (h *SlackHandler) HandleClearStatus(writer http.ResponseWriter, request *http.Request) {
-	payload, err := h.getSlackPayload(writer, request)
+// importPage is the form to upload a file from /export-triggers.
+var importPage = template.Must(template.New("import").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Import Triggers - Slack Overload</title></head>
+<body>
+<h1>Import Triggers</h1>
+{{if .Result}}<pre>{{.Result}}</pre>{{end}}
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+<form method="post" enctype="multipart/form-data">
+<input type="hidden" name="token" value="{{.Token}}">
+<p><input type="file" name="document" accept=".json,.yaml,.yml,application/json,application/x-yaml"></p>
+<p>
+<label><input type="radio" name="mode" value="merge" checked> Keep my existing triggers</label><br>
+<label><input type="radio" name="mode" value="replace"> Replace my existing triggers</label>
+</p>
+<p><button type="submit">Import</button></p>
+</form>
+</body>
+</html>
+`))
+
+// HandleImport shows a form to upload a file from /export-triggers, for the
+// user in the link from /import-triggers, and imports the uploaded file.
+func (h *SlackHandler) HandleImport(writer http.ResponseWriter, request *http.Request) {
+	// Leave room for the rest of the form around the file
+	request.Body = http.MaxBytesReader(writer, request.Body, maxImportDocumentSize+64<<10)
+
+	token := request.FormValue("token")
+	t, err := h.readTransferToken(transferImport, token)
 	if err != nil {
-		h.ReturnError(writer, err)
+		http.Error(writer, err.Error(), http.StatusForbidden)
 		return
 	}
 
-	r := ClearStatusRequest{SlackPayload: payload}
-	msg, err := h.ClearStatus(r)
+	page := struct {
+		Token  string
+		Result string
+		Error  string
+	}{Token: token}
+
+	if request.Method == http.MethodPost {
+		result, err := h.importUpload(t, request)
+		if err != nil {
+			log.Printf("%v\n", err)
+			page.Error = err.Error()
+		} else {
+			page.Result = result.ToString()
+		}
+	}
+
+	writer.Header().Set("Content-type", "text/html; charset=utf-8")
+	err = importPage.Execute(writer, page)
 	if err != nil {
-		h.ReturnError(writer, err)
+		log.Printf("%v\n", errors.Wrap(err, "error rendering the import page"))
+	}
+}
+
+func (h *SlackHandler) importUpload(t transferToken, request *http.Request) (ImportResult, error) {
+	file, _, err := request.FormFile("document")
+	if err != nil {
+		return ImportResult{}, errors.New("Choose the file from /export-triggers to import")
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(file, maxImportDocumentSize+1))
+	if err != nil {
+		return ImportResult{}, errors.Wrap(err, "could not read the uploaded file")
+	}
+	if len(data) > maxImportDocumentSize {
+		return ImportResult{}, errors.Errorf("The file is larger than %dMB", maxImportDocumentSize>>20)
+	}
+
+	doc, err := parseTriggerDocument(data)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	return h.importTriggers(t, doc, request.FormValue("mode"))
+}
+
+func (h *SlackHandler) ReturnViewSubmissionResponse(writer http.ResponseWriter, response *ViewSubmissionResponse) {
+	if response == nil {
+		// An empty response closes the modal
+		writer.WriteHeader(200)
 		return
 	}
 
-	h.ReturnResponse(writer, msg)
+	b, err := json.Marshal(response)
+	if err != nil {
+		err = errors.Wrapf(err, "error marshaling view submission response, %#v", response)
+		log.Printf("%v\n", err)
+		http.Error(writer, "an error occurred", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-type", "application/json")
+	writer.WriteHeader(200)
+	writer.Write(b)
 }
 
 func (h *SlackHandler) ReturnResponse(writer http.ResponseWriter, msg slack.Msg) {
 	if h.Debug {
 		log.Printf("%s\n", msg.Text)
 	}
+
+	if isEmptyMessage(msg) {
+		// Nothing to say, for example when we opened a modal instead
+		writer.WriteHeader(200)
+		return
+	}
+
 	writer.Header().Set("Content-type", "application/json")
 	writer.WriteHeader(200)
 	b, err := json.Marshal(msg)
@@ -221,12 +483,20 @@ func (h *SlackHandler) ReturnError(writer http.ResponseWriter, err error) {
 }
 
 func (h *SlackHandler) buildSlackError(err error) ([]byte, error) {
-	response := slack.Msg{
+	return json.Marshal(errorMessage(err))
+}
+
+// isEmptyMessage checks if there is nothing to reply with, for example when
+// we opened a modal instead.
+func isEmptyMessage(msg slack.Msg) bool {
+	return msg.Text == "" && len(msg.Blocks.BlockSet) == 0 && len(msg.Attachments) == 0
+}
+
+func errorMessage(err error) slack.Msg {
+	return slack.Msg{
 		Text:         err.Error(),
 		ResponseType: slack.ResponseTypeEphemeral,
 	}
-
-	return json.Marshal(response)
 }
 
 func (h *SlackHandler) getSlackPayload(writer http.ResponseWriter, request *http.Request) (SlackPayload, error) {
@@ -246,11 +516,74 @@ func (h *SlackHandler) getSlackPayload(writer http.ResponseWriter, request *http
 		return SlackPayload{}, errors.New("Unauthorized message sent to SlackOverload. Rejected.")
 	}
 
+	return newSlackPayload(s), nil
+}
+
+func newSlackPayload(s slack.SlashCommand) SlackPayload {
 	return SlackPayload{
-		SlackId:  s.UserID,
-		UserName: s.UserName,
-		TeamId:   s.TeamID,
-		TeamName: s.TeamDomain,
-		Text:     s.Text,
-	}, nil
+		SlackId:     s.UserID,
+		UserName:    s.UserName,
+		TeamId:      s.TeamID,
+		TeamName:    s.TeamDomain,
+		Text:        s.Text,
+		TriggerId:   s.TriggerID,
+		ResponseURL: s.ResponseURL,
+	}
+}
+
+func (h *SlackHandler) getInteractionPayload(writer http.ResponseWriter, request *http.Request) (InteractionPayload, error) {
+	verifier, err := slack.NewSecretsVerifier(request.Header, h.signingSecret)
+	if err != nil {
+		writer.WriteHeader(http.StatusUnauthorized)
+		return InteractionPayload{}, errors.Wrap(err, "could not verify interaction")
+	}
+
+	request.Body = ioutil.NopCloser(io.TeeReader(request.Body, &verifier))
+	err = request.ParseForm()
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return InteractionPayload{}, errors.Wrap(err, "could not parse interaction")
+	}
+
+	if err = verifier.Ensure(); err != nil {
+		writer.WriteHeader(http.StatusUnauthorized)
+		return InteractionPayload{}, errors.New("Unauthorized interaction sent to SlackOverload. Rejected.")
+	}
+
+	var payload InteractionPayload
+	err = json.Unmarshal([]byte(request.PostForm.Get("payload")), &payload)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return InteractionPayload{}, errors.Wrap(err, "could not unmarshal interaction")
+	}
+
+	return payload, nil
+}
+
+func (h *SlackHandler) getEventEnvelope(writer http.ResponseWriter, request *http.Request) (EventEnvelope, error) {
+	verifier, err := slack.NewSecretsVerifier(request.Header, h.signingSecret)
+	if err != nil {
+		writer.WriteHeader(http.StatusUnauthorized)
+		return EventEnvelope{}, errors.Wrap(err, "could not verify event")
+	}
+
+	body, err := ioutil.ReadAll(io.TeeReader(request.Body, &verifier))
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return EventEnvelope{}, errors.Wrap(err, "could not read event")
+	}
+
+	if err = verifier.Ensure(); err != nil {
+		writer.WriteHeader(http.StatusUnauthorized)
+		return EventEnvelope{}, errors.New("Unauthorized event sent to SlackOverload. Rejected.")
+	}
+
+	var envelope EventEnvelope
+	err = json.Unmarshal(body, &envelope)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return EventEnvelope{}, errors.Wrap(err, "could not unmarshal event")
+	}
+
+	return envelope, nil
 }
@@ -0,0 +1,318 @@
+package slackoverload
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+// keywordSkip in a workspace override leaves the status alone on the workspace.
+const keywordSkip = "SKIP"
+
+const overrideExample = `/override-trigger ooo = "🌴" NODND`
+
+// WorkspaceOverride changes a trigger on a single workspace. Values that
+// aren't set are taken from the trigger.
+type WorkspaceOverride struct {
+	// TeamName is the name of the workspace, for listing the override.
+	TeamName string `json:"team-name,omitempty"`
+
+	// Skip leaves the status on the workspace alone.
+	Skip bool `json:"skip,omitempty"`
+
+	StatusText  *string `json:"status-text,omitempty"`
+	StatusEmoji *string `json:"status-emoji,omitempty"`
+	DnD         *bool   `json:"dnd,omitempty"`
+}
+
+// Apply the override to a copy of the action.
+func (o WorkspaceOverride) Apply(action Action) Action {
+	if o.StatusText != nil {
+		action.StatusText = *o.StatusText
+	}
+	if o.StatusEmoji != nil {
+		action.StatusEmoji = *o.StatusEmoji
+	}
+	if o.DnD != nil {
+		action.DnD = *o.DnD
+	}
+	return action
+}
+
+// ToString formats the override the way that it is written in /override-trigger.
+func (o WorkspaceOverride) ToString() string {
+	if o.Skip {
+		return keywordSkip
+	}
+
+	var parts []string
+	if o.StatusText != nil {
+		text := formatStatusText(*o.StatusText)
+		if text == *o.StatusText && (text == "" || containsWord(text, keywordSkip)) {
+			text = fmt.Sprintf("%q", text)
+		}
+		parts = append(parts, text)
+	}
+	if o.StatusEmoji != nil {
+		parts = append(parts, fmt.Sprintf("(%s)", *o.StatusEmoji))
+	}
+	if o.DnD != nil {
+		if *o.DnD {
+			parts = append(parts, keywordDnD)
+		} else {
+			parts = append(parts, keywordNoDnD)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func containsWord(text string, word string) bool {
+	for _, field := range strings.Fields(text) {
+		if field == word {
+			return true
+		}
+	}
+	return false
+}
+
+// ForWorkspace merges the override for a workspace over the action, returning
+// false when the action skips the workspace.
+func (a Action) ForWorkspace(teamId string) (Action, bool) {
+	override, ok := a.Workspaces[teamId]
+	a.Workspaces = nil
+	if !ok {
+		return a, true
+	}
+	if override.Skip {
+		return a, false
+	}
+	return override.Apply(a), true
+}
+
+// skipWorkspaces copies the action, adding the workspaces that are skipped
+// by the overrides.
+func (a Action) skipWorkspaces(overrides map[string]WorkspaceOverride) Action {
+	var workspaces map[string]WorkspaceOverride
+	for teamId, override := range overrides {
+		if !override.Skip {
+			continue
+		}
+		if workspaces == nil {
+			workspaces = make(map[string]WorkspaceOverride, len(a.Workspaces))
+			for id, o := range a.Workspaces {
+				workspaces[id] = o
+			}
+		}
+		workspaces[teamId] = override
+	}
+	if workspaces != nil {
+		a.Workspaces = workspaces
+	}
+	return a
+}
+
+// withoutDnD copies the overrides, leaving out the DND setting of each.
+func withoutDnD(overrides map[string]WorkspaceOverride) map[string]WorkspaceOverride {
+	if overrides == nil {
+		return nil
+	}
+	copied := make(map[string]WorkspaceOverride, len(overrides))
+	for teamId, override := range overrides {
+		override.DnD = nil
+		copied[teamId] = override
+	}
+	return copied
+}
+
+// workspaceOverridesText lists how a trigger is different on each workspace.
+func workspaceOverridesText(overrides map[string]WorkspaceOverride) string {
+	var lines []string
+	for teamId, override := range overrides {
+		workspace := override.TeamName
+		if workspace == "" {
+			workspace = teamId
+		}
+		lines = append(lines, fmt.Sprintf("\n*On %s*: %s", workspace, override.ToString()))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "")
+}
+
+type OverrideTriggerRequest struct {
+	SlackPayload
+}
+
+// Parse the trigger name and the override for the current workspace, which
+// is nil when the override should be removed.
+func (r OverrideTriggerRequest) Parse() (string, *WorkspaceOverride, error) {
+	return parseWorkspaceOverride(r.Text)
+}
+
+// OverrideTrigger changes how a global trigger sets your status on the
+// current workspace.
+func (a *App) OverrideTrigger(r OverrideTriggerRequest) (slack.Msg, error) {
+	fmt.Printf("%s /override-trigger %q from %s(%s) on %s(%s)\n",
+		now(), r.Text, r.UserName, r.SlackId, r.TeamName, r.TeamId)
+
+	userId, err := a.lookupUserIdFromSlackId(r.SlackId)
+	if err != nil {
+		if IsNotFound(err) {
+			return a.handleUserNotRegistered(), nil
+		}
+		return slack.Msg{}, err
+	}
+
+	name, override, err := r.Parse()
+	if err != nil {
+		return slack.Msg{}, err
+	}
+
+	if override != nil {
+		override.TeamName = r.TeamName
+	}
+
+	err = a.updateTrigger(userId, name, func(tmpl *ActionTemplate) error {
+		if !tmpl.Global {
+			if tmpl.TeamId == "" {
+				return TriggerNotFoundError{Name: name}
+			}
+			return errors.Errorf("Trigger %s only changes your status on the workspace where it was created. Change it with /overload edit %s instead.", name, name)
+		}
+
+		workspaces := make(map[string]WorkspaceOverride, len(tmpl.Workspaces))
+		for teamId, o := range tmpl.Workspaces {
+			workspaces[teamId] = o
+		}
+		if override == nil {
+			delete(workspaces, r.TeamId)
+		} else {
+			workspaces[r.TeamId] = *override
+		}
+		if len(workspaces) == 0 {
+			workspaces = nil
+		}
+		tmpl.Workspaces = workspaces
+		return nil
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			return slack.Msg{}, errors.Errorf("Could not change trigger %q because it is not defined", name)
+		}
+		return slack.Msg{}, err
+	}
+
+	var text string
+	switch {
+	case override == nil:
+		text = fmt.Sprintf("Trigger *%s* is no longer different on this workspace", name)
+	case override.Skip:
+		text = fmt.Sprintf("Trigger *%s* will leave your status alone on this workspace", name)
+	default:
+		text = fmt.Sprintf("Trigger *%s* will use `%s` on this workspace", name, override.ToString())
+	}
+
+	msg := slack.Msg{
+		Type: slack.ResponseTypeEphemeral,
+		Text: text,
+	}
+	return msg, nil
+}
+
+// parseWorkspaceOverride parses a workspace override:
+//
+//	NAME = [STATUS TEXT | "STATUS TEXT"] [(EMOJI)] [DND|NODND]
+//	NAME = SKIP
+//	NAME
+//
+// Only the values that are specified replace the trigger's, use "" for an
+// empty status text. A name without anything else removes the override.
+func parseWorkspaceOverride(def string) (string, *WorkspaceOverride, error) {
+	tokens, err := tokenizeTrigger(def)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(tokens) == 0 {
+		return "", nil, errors.Errorf("Which trigger? Try %s", overrideExample)
+	}
+
+	name := tokens[0]
+	if name.kind != tokenWord || !triggerNamePattern.MatchString(name.value) {
+		return "", nil, newOverrideParseError(name, "the trigger name can only have letters, numbers, dashes and underscores")
+	}
+	if len(tokens) == 1 {
+		return name.value, nil, nil
+	}
+	if tokens[1].kind != tokenEquals {
+		return "", nil, newOverrideParseError(tokens[1], "expected = after the trigger name")
+	}
+
+	rest := tokens[2:]
+	if len(rest) == 0 {
+		return "", nil, newOverrideParseError(tokens[1], "missing the changes after =, use %s to leave your status alone on this workspace", keywordSkip)
+	}
+	if len(rest) == 1 && rest[0].kind == tokenWord && rest[0].value == keywordSkip {
+		return name.value, &WorkspaceOverride{Skip: true}, nil
+	}
+
+	status, err := parseStatusTokens(rest, newOverrideParseError)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Point at the first part of the definition that can't be different on a workspace
+	var unsupported *token
+	for _, t := range []*token{status.presence, status.timing} {
+		if t != nil && (unsupported == nil || t.pos < unsupported.pos) {
+			unsupported = t
+		}
+	}
+	for i, t := range status.words {
+		if t.kind == tokenWord && t.value == keywordSkip && (unsupported == nil || t.pos < unsupported.pos) {
+			unsupported = &status.words[i]
+		}
+	}
+	if unsupported != nil {
+		return "", nil, newOverrideParseError(*unsupported, "only the status text, emoji and DND can be different on a workspace, quote the status text to use %s in it", unsupported.value)
+	}
+
+	var override WorkspaceOverride
+	if status.textToken != nil {
+		override.StatusText = &status.text
+	}
+	if status.emojiToken != nil {
+		override.StatusEmoji = &status.emoji
+	}
+	if status.dndToken != nil {
+		override.DnD = &status.dnd
+	}
+
+	return name.value, &override, nil
+}
+
+func newOverrideParseError(t token, format string, args ...interface{}) error {
+	return errors.Errorf("Invalid workspace override at %s (character %d): %s. Try %s",
+		t.raw, t.pos, fmt.Sprintf(format, args...), overrideExample)
+}
+
+// validateWorkspaceOverrides checks overrides with the same rules as
+// /override-trigger.
+func validateWorkspaceOverrides(overrides map[string]WorkspaceOverride) error {
+	for teamId, override := range overrides {
+		if override.Skip {
+			continue
+		}
+		if override.StatusText != nil {
+			if err := validateStatusText(*override.StatusText); err != nil {
+				return errors.Errorf("invalid status text for workspace %s, %s", teamId, err)
+			}
+		}
+		if override.StatusEmoji != nil && *override.StatusEmoji != "" && !isEmoji(*override.StatusEmoji) {
+			return errors.Errorf("invalid emoji %q for workspace %s", *override.StatusEmoji, teamId)
+		}
+	}
+	return nil
+}
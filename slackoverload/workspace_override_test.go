@@ -0,0 +1,179 @@
+package slackoverload
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseWorkspaceOverride_RoundTrip(t *testing.T) {
+	text := func(s string) *string { return &s }
+	dnd := func(b bool) *bool { return &b }
+
+	testcases := []struct {
+		name     string
+		override WorkspaceOverride
+		want     string
+	}{
+		{name: "skip", override: WorkspaceOverride{Skip: true}, want: "SKIP"},
+		{name: "status text", override: WorkspaceOverride{StatusText: text("OOO, ping @alice")}, want: "OOO, ping @alice"},
+		{name: "empty status text", override: WorkspaceOverride{StatusText: text(""), StatusEmoji: text("🌴")}, want: `"" (🌴)`},
+		{name: "emoji and dnd", override: WorkspaceOverride{StatusEmoji: text(":palm_tree:"), DnD: dnd(false)}, want: "(:palm_tree:) NODND"},
+		{name: "every value", override: WorkspaceOverride{StatusText: text("out for lunch"), StatusEmoji: text("🌯"), DnD: dnd(true)}, want: "out for lunch (🌯) DND"},
+		{name: "keyword in the status text", override: WorkspaceOverride{StatusText: text("SKIP me")}, want: `"SKIP me"`},
+		{name: "presence in the status text", override: WorkspaceOverride{StatusText: text("AWAY until 5pm")}, want: `"AWAY until 5pm"`},
+		{name: "template", override: WorkspaceOverride{StatusText: text("lunch with {{.Arg 1}}")}, want: "lunch with {{.Arg 1}}"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			def := tc.override.ToString()
+			if def != tc.want {
+				t.Fatalf("expected %s, got %s", tc.want, def)
+			}
+
+			name, got, err := parseWorkspaceOverride("ooo = " + def)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != "ooo" || got == nil || !reflect.DeepEqual(tc.override, *got) {
+				t.Fatalf("expected %#v, got %s %#v", tc.override, name, got)
+			}
+		})
+	}
+
+	name, got, err := parseWorkspaceOverride("ooo")
+	if err != nil || name != "ooo" || got != nil {
+		t.Fatalf("expected a name by itself to remove the override, got %s %#v %v", name, got, err)
+	}
+}
+
+func TestParseWorkspaceOverride_Invalid(t *testing.T) {
+	testcases := []struct {
+		def     string
+		wantErr string
+	}{
+		{"", "Which trigger?"},
+		{"ooo x", "expected = after the trigger name"},
+		{"ooo =", "missing the changes after ="},
+		{"ooo = a = b", "at = (character 9): only one = is allowed"},
+		{"ooo = brb AWAY", "at AWAY (character 11): only the status text, emoji and DND can be different on a workspace"},
+		{"ooo = ACTIVE", "at ACTIVE (character 7): only the status text, emoji and DND"},
+		{"ooo = brb for 1h", "at for (character 11): only the status text, emoji and DND"},
+		{"ooo = brb until 5pm", "at until (character 11): only the status text, emoji and DND"},
+		{"ooo = brb SKIP", "at SKIP (character 11): only the status text, emoji and DND"},
+		{"ooo = brb for 1h AWAY", "at for (character 11)"},
+		{"ooo = DND NODND", "Do Not Disturb was already set with DND"},
+		{`ooo = "a" "b"`, "the status text was already set to \"a\""},
+		{"ooo = " + strings.Repeat("a", maxStatusTextLength+1), "Slack only allows"},
+		{"ooo = brb {{.Nope}}", "isn't a valid template"},
+	}
+
+	for _, tc := range testcases {
+		_, _, err := parseWorkspaceOverride(tc.def)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%q: expected error %q, got %v", tc.def, tc.wantErr, err)
+		}
+		if err != nil && !strings.HasPrefix(err.Error(), "Invalid workspace override") && !strings.HasPrefix(err.Error(), "Which trigger?") {
+			t.Errorf("%q: expected a workspace override error, got %v", tc.def, err)
+		}
+	}
+}
+
+func TestValidateWorkspaceOverrides(t *testing.T) {
+	text := func(s string) *string { return &s }
+
+	valid := map[string]WorkspaceOverride{
+		"T1": {Skip: true, StatusText: text(strings.Repeat("a", maxStatusTextLength+1))},
+		"T2": {StatusText: text("lunch with {{.Arg 1}}"), StatusEmoji: text("")},
+	}
+	if err := validateWorkspaceOverrides(valid); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, override := range map[string]WorkspaceOverride{
+		"Slack only allows":      {StatusText: text(strings.Repeat("a", maxStatusTextLength+1))},
+		"isn't a valid template": {StatusText: text("{{.Nope}}")},
+		"invalid emoji":          {StatusEmoji: text("boat")},
+	} {
+		err := validateWorkspaceOverrides(map[string]WorkspaceOverride{"T2": override})
+		if err == nil || !strings.Contains(err.Error(), name) || !strings.Contains(err.Error(), "T2") {
+			t.Errorf("expected error %q for workspace T2, got %v", name, err)
+		}
+	}
+}
+
+// recordingSecrets doesn't have any secrets, and remembers which were requested.
+type recordingSecrets struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (s *recordingSecrets) GetSecret(key string) (string, map[string]*string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, key)
+	return "", nil, SecretNotFoundError{Key: key}
+}
+
+func (s *recordingSecrets) SetSecret(key string, value string, tags map[string]*string) error {
+	return nil
+}
+
+func TestOverrideTrigger_Skip(t *testing.T) {
+	a := newTwoWorkspaceApp(t)
+	secrets := &recordingSecrets{}
+	a.Secrets = secrets
+
+	tmpl := ActionTemplate{
+		Name:   "ooo",
+		TeamId: "T1",
+		Global: true,
+		Action: Action{Presence: PresenceAway, StatusText: "OOO", Duration: "1w"},
+		Steps:  []TriggerStep{{Action: Action{Presence: PresenceAway, StatusText: "back"}}},
+	}
+	if err := a.createTrigger("u1", tmpl); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := a.OverrideTrigger(OverrideTriggerRequest{SlackPayload{SlackId: "U2", TeamId: "T2", TeamName: "community", Text: "ooo = SKIP"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := a.getTrigger("u1", "ooo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if override := saved.Workspaces["T2"]; !override.Skip || override.TeamName != "community" {
+		t.Fatalf("expected the trigger to skip T2, got %#v", saved.Workspaces)
+	}
+
+	// The trigger's steps skip the workspace too
+	steps, err := expandTriggerSteps(saved, a.triggerLookup("u1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, step := range steps {
+		if _, ok := step.ForWorkspace("T2"); ok {
+			t.Fatalf("expected step %d to skip T2", i+1)
+		}
+		if _, ok := step.ForWorkspace("T1"); !ok {
+			t.Fatalf("expected step %d to change T1", i+1)
+		}
+	}
+
+	// Only the account on T1 is changed, so only its token is needed
+	err = a.applyActionToSlacks("u1", "", steps[0], triggerRun{})
+	if err == nil {
+		t.Fatal("expected an error since there isn't a token for T1")
+	}
+	for _, key := range secrets.keys {
+		if strings.Contains(key, "U2") {
+			t.Fatalf("expected the account on T2 to be left alone, but %s was requested", key)
+		}
+	}
+	if len(secrets.keys) == 0 {
+		t.Fatal("expected the account on T1 to be changed")
+	}
+}